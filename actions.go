@@ -15,6 +15,8 @@ var ClientReqActions = []ClientAction{
 	SessionKeysAct{},
 	MsgReqAct{},
 	SearchReqAct{},
+	UrlSearchAct{},
+	SearchAllAct{},
 	FetchUrlAct{},
 	FetchCollectionsAction{},
 	FetchInboundLinksAct{},
@@ -41,6 +43,58 @@ var ClientReqActions = []ClientAction{
 	CollectionItemsAction{},
 	SaveCollectionItemsAction{},
 	DeleteCollectionItemsAction{},
+	ArchiveRequestsAct{},
+	WarcExportAct{},
+	WarcImportStatusAct{},
+	SubscribeAct{},
+	UnsubscribeAct{},
+	UrlSnapshotsAct{},
+	UrlSnapshotChangesAct{},
+	FetchUncrawlablesAction{},
+	FetchUncrawlableAction{},
+	SaveUncrawlableAction{},
+	DeleteUncrawlableAction{},
+	FetchCustomCrawlsAction{},
+	FetchCustomCrawlAction{},
+	SaveCustomCrawlAction{},
+	CompleteCustomCrawlAction{},
+	FetchDataReposAction{},
+	FetchDataRepoAction{},
+	SaveDataRepoAction{},
+	DeleteDataRepoAction{},
+	MetadataHistoryAction{},
+	MetadataDiffAction{},
+	VerifyMetadataAction{},
+	FetchSchemaAction{},
+	SaveSchemaAction{},
+	MetadataImportAct{},
+	MetadataImportStatusAct{},
+	MetadataExportAct{},
+	CollectionExportAct{},
+	CollectionImportAct{},
+	ReorderCollectionItemAct{},
+	MoveCollectionItemsAct{},
+	DuplicateCollectionAct{},
+	CollectionVersionsAct{},
+	CollectionVersionAct{},
+	RestoreCollectionVersionAct{},
+	CollectionSharingAct{},
+	ShareCollectionAct{},
+	UnshareCollectionAct{},
+	CollectionVisibilityAct{},
+	SharedCollectionsAct{},
+	SavePrimerAct{},
+	DeletePrimerAct{},
+	ReparentPrimerAct{},
+	SaveSourceAct{},
+	DeleteSourceAct{},
+	ReparentSourceAct{},
+	AuditLogAct{},
+	AlertsAct{},
+	DismissAlertAct{},
+	SuppressAlertsAct{},
+	UnsuppressAlertsAct{},
+	SourceCoverageAct{},
 }
 
 // Action is a collection of typed events for exchange between client & server
@@ -76,6 +130,9 @@ type ClientResponse struct {
 	Page        int         `json:"page,omitempty"`
 	PageSize    int         `json:"pageSize,omitempty"`
 	Id          string      `json:"id,omitempty"`
+	NextCursor  string      `json:"nextCursor,omitempty"`
+	PrevCursor  string      `json:"prevCursor,omitempty"`
+	Total       int         `json:"total,omitempty"`
 	Data        interface{} `json:"data,omitempty"`
 }
 
@@ -83,6 +140,18 @@ type ReqAction struct {
 	RequestId   string `json:"requestId"`
 	SilentError bool   `json:"silentError"`
 	err         error
+	// client that issued this request, nil when executed outside a connection
+	client *Client
+}
+
+// clientAction is implemented by any action that embeds ReqAction, letting
+// the client that issued a request attach itself before execution
+type clientAction interface {
+	setClient(c *Client)
+}
+
+func (a *ReqAction) setClient(c *Client) {
+	a.client = c
 }
 
 type MsgReqAct struct {
@@ -147,6 +216,97 @@ func (s *SearchReqAct) Exec() (res *ClientResponse) {
 	}
 }
 
+// UrlSearchAct is a ranked full text search of urls, optionally narrowed to
+// a content type, source or primer, with highlighted snippets, a total &
+// facet counts
+type UrlSearchAct struct {
+	ReqAction
+	Query       string
+	ContentType string
+	SourceId    string
+	PrimerId    string
+	Page        int
+	PageSize    int
+}
+
+func (UrlSearchAct) Type() string        { return "URL_SEARCH_REQUEST" }
+func (UrlSearchAct) SuccessType() string { return "URL_SEARCH_SUCCESS" }
+func (UrlSearchAct) FailureType() string { return "URL_SEARCH_FAILURE" }
+
+func (UrlSearchAct) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &UrlSearchAct{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+func (s *UrlSearchAct) Exec() (res *ClientResponse) {
+	if s.Page > 0 {
+		s.Page = s.Page - 1
+	}
+	search := &UrlSearch{
+		Query:       s.Query,
+		ContentType: s.ContentType,
+		SourceId:    s.SourceId,
+		PrimerId:    s.PrimerId,
+	}
+	results, err := search.Run(appDB, s.PageSize, s.Page*s.PageSize)
+	if err != nil {
+		return &ClientResponse{
+			Type:      s.FailureType(),
+			Error:     err.Error(),
+			RequestId: s.RequestId,
+		}
+	}
+	return &ClientResponse{
+		Type:      s.SuccessType(),
+		RequestId: s.RequestId,
+		Schema:    "URL_SEARCH_RESULTS",
+		Data:      results,
+	}
+}
+
+// SearchAllAct searches across primers, sources, collections, urls,
+// metadata & uncrawlables, returning hits tagged with their schema
+type SearchAllAct struct {
+	ReqAction
+	Query string
+	// schemas to search, eg: ["PRIMER", "SOURCE"]. empty searches everything
+	Types    []string
+	Page     int
+	PageSize int
+}
+
+func (SearchAllAct) Type() string        { return "SEARCH_ALL_REQUEST" }
+func (SearchAllAct) SuccessType() string { return "SEARCH_ALL_SUCCESS" }
+func (SearchAllAct) FailureType() string { return "SEARCH_ALL_FAILURE" }
+
+func (SearchAllAct) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &SearchAllAct{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+func (s *SearchAllAct) Exec() (res *ClientResponse) {
+	if s.Page > 0 {
+		s.Page = s.Page - 1
+	}
+	search := &SearchAll{Query: s.Query, Types: s.Types}
+	results, err := search.Run(appDB, s.PageSize, s.Page*s.PageSize)
+	if err != nil {
+		return &ClientResponse{
+			Type:      s.FailureType(),
+			Error:     err.Error(),
+			RequestId: s.RequestId,
+		}
+	}
+	return &ClientResponse{
+		Type:      s.SuccessType(),
+		RequestId: s.RequestId,
+		Schema:    "SEARCH_ALL_RESULTS",
+		Data:      results,
+	}
+}
+
 // FetchUrlAct fetches a url from the DB
 type FetchUrlAct struct {
 	ReqAction
@@ -185,6 +345,7 @@ func (a *FetchUrlAct) Exec() (res *ClientResponse) {
 // FetchInboundLinksAct fetches a url's outbound links
 type FetchInboundLinksAct struct {
 	ReqAction
+	PageParams
 	Url string
 }
 
@@ -194,12 +355,13 @@ func (FetchInboundLinksAct) FailureType() string { return "URL_FETCH_INBOUND_LIN
 
 func (FetchInboundLinksAct) Parse(reqId string, data json.RawMessage) ClientRequestAction {
 	a := &FetchInboundLinksAct{}
+	a.RequestId = reqId
 	a.err = json.Unmarshal(data, a)
 	return a
 }
 
 func (a *FetchInboundLinksAct) Exec() (res *ClientResponse) {
-	links, err := core.ReadSrcLinks(appDB, &core.Url{Url: a.Url})
+	links, page, err := ListInboundLinksPage(appDB, &core.Url{Url: a.Url}, &a.PageParams)
 	if err != nil {
 		return &ClientResponse{
 			Type:      a.FailureType(),
@@ -208,17 +370,18 @@ func (a *FetchInboundLinksAct) Exec() (res *ClientResponse) {
 		}
 	}
 
-	return &ClientResponse{
+	return page.respond(&a.PageParams, &ClientResponse{
 		Type:      a.SuccessType(),
 		RequestId: a.RequestId,
 		Schema:    "LINK_ARRAY",
 		Data:      links,
-	}
+	})
 }
 
 // FetchOutboundLinksAct fetches a url's outbound links
 type FetchOutboundLinksAct struct {
 	ReqAction
+	PageParams
 	Url string
 }
 
@@ -228,12 +391,13 @@ func (FetchOutboundLinksAct) FailureType() string { return "URL_FETCH_OUTBOUND_L
 
 func (FetchOutboundLinksAct) Parse(reqId string, data json.RawMessage) ClientRequestAction {
 	a := &FetchOutboundLinksAct{}
+	a.RequestId = reqId
 	a.err = json.Unmarshal(data, a)
 	return a
 }
 
 func (a *FetchOutboundLinksAct) Exec() (res *ClientResponse) {
-	links, err := core.ReadDstLinks(appDB, &core.Url{Url: a.Url})
+	links, page, err := ListOutboundLinksPage(appDB, &core.Url{Url: a.Url}, &a.PageParams)
 	if err != nil {
 		log.Info(err.Error())
 		return &ClientResponse{
@@ -243,20 +407,19 @@ func (a *FetchOutboundLinksAct) Exec() (res *ClientResponse) {
 		}
 	}
 
-	return &ClientResponse{
+	return page.respond(&a.PageParams, &ClientResponse{
 		Type:      a.SuccessType(),
 		RequestId: a.RequestId,
 		Schema:    "LINK_ARRAY",
 		Data:      links,
-	}
+	})
 }
 
 // FetchRecentContentUrlsAction grabs a page of recently getted (no, "getted" is not a word)
 // urls that lead to content
 type FetchRecentContentUrlsAction struct {
 	ReqAction
-	Page     int
-	PageSize int
+	PageParams
 }
 
 func (FetchRecentContentUrlsAction) Type() string        { return "CONTENT_RECENT_URLS_REQUEST" }
@@ -271,7 +434,7 @@ func (FetchRecentContentUrlsAction) Parse(reqId string, data json.RawMessage) Cl
 }
 
 func (a *FetchRecentContentUrlsAction) Exec() (res *ClientResponse) {
-	urls, err := core.ContentUrls(appDB, a.PageSize, a.PageSize*(a.Page-1))
+	urls, page, err := ListContentUrlsPage(appDB, &a.PageParams)
 	if err != nil {
 		return &ClientResponse{
 			Type:      a.FailureType(),
@@ -280,14 +443,12 @@ func (a *FetchRecentContentUrlsAction) Exec() (res *ClientResponse) {
 		}
 	}
 
-	return &ClientResponse{
+	return page.respond(&a.PageParams, &ClientResponse{
 		Type:      a.SuccessType(),
 		RequestId: a.RequestId,
 		Schema:    "URL_ARRAY",
-		Page:      a.Page,
-		PageSize:  a.PageSize,
 		Data:      urls,
-	}
+	})
 }
 
 // FetchContentUrlsAction triggers archiving a url
@@ -368,12 +529,19 @@ func (a *FetchMetadataAction) Exec() (res *ClientResponse) {
 	}
 }
 
-// SaveMetadataAction triggers archiving a url
+// SaveMetadataAction writes the next version of metadata for a subject.
+// Metadata must either be signed by the client, providing the signature of
+// MetadataSigningBytes & the PEM-encoded public key that made it, or written
+// by a logged in user, in which case the server signs it
 type SaveMetadataAction struct {
 	ReqAction
 	KeyId   string                 `json:"keyId"`
 	Subject string                 `json:"subject"`
 	Meta    map[string]interface{} `json:"meta"`
+	// base64-encoded RSA PKCS1v15 SHA256 signature
+	Signature string `json:"signature"`
+	// PEM-encoded public key that made Signature
+	PublicKey string `json:"publicKey"`
 }
 
 func (SaveMetadataAction) Type() string        { return "METADATA_SAVE_REQUEST" }
@@ -388,40 +556,73 @@ func (SaveMetadataAction) Parse(reqId string, data json.RawMessage) ClientReques
 }
 
 func (a *SaveMetadataAction) Exec() (res *ClientResponse) {
-	m, err := core.NextMetadata(appDB, a.KeyId, a.Subject)
+	m, err := a.save()
 	if err != nil {
 		log.Info(err.Error())
-		return &ClientResponse{
+		res = &ClientResponse{
 			Type:      a.FailureType(),
 			RequestId: a.RequestId,
 			Error:     err.Error(),
 		}
-	}
-
-	m.Meta = a.Meta
-	if err := m.Write(store); err != nil {
-		log.Info(err.Error())
-		return &ClientResponse{
-			Type:      a.FailureType(),
-			RequestId: a.RequestId,
-			Error:     err.Error(),
+		// send per-field errors so clients can mark up forms
+		if verr, ok := err.(ValidationError); ok {
+			res.Schema = "SCHEMA_ERROR_ARRAY"
+			res.Data = verr
 		}
+		return res
 	}
 
 	return &ClientResponse{
 		Type:      a.SuccessType(),
 		RequestId: a.RequestId,
 		Schema:    "METADATA",
-		Data:      a,
+		Data:      m,
 	}
 }
 
+func (a *SaveMetadataAction) save() (*core.Metadata, error) {
+	keyId, err := a.keyId()
+	if err != nil {
+		return nil, err
+	}
+
+	var sig *MetadataSignature
+	if a.Signature != "" {
+		sig = &MetadataSignature{KeyId: keyId, PublicKey: a.PublicKey, Signature: a.Signature}
+	}
+	return WriteMetadata(keyId, a.Subject, a.Meta, sig)
+}
+
+// keyId determines the key metadata is written under. signed requests use
+// the key that made the signature, unsigned requests use the logged in
+// user's key & require the server to have a signing key
+func (a *SaveMetadataAction) keyId() (string, error) {
+	keyId := a.client.keyId()
+	if a.Signature != "" {
+		pub, err := ParsePublicKey(a.PublicKey)
+		if err != nil {
+			return "", err
+		}
+		if keyId, err = PublicKeyId(pub); err != nil {
+			return "", err
+		}
+	} else if keyId == "" {
+		return "", fmt.Errorf("metadata must be signed or saved by a logged in user")
+	} else if signingKey == nil {
+		return "", fmt.Errorf("metadata must be signed")
+	}
+
+	if a.KeyId != "" && a.KeyId != keyId {
+		return "", fmt.Errorf("keyId doesn't match signing key")
+	}
+	return keyId, nil
+}
+
 // FetchPrimersAction grabs a page of primers
 type FetchPrimersAction struct {
 	ReqAction
+	PageParams
 	BaseOnly bool
-	Page     int
-	PageSize int
 }
 
 func (FetchPrimersAction) Type() string        { return "PRIMERS_FETCH_REQUEST" }
@@ -436,15 +637,7 @@ func (FetchPrimersAction) Parse(reqId string, data json.RawMessage) ClientReques
 }
 
 func (a *FetchPrimersAction) Exec() (res *ClientResponse) {
-	var (
-		primers []*core.Primer
-		err     error
-	)
-	if a.BaseOnly {
-		primers, err = core.BasePrimers(appDB, 50, 0)
-	} else {
-		primers, err = core.ListPrimers(store, 50, 0)
-	}
+	primers, page, err := ListPrimersPage(appDB, a.BaseOnly, &a.PageParams)
 	if err != nil {
 		log.Info(err.Error())
 		return &ClientResponse{
@@ -453,12 +646,12 @@ func (a *FetchPrimersAction) Exec() (res *ClientResponse) {
 			Error:     err.Error(),
 		}
 	}
-	return &ClientResponse{
+	return page.respond(&a.PageParams, &ClientResponse{
 		Type:      a.SuccessType(),
 		RequestId: a.RequestId,
 		Schema:    "PRIMER_ARRAY",
 		Data:      primers,
-	}
+	})
 }
 
 // FetchPrimerAction grabs a page of primers
@@ -507,6 +700,9 @@ func (a *FetchPrimerAction) Exec() (res *ClientResponse) {
 		}
 	}
 
+	// updated stats are published to the primer's topic
+	statsScheduler.Request(StatsPrimer, p.Id)
+
 	return &ClientResponse{
 		Type:      a.SuccessType(),
 		RequestId: a.RequestId,
@@ -518,8 +714,7 @@ func (a *FetchPrimerAction) Exec() (res *ClientResponse) {
 // FetchSourcesAction grabs a page of primers
 type FetchSourcesAction struct {
 	ReqAction
-	Page     int
-	PageSize int
+	PageParams
 }
 
 func (FetchSourcesAction) Type() string        { return "SOURCES_FETCH_REQUEST" }
@@ -534,7 +729,7 @@ func (FetchSourcesAction) Parse(reqId string, data json.RawMessage) ClientReques
 }
 
 func (a *FetchSourcesAction) Exec() (res *ClientResponse) {
-	s, err := core.ListSources(store, a.PageSize, (a.Page-1)*a.PageSize)
+	s, page, err := ListSourcesPage(appDB, &a.PageParams)
 	if err != nil {
 		log.Info(err.Error())
 		return &ClientResponse{
@@ -544,14 +739,12 @@ func (a *FetchSourcesAction) Exec() (res *ClientResponse) {
 		}
 	}
 
-	return &ClientResponse{
+	return page.respond(&a.PageParams, &ClientResponse{
 		Type:      a.SuccessType(),
 		RequestId: a.RequestId,
 		Schema:    "SOURCE_ARRAY",
 		Data:      s,
-		Page:      a.Page,
-		PageSize:  a.PageSize,
-	}
+	})
 }
 
 // FetchSourceAction grabs a page of subprimers for a given primer id
@@ -591,17 +784,8 @@ func (a *FetchSourceAction) Exec() (res *ClientResponse) {
 		}
 	}
 
-	// TODO - hook this up to a cron-based que
-	go func() {
-		if err := s.CalcStats(appDB); err != nil {
-			log.Info(err.Error())
-			// return &ClientResponse{
-			// 	Type:      a.FailureType(),
-			// 	RequestId: a.RequestId,
-			// 	Error:     err.Error(),
-			// }
-		}
-	}()
+	// updated stats are published to the source's topic
+	statsScheduler.Request(StatsSource, s.Id)
 
 	return &ClientResponse{
 		Type:      a.SuccessType(),
@@ -611,12 +795,11 @@ func (a *FetchSourceAction) Exec() (res *ClientResponse) {
 	}
 }
 
-// FetchSourceAction grabs a page of primers
+// FetchSourceUrlsAction grabs a page of a source's undescribed content urls
 type FetchSourceUrlsAction struct {
 	ReqAction
-	Id       string
-	Page     int
-	PageSize int
+	PageParams
+	Id string
 }
 
 func (FetchSourceUrlsAction) Type() string        { return "SOURCE_URLS_REQUEST" }
@@ -641,7 +824,7 @@ func (a *FetchSourceUrlsAction) Exec() (res *ClientResponse) {
 		}
 	}
 
-	urls, err := s.UndescribedContent(appDB, 100, 0)
+	urls, page, err := ListSourceContentPage(appDB, s, false, &a.PageParams)
 	if err != nil {
 		log.Info(err.Error())
 		return &ClientResponse{
@@ -651,22 +834,21 @@ func (a *FetchSourceUrlsAction) Exec() (res *ClientResponse) {
 		}
 	}
 
-	return &ClientResponse{
+	return page.respond(&a.PageParams, &ClientResponse{
 		Type:      a.SuccessType(),
 		RequestId: a.RequestId,
 		Schema:    "URL_ARRAY",
 		Id:        a.Id,
-		Page:      a.Page,
-		PageSize:  a.PageSize,
 		Data:      urls,
-	}
+	})
 }
 
+// FetchSourceAttributedUrlsAction grabs a page of a source's described
+// content urls
 type FetchSourceAttributedUrlsAction struct {
 	ReqAction
-	Id       string
-	Page     int
-	PageSize int
+	PageParams
+	Id string
 }
 
 func (FetchSourceAttributedUrlsAction) Type() string {
@@ -697,7 +879,7 @@ func (a *FetchSourceAttributedUrlsAction) Exec() (res *ClientResponse) {
 		}
 	}
 
-	urls, err := s.DescribedContent(appDB, 100, 0)
+	urls, page, err := ListSourceContentPage(appDB, s, true, &a.PageParams)
 	if err != nil {
 		log.Info(err.Error())
 		return &ClientResponse{
@@ -707,20 +889,21 @@ func (a *FetchSourceAttributedUrlsAction) Exec() (res *ClientResponse) {
 		}
 	}
 
-	return &ClientResponse{
+	return page.respond(&a.PageParams, &ClientResponse{
 		Type:      a.SuccessType(),
 		RequestId: a.RequestId,
 		Schema:    "URL_ARRAY",
 		Id:        a.Id,
-		Page:      a.Page,
-		PageSize:  a.PageSize,
 		Data:      urls,
-	}
+	})
 }
 
-// FetchConsensusAction fetches a url from the DB
+// FetchConsensusAction reaches consensus on metadata for a subject. Strategy
+// & its options are optional, defaulting to the settings of the primer the
+// subject belongs to
 type FetchConsensusAction struct {
 	ReqAction
+	ConsensusOptions
 	Subject string
 }
 
@@ -736,27 +919,7 @@ func (FetchConsensusAction) Parse(reqId string, data json.RawMessage) ClientRequ
 }
 
 func (a *FetchConsensusAction) Exec() (res *ClientResponse) {
-	blocks, err := core.MetadataBySubject(appDB, a.Subject)
-	if err != nil {
-		log.Info(err.Error())
-		return &ClientResponse{
-			Type:      a.FailureType(),
-			RequestId: a.RequestId,
-			Error:     err.Error(),
-		}
-	}
-
-	c, values, err := core.SumConsensus(a.Subject, blocks)
-	if err != nil {
-		log.Info(err.Error())
-		return &ClientResponse{
-			Type:      a.FailureType(),
-			RequestId: a.RequestId,
-			Error:     err.Error(),
-		}
-	}
-
-	md, err := c.Metadata(values)
+	c, err := ResolveConsensus(appDB, a.Subject, a.ConsensusOptions)
 	if err != nil {
 		log.Info(err.Error())
 		return &ClientResponse{
@@ -770,18 +933,14 @@ func (a *FetchConsensusAction) Exec() (res *ClientResponse) {
 		Type:      a.SuccessType(),
 		Schema:    "CONSENSUS",
 		RequestId: a.RequestId,
-		Data: map[string]interface{}{
-			"subject": a.Subject,
-			"data":    md,
-		},
+		Data:      c,
 	}
 }
 
 // FetchCollectionsAction grabs a page of collections
 type FetchCollectionsAction struct {
 	ReqAction
-	Page     int
-	PageSize int
+	PageParams
 }
 
 func (FetchCollectionsAction) Type() string        { return "COLLECTIONS_FETCH_REQUEST" }
@@ -796,7 +955,7 @@ func (FetchCollectionsAction) Parse(reqId string, data json.RawMessage) ClientRe
 }
 
 func (a *FetchCollectionsAction) Exec() (res *ClientResponse) {
-	collections, err := core.ListCollections(store, 50, 0)
+	collections, page, err := ListCollectionsPage(appDB, &a.PageParams)
 	if err != nil {
 		log.Info(err.Error())
 		return &ClientResponse{
@@ -806,20 +965,20 @@ func (a *FetchCollectionsAction) Exec() (res *ClientResponse) {
 		}
 	}
 
-	return &ClientResponse{
+	return page.respond(&a.PageParams, &ClientResponse{
 		Type:      a.SuccessType(),
 		RequestId: a.RequestId,
 		Schema:    "COLLECTION_ARRAY",
 		Data:      collections,
-	}
+	})
 }
 
-// UserCollectionsAction grabs a page of a user's collections
+// UserCollectionsAction grabs a page of a user's collections. unlisted &
+// private collections are only included for the user themselves
 type UserCollectionsAction struct {
 	ReqAction
-	Creator  string
-	Page     int
-	PageSize int
+	PageParams
+	Creator string
 }
 
 func (UserCollectionsAction) Type() string        { return "USER_COLLECTIONS_REQUEST" }
@@ -834,7 +993,8 @@ func (UserCollectionsAction) Parse(reqId string, data json.RawMessage) ClientReq
 }
 
 func (a *UserCollectionsAction) Exec() (res *ClientResponse) {
-	collections, err := core.CollectionsByCreator(store, a.Creator, "created DESC", a.PageSize, (a.Page-1)*a.PageSize)
+	keyId := a.client.keyId()
+	collections, page, err := ListCreatorCollectionsPage(appDB, a.Creator, keyId != "" && keyId == a.Creator, &a.PageParams)
 	if err != nil {
 		log.Info(err.Error())
 		return &ClientResponse{
@@ -844,12 +1004,12 @@ func (a *UserCollectionsAction) Exec() (res *ClientResponse) {
 		}
 	}
 
-	return &ClientResponse{
+	return page.respond(&a.PageParams, &ClientResponse{
 		Type:      a.SuccessType(),
 		RequestId: a.RequestId,
 		Schema:    "COLLECTION_ARRAY",
 		Data:      collections,
-	}
+	})
 }
 
 // FetchCollectionAction grabs a page of collections
@@ -870,8 +1030,8 @@ func (FetchCollectionAction) Parse(reqId string, data json.RawMessage) ClientReq
 }
 
 func (a *FetchCollectionAction) Exec() (res *ClientResponse) {
-	c := &core.Collection{Id: a.Id}
-	if err := c.Read(store); err != nil {
+	c, err := a.read()
+	if err != nil {
 		log.Info(err.Error())
 		return &ClientResponse{
 			Type:      a.FailureType(),
@@ -888,6 +1048,14 @@ func (a *FetchCollectionAction) Exec() (res *ClientResponse) {
 	}
 }
 
+func (a *FetchCollectionAction) read() (*core.Collection, error) {
+	if err := requireCollectionRole(appDB, a.Id, a.client.keyId(), CollectionRoleViewer); err != nil {
+		return nil, err
+	}
+	c := &core.Collection{Id: a.Id}
+	return c, c.Read(store)
+}
+
 // SaveCollectionAction triggers archiving a url
 type SaveCollectionAction struct {
 	ReqAction
@@ -907,7 +1075,7 @@ func (SaveCollectionAction) Parse(reqId string, data json.RawMessage) ClientRequ
 
 func (a *SaveCollectionAction) Exec() (res *ClientResponse) {
 	log.Info(a.Collection)
-	if err := a.Collection.Save(store); err != nil {
+	if err := a.save(); err != nil {
 		log.Info(err.Error())
 		return &ClientResponse{
 			Type:      a.FailureType(),
@@ -924,6 +1092,33 @@ func (a *SaveCollectionAction) Exec() (res *ClientResponse) {
 	}
 }
 
+// save creates or updates the collection. changing an existing collection
+// requires an editor role & keeps its creator. new collections are created
+// by the current user if logged in
+func (a *SaveCollectionAction) save() error {
+	if a.Collection == nil {
+		return fmt.Errorf("collection is required")
+	}
+	keyId := a.client.keyId()
+	if a.Collection.Id != "" {
+		access, err := ReadCollectionAccess(appDB, a.Collection.Id, keyId)
+		if err != nil && err != core.ErrNotFound {
+			return err
+		}
+		if access != nil {
+			if err := access.require(CollectionRoleEditor); err != nil {
+				return err
+			}
+			a.Collection.Creator = access.Creator
+			return SaveCollection(appDB, a.Collection, keyId)
+		}
+	}
+	if keyId != "" {
+		a.Collection.Creator = keyId
+	}
+	return SaveCollection(appDB, a.Collection, keyId)
+}
+
 // DeleteCollectionAction triggers archiving a url
 type DeleteCollectionAction struct {
 	ReqAction
@@ -944,7 +1139,7 @@ func (DeleteCollectionAction) Parse(reqId string, data json.RawMessage) ClientRe
 
 func (a *DeleteCollectionAction) Exec() (res *ClientResponse) {
 	c := &core.Collection{Id: a.Id}
-	if err := c.Delete(store); err != nil {
+	if err := a.delete(c); err != nil {
 		log.Info(err.Error())
 		return &ClientResponse{
 			Type:      a.FailureType(),
@@ -961,12 +1156,26 @@ func (a *DeleteCollectionAction) Exec() (res *ClientResponse) {
 	}
 }
 
+// delete removes the collection & its collaborators. only owners can delete
+// a collection
+func (a *DeleteCollectionAction) delete(c *core.Collection) error {
+	if err := requireCollectionRole(appDB, c.Id, a.client.keyId(), CollectionRoleOwner); err != nil {
+		return err
+	}
+	if err := c.Delete(store); err != nil {
+		return err
+	}
+	if _, err := appDB.Exec(qCollectionCollaboratorsClear, c.Id); err != nil {
+		log.Infof("error removing collaborators of deleted collection %s: %s", c.Id, err.Error())
+	}
+	return nil
+}
+
 // CollectionItemsAction grabs a page of collection items
 type CollectionItemsAction struct {
 	ReqAction
+	PageParams
 	CollectionId string
-	Page         int
-	PageSize     int
 }
 
 func (CollectionItemsAction) Type() string        { return "COLLECTION_ITEMS_REQUEST" }
@@ -981,9 +1190,7 @@ func (CollectionItemsAction) Parse(reqId string, data json.RawMessage) ClientReq
 }
 
 func (a *CollectionItemsAction) Exec() (res *ClientResponse) {
-	c := core.Collection{Id: a.CollectionId}
-
-	items, err := c.ReadItems(store, "created DESC", a.PageSize, (a.Page-1)*a.PageSize)
+	items, page, err := a.read()
 	if err != nil {
 		log.Info(err.Error())
 		return &ClientResponse{
@@ -993,15 +1200,20 @@ func (a *CollectionItemsAction) Exec() (res *ClientResponse) {
 		}
 	}
 
-	return &ClientResponse{
+	return page.respond(&a.PageParams, &ClientResponse{
 		Type:      a.SuccessType(),
 		RequestId: a.RequestId,
 		Schema:    "COLLECTION_ITEM_ARRAY",
 		Data:      items,
 		Id:        a.CollectionId,
-		Page:      a.Page,
-		PageSize:  a.PageSize,
+	})
+}
+
+func (a *CollectionItemsAction) read() ([]*core.CollectionItem, *Page, error) {
+	if err := requireCollectionRole(appDB, a.CollectionId, a.client.keyId(), CollectionRoleViewer); err != nil {
+		return nil, nil, err
 	}
+	return ListCollectionItemsPage(appDB, a.CollectionId, &a.PageParams)
 }
 
 // SaveCollectionItemsAction grabs a page of collection items
@@ -1023,8 +1235,30 @@ func (SaveCollectionItemsAction) Parse(reqId string, data json.RawMessage) Clien
 }
 
 func (a *SaveCollectionItemsAction) Exec() (res *ClientResponse) {
+	if err := requireCollectionRole(appDB, a.CollectionId, a.client.keyId(), CollectionRoleEditor); err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+	if err := ValidateCollectionItems(appDB, a.CollectionId, a.Items); err != nil {
+		log.Info(err.Error())
+		res = &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+		if verr, ok := err.(ValidationError); ok {
+			res.Schema = "SCHEMA_ERROR_ARRAY"
+			res.Data = verr
+		}
+		return res
+	}
+
 	c := core.Collection{Id: a.CollectionId}
-	if err := c.SaveItems(store, a.Items); err != nil {
+	if err := SaveCollectionItems(appDB, c.Id, a.client.keyId(), a.Items); err != nil {
 		log.Info(err.Error())
 		return &ClientResponse{
 			Type:      a.FailureType(),
@@ -1066,7 +1300,15 @@ func (DeleteCollectionItemsAction) Parse(reqId string, data json.RawMessage) Cli
 
 func (a *DeleteCollectionItemsAction) Exec() (res *ClientResponse) {
 	c := core.Collection{Id: a.CollectionId}
-	if err := c.DeleteItems(store, a.Items); err != nil {
+	if err := requireCollectionRole(appDB, c.Id, a.client.keyId(), CollectionRoleEditor); err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+	if err := DeleteCollectionItems(appDB, c.Id, a.client.keyId(), a.Items); err != nil {
 		log.Info(err.Error())
 		return &ClientResponse{
 			Type:      a.FailureType(),
@@ -1091,9 +1333,8 @@ func (a *DeleteCollectionItemsAction) Exec() (res *ClientResponse) {
 // MetadataByKeyRequest triggers archiving a url
 type MetadataByKeyRequest struct {
 	ReqAction
-	Key      string `json:"key"`
-	Page     int    `json:"page"`
-	PageSize int    `json:"pageSize"`
+	PageParams
+	Key string `json:"key"`
 }
 
 func (MetadataByKeyRequest) Type() string        { return "METADATA_BY_KEY_REQUEST" }
@@ -1108,7 +1349,7 @@ func (MetadataByKeyRequest) Parse(reqId string, data json.RawMessage) ClientRequ
 }
 
 func (a *MetadataByKeyRequest) Exec() (res *ClientResponse) {
-	results, err := core.MetadataByKey(appDB, a.Key, a.PageSize, (a.Page-1)*a.PageSize)
+	results, page, err := ListKeyMetadataPage(appDB, a.Key, &a.PageParams)
 	if err != nil {
 		log.Info(err.Error())
 		return &ClientResponse{
@@ -1118,10 +1359,10 @@ func (a *MetadataByKeyRequest) Exec() (res *ClientResponse) {
 		}
 	}
 
-	return &ClientResponse{
+	return page.respond(&a.PageParams, &ClientResponse{
 		Type:      a.SuccessType(),
 		RequestId: a.RequestId,
 		Schema:    "METADATA_ARRAY",
 		Data:      results,
-	}
+	})
 }
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/datatogether/core"
+	"github.com/datatogether/sql_datastore"
+	"github.com/pborman/uuid"
+)
+
+// isAdmin reports whether keyId is configured as an admin key
+func isAdmin(keyId string) bool {
+	if keyId == "" || cfg == nil {
+		return false
+	}
+	for _, k := range cfg.AdminKeys {
+		if k == keyId {
+			return true
+		}
+	}
+	return false
+}
+
+// requireAdmin errors if keyId isn't an admin key
+func requireAdmin(keyId string) error {
+	if keyId == "" {
+		return fmt.Errorf("you must be logged in to do that")
+	}
+	if !isAdmin(keyId) {
+		return fmt.Errorf("only admins can do that")
+	}
+	return nil
+}
+
+// adminSessionUser reads the session user of an http request, erroring
+// unless they're logged in with an admin key. the returned status code is
+// the one to respond with on error
+func adminSessionUser(r *http.Request) (*User, int, error) {
+	user, err := SessionUser(r)
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("error reading session: %s", err.Error())
+	}
+	if user == nil {
+		return nil, http.StatusUnauthorized, fmt.Errorf("you must be logged in to do that")
+	}
+	if err := requireAdmin(user.CurrentKey); err != nil {
+		return nil, http.StatusForbidden, err
+	}
+	return user, http.StatusOK, nil
+}
+
+// primerParentId gives the id of a primer's parent, "" for none
+func primerParentId(p *core.Primer) string {
+	if p == nil || p.Parent == nil {
+		return ""
+	}
+	return p.Parent.Id
+}
+
+// sourcePrimerId gives the id of a source's primer, "" for none
+func sourcePrimerId(s *core.Source) string {
+	if s == nil || s.Primer == nil {
+		return ""
+	}
+	return s.Primer.Id
+}
+
+// checkPrimerParent errors if making parentId the parent of id would make a
+// primer its own ancestor. parentOf gives the parent of a primer, "" for none
+func checkPrimerParent(id, parentId string, parentOf func(id string) (string, error)) error {
+	seen := map[string]bool{}
+	for cur := parentId; cur != ""; {
+		if cur == id {
+			return fmt.Errorf("a primer can't be its own ancestor")
+		}
+		if seen[cur] {
+			return fmt.Errorf("primer %s has a cyclic parent chain", cur)
+		}
+		seen[cur] = true
+
+		next, err := parentOf(cur)
+		if err != nil {
+			return err
+		}
+		cur = next
+	}
+	return nil
+}
+
+// readPrimerParentId reads the parent id of a primer that hasn't been deleted
+func readPrimerParentId(db sqlQueryable, id string) (string, error) {
+	var parentId string
+	if err := db.QueryRow(qPrimerParentId, id).Scan(&parentId); err != nil {
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("primer %s not found", id)
+		}
+		return "", err
+	}
+	return parentId, nil
+}
+
+// putModel inserts or updates a core model with core's own queries, so it
+// can be written in the same transaction as its audit entry
+func putModel(tx sqlExecable, m sql_datastore.Model, exists bool) error {
+	cmd := sql_datastore.CmdInsertOne
+	if exists {
+		cmd = sql_datastore.CmdUpdateOne
+	}
+	_, err := tx.Exec(m.SQLQuery(cmd), m.SQLParams(cmd)...)
+	return err
+}
+
+// SavePrimer creates a primer or updates the titles, description & meta of
+// an existing one as keyId. new primers may set a parent, existing primers
+// are moved with ReparentPrimer
+func SavePrimer(db *sql.DB, keyId string, p *core.Primer) (*core.Primer, error) {
+	if p == nil {
+		return nil, fmt.Errorf("primer is required")
+	}
+	if p.Title == "" {
+		return nil, fmt.Errorf("title is required")
+	}
+
+	var (
+		prev   *core.Primer
+		action = AuditCreate
+		next   = &core.Primer{}
+	)
+	if p.Id != "" {
+		prev = &core.Primer{Id: p.Id}
+		if err := prev.Read(store); err != nil {
+			return nil, err
+		}
+		*next = *prev
+		next.ShortTitle = p.ShortTitle
+		next.Title = p.Title
+		next.Description = p.Description
+		if p.Meta != nil {
+			next.Meta = p.Meta
+		}
+		action = AuditUpdate
+	} else {
+		if parentId := primerParentId(p); parentId != "" {
+			if _, err := readPrimerParentId(db, parentId); err != nil {
+				return nil, err
+			}
+			next.Parent = &core.Primer{Id: parentId}
+		}
+		next.ShortTitle = p.ShortTitle
+		next.Title = p.Title
+		next.Description = p.Description
+		next.Meta = p.Meta
+		next.Id = uuid.New()
+		next.Created = time.Now().Round(time.Second).In(time.UTC)
+	}
+	next.Created = next.Created.In(time.UTC)
+	next.Updated = time.Now().Round(time.Second).In(time.UTC)
+
+	var prevState interface{}
+	if prev != nil {
+		prevState = prev
+	}
+	e, err := NewAuditEntry(keyId, action, "PRIMER", next.Id, prevState, next)
+	if err != nil {
+		return nil, err
+	}
+	err = withTx(db, func(tx sqlQueryExecable) error {
+		if err := putModel(tx, next, prev != nil); err != nil {
+			return err
+		}
+		return e.Insert(tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	e.publish(primerParentId(next))
+	return next, nil
+}
+
+// DeletePrimer soft-deletes a primer as keyId. primers with sub-primers or
+// sources must have them deleted or re-parented first
+func DeletePrimer(db *sql.DB, keyId, id string) (*core.Primer, error) {
+	p := &core.Primer{Id: id}
+	if err := p.Read(store); err != nil {
+		return nil, err
+	}
+
+	e, err := NewAuditEntry(keyId, AuditDelete, "PRIMER", p.Id, p, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = withTx(db, func(tx sqlQueryExecable) error {
+		var subprimers, sources int
+		if err := tx.QueryRow(qPrimerDependents, p.Id).Scan(&subprimers, &sources); err != nil {
+			return err
+		}
+		if subprimers > 0 || sources > 0 {
+			return fmt.Errorf("primer has %d sub-primers & %d sources, delete or re-parent them first", subprimers, sources)
+		}
+		if _, err := tx.Exec(qPrimerSoftDelete, p.Id, e.Created); err != nil {
+			return err
+		}
+		return e.Insert(tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	e.publish(primerParentId(p))
+	return p, nil
+}
+
+// ReparentPrimer moves a primer under parentId as keyId. an empty parentId
+// makes it a base primer
+func ReparentPrimer(db *sql.DB, keyId, id, parentId string) (*core.Primer, error) {
+	prev := &core.Primer{Id: id}
+	if err := prev.Read(store); err != nil {
+		return nil, err
+	}
+
+	next := *prev
+	next.Parent = nil
+	if parentId != "" {
+		next.Parent = &core.Primer{Id: parentId}
+	}
+	next.Updated = time.Now().Round(time.Second).In(time.UTC)
+
+	e, err := NewAuditEntry(keyId, AuditReparent, "PRIMER", id, prev, &next)
+	if err != nil {
+		return nil, err
+	}
+	err = withTx(db, func(tx sqlQueryExecable) error {
+		// serialize re-parenting so concurrent moves can't combine into a cycle
+		if _, err := tx.Exec(qPrimerParentsLock); err != nil {
+			return err
+		}
+		err := checkPrimerParent(id, parentId, func(id string) (string, error) {
+			return readPrimerParentId(tx, id)
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(qPrimerSetParent, id, parentId, next.Updated); err != nil {
+			return err
+		}
+		return e.Insert(tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	e.publish(primerParentId(prev), parentId)
+	return &next, nil
+}
+
+// validSourceUrl checks a source url is an absolute http(s) url
+func validSourceUrl(rawurl string) error {
+	if rawurl == "" {
+		return fmt.Errorf("url is required")
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return fmt.Errorf("invalid url: %s", err.Error())
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https url")
+	}
+	return nil
+}
+
+// SaveSource creates a source or updates the title, description, url, crawl
+// flag, stale duration & meta of an existing one as keyId. new sources must
+// belong to a primer, existing sources are moved with ReparentSource
+func SaveSource(db *sql.DB, keyId string, s *core.Source) (*core.Source, error) {
+	if s == nil {
+		return nil, fmt.Errorf("source is required")
+	}
+	if err := validSourceUrl(s.Url); err != nil {
+		return nil, err
+	}
+	if s.StaleDuration < 0 {
+		return nil, fmt.Errorf("staleDuration can't be negative")
+	}
+
+	var (
+		prev   *core.Source
+		action = AuditCreate
+		next   = &core.Source{}
+	)
+	if s.Id != "" {
+		prev = &core.Source{Id: s.Id}
+		if err := prev.Read(store); err != nil {
+			return nil, err
+		}
+		*next = *prev
+		if s.Meta != nil {
+			next.Meta = s.Meta
+		}
+		action = AuditUpdate
+	} else {
+		primerId := sourcePrimerId(s)
+		if primerId == "" {
+			return nil, fmt.Errorf("primer is required")
+		}
+		if _, err := readPrimerParentId(db, primerId); err != nil {
+			return nil, err
+		}
+		next.Primer = &core.Primer{Id: primerId}
+		next.Meta = s.Meta
+	}
+	next.Title = s.Title
+	next.Description = s.Description
+	next.Url = s.Url
+	next.Crawl = s.Crawl
+	next.StaleDuration = s.StaleDuration
+	if prev == nil {
+		next.Id = uuid.New()
+		next.Created = time.Now().Round(time.Second).In(time.UTC)
+	}
+	next.Created = next.Created.In(time.UTC)
+	next.Updated = time.Now().Round(time.Second).In(time.UTC)
+
+	var prevState interface{}
+	if prev != nil {
+		prevState = prev
+	}
+	e, err := NewAuditEntry(keyId, action, "SOURCE", next.Id, prevState, next)
+	if err != nil {
+		return nil, err
+	}
+	err = withTx(db, func(tx sqlQueryExecable) error {
+		if err := checkSourceUrl(tx, next); err != nil {
+			return err
+		}
+		if err := putModel(tx, next, prev != nil); err != nil {
+			return err
+		}
+		return e.Insert(tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	e.publish(sourcePrimerId(next))
+	return next, nil
+}
+
+// checkSourceUrl confirms no other source has s's url. urls identify sources
+// & are unique across all rows, so deleted sources keep their url
+func checkSourceUrl(db sqlQueryable, s *core.Source) error {
+	var (
+		id      string
+		deleted bool
+	)
+	err := db.QueryRow(qSourceByUrlAll, s.Url).Scan(&id, &deleted)
+	if err == sql.ErrNoRows || (err == nil && id == s.Id) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if deleted {
+		return fmt.Errorf("deleted source %s already has the url %s", id, s.Url)
+	}
+	return fmt.Errorf("source %s already has the url %s", id, s.Url)
+}
+
+// DeleteSource soft-deletes a source as keyId
+func DeleteSource(db *sql.DB, keyId, id string) (*core.Source, error) {
+	s := &core.Source{Id: id}
+	if err := s.Read(store); err != nil {
+		return nil, err
+	}
+
+	e, err := NewAuditEntry(keyId, AuditDelete, "SOURCE", s.Id, s, nil)
+	if err != nil {
+		return nil, err
+	}
+	// core's source delete matches on url, so delete by id here
+	err = withTx(db, func(tx sqlQueryExecable) error {
+		if _, err := tx.Exec(qSourceSoftDelete, s.Id, e.Created); err != nil {
+			return err
+		}
+		return e.Insert(tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	e.publish(sourcePrimerId(s))
+	return s, nil
+}
+
+// ReparentSource moves a source to primerId as keyId
+func ReparentSource(db *sql.DB, keyId, id, primerId string) (*core.Source, error) {
+	if primerId == "" {
+		return nil, fmt.Errorf("primerId is required")
+	}
+	prev := &core.Source{Id: id}
+	if err := prev.Read(store); err != nil {
+		return nil, err
+	}
+
+	next := *prev
+	next.Primer = &core.Primer{Id: primerId}
+	next.Updated = time.Now().Round(time.Second).In(time.UTC)
+
+	e, err := NewAuditEntry(keyId, AuditReparent, "SOURCE", id, prev, &next)
+	if err != nil {
+		return nil, err
+	}
+	err = withTx(db, func(tx sqlQueryExecable) error {
+		if _, err := readPrimerParentId(tx, primerId); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(qSourceSetPrimer, id, primerId, next.Updated); err != nil {
+			return err
+		}
+		return e.Insert(tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	e.publish(sourcePrimerId(prev), primerId)
+	return &next, nil
+}
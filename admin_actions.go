@@ -0,0 +1,326 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/datatogether/core"
+)
+
+// SavePrimerAct creates or updates a primer. only admins can change primers
+type SavePrimerAct struct {
+	ReqAction
+	Primer *core.Primer `json:"primer"`
+}
+
+func (SavePrimerAct) Type() string        { return "PRIMER_SAVE_REQUEST" }
+func (SavePrimerAct) SuccessType() string { return "PRIMER_SAVE_SUCCESS" }
+func (SavePrimerAct) FailureType() string { return "PRIMER_SAVE_FAILURE" }
+
+func (SavePrimerAct) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &SavePrimerAct{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *SavePrimerAct) Exec() (res *ClientResponse) {
+	p, err := a.run()
+	if err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "PRIMER",
+		Id:        p.Id,
+		Data:      p,
+	}
+}
+
+func (a *SavePrimerAct) run() (*core.Primer, error) {
+	keyId := a.client.keyId()
+	if err := requireAdmin(keyId); err != nil {
+		return nil, err
+	}
+	return SavePrimer(appDB, keyId, a.Primer)
+}
+
+// DeletePrimerAct soft-deletes a primer without sub-primers or sources
+type DeletePrimerAct struct {
+	ReqAction
+	Id string `json:"id"`
+}
+
+func (DeletePrimerAct) Type() string        { return "PRIMER_DELETE_REQUEST" }
+func (DeletePrimerAct) SuccessType() string { return "PRIMER_DELETE_SUCCESS" }
+func (DeletePrimerAct) FailureType() string { return "PRIMER_DELETE_FAILURE" }
+
+func (DeletePrimerAct) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &DeletePrimerAct{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *DeletePrimerAct) Exec() (res *ClientResponse) {
+	p, err := a.run()
+	if err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "PRIMER",
+		Id:        p.Id,
+		Data:      p,
+	}
+}
+
+func (a *DeletePrimerAct) run() (*core.Primer, error) {
+	keyId := a.client.keyId()
+	if err := requireAdmin(keyId); err != nil {
+		return nil, err
+	}
+	return DeletePrimer(appDB, keyId, a.Id)
+}
+
+// ReparentPrimerAct moves a primer under another primer, or to the top level if
+// ParentId is empty
+type ReparentPrimerAct struct {
+	ReqAction
+	Id       string `json:"id"`
+	ParentId string `json:"parentId"`
+}
+
+func (ReparentPrimerAct) Type() string        { return "PRIMER_REPARENT_REQUEST" }
+func (ReparentPrimerAct) SuccessType() string { return "PRIMER_REPARENT_SUCCESS" }
+func (ReparentPrimerAct) FailureType() string { return "PRIMER_REPARENT_FAILURE" }
+
+func (ReparentPrimerAct) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &ReparentPrimerAct{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *ReparentPrimerAct) Exec() (res *ClientResponse) {
+	p, err := a.run()
+	if err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "PRIMER",
+		Id:        p.Id,
+		Data:      p,
+	}
+}
+
+func (a *ReparentPrimerAct) run() (*core.Primer, error) {
+	keyId := a.client.keyId()
+	if err := requireAdmin(keyId); err != nil {
+		return nil, err
+	}
+	return ReparentPrimer(appDB, keyId, a.Id, a.ParentId)
+}
+
+// SaveSourceAct creates or updates a source. only admins can change sources
+type SaveSourceAct struct {
+	ReqAction
+	Source *core.Source `json:"source"`
+}
+
+func (SaveSourceAct) Type() string        { return "SOURCE_SAVE_REQUEST" }
+func (SaveSourceAct) SuccessType() string { return "SOURCE_SAVE_SUCCESS" }
+func (SaveSourceAct) FailureType() string { return "SOURCE_SAVE_FAILURE" }
+
+func (SaveSourceAct) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &SaveSourceAct{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *SaveSourceAct) Exec() (res *ClientResponse) {
+	s, err := a.run()
+	if err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "SOURCE",
+		Id:        s.Id,
+		Data:      s,
+	}
+}
+
+func (a *SaveSourceAct) run() (*core.Source, error) {
+	keyId := a.client.keyId()
+	if err := requireAdmin(keyId); err != nil {
+		return nil, err
+	}
+	return SaveSource(appDB, keyId, a.Source)
+}
+
+// DeleteSourceAct soft-deletes a source
+type DeleteSourceAct struct {
+	ReqAction
+	Id string `json:"id"`
+}
+
+func (DeleteSourceAct) Type() string        { return "SOURCE_DELETE_REQUEST" }
+func (DeleteSourceAct) SuccessType() string { return "SOURCE_DELETE_SUCCESS" }
+func (DeleteSourceAct) FailureType() string { return "SOURCE_DELETE_FAILURE" }
+
+func (DeleteSourceAct) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &DeleteSourceAct{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *DeleteSourceAct) Exec() (res *ClientResponse) {
+	s, err := a.run()
+	if err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "SOURCE",
+		Id:        s.Id,
+		Data:      s,
+	}
+}
+
+func (a *DeleteSourceAct) run() (*core.Source, error) {
+	keyId := a.client.keyId()
+	if err := requireAdmin(keyId); err != nil {
+		return nil, err
+	}
+	return DeleteSource(appDB, keyId, a.Id)
+}
+
+// ReparentSourceAct moves a source to another primer
+type ReparentSourceAct struct {
+	ReqAction
+	Id       string `json:"id"`
+	PrimerId string `json:"primerId"`
+}
+
+func (ReparentSourceAct) Type() string        { return "SOURCE_REPARENT_REQUEST" }
+func (ReparentSourceAct) SuccessType() string { return "SOURCE_REPARENT_SUCCESS" }
+func (ReparentSourceAct) FailureType() string { return "SOURCE_REPARENT_FAILURE" }
+
+func (ReparentSourceAct) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &ReparentSourceAct{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *ReparentSourceAct) Exec() (res *ClientResponse) {
+	s, err := a.run()
+	if err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "SOURCE",
+		Id:        s.Id,
+		Data:      s,
+	}
+}
+
+func (a *ReparentSourceAct) run() (*core.Source, error) {
+	keyId := a.client.keyId()
+	if err := requireAdmin(keyId); err != nil {
+		return nil, err
+	}
+	return ReparentSource(appDB, keyId, a.Id, a.PrimerId)
+}
+
+// AuditLogAct grabs a page of the audit log, optionally only the entries
+// for one primer or source. only admins can read the audit log
+type AuditLogAct struct {
+	ReqAction
+	PageParams
+	SubjectId string `json:"subjectId"`
+}
+
+func (AuditLogAct) Type() string        { return "AUDIT_LOG_REQUEST" }
+func (AuditLogAct) SuccessType() string { return "AUDIT_LOG_SUCCESS" }
+func (AuditLogAct) FailureType() string { return "AUDIT_LOG_FAILURE" }
+
+func (AuditLogAct) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &AuditLogAct{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *AuditLogAct) Exec() (res *ClientResponse) {
+	entries, page, err := a.read()
+	if err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return page.respond(&a.PageParams, &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "AUDIT_ENTRY_ARRAY",
+		Id:        a.SubjectId,
+		Data:      entries,
+	})
+}
+
+func (a *AuditLogAct) read() ([]*AuditEntry, *Page, error) {
+	if err := requireAdmin(a.client.keyId()); err != nil {
+		return nil, nil, err
+	}
+	return ListAuditLogPage(appDB, a.SubjectId, &a.PageParams)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCheckPrimerParent(t *testing.T) {
+	// c's parent is b, b's parent is a
+	parents := map[string]string{"a": "", "b": "a", "c": "b", "x": "y", "y": "x"}
+	parentOf := func(id string) (string, error) {
+		p, ok := parents[id]
+		if !ok {
+			return "", fmt.Errorf("primer %s not found", id)
+		}
+		return p, nil
+	}
+
+	cases := []struct {
+		id, parentId string
+		err          bool
+	}{
+		{"c", "", false},
+		{"c", "a", false},
+		{"d", "c", false},
+		{"a", "c", true},
+		{"a", "a", true},
+		{"b", "c", true},
+		{"a", "missing", true},
+		{"a", "x", true},
+	}
+
+	for i, c := range cases {
+		err := checkPrimerParent(c.id, c.parentId, parentOf)
+		if (err != nil) != c.err {
+			t.Errorf("case %d error mismatch. expected error: %t, got: %v", i, c.err, err)
+		}
+	}
+}
+
+func TestValidSourceUrl(t *testing.T) {
+	cases := []struct {
+		url string
+		err bool
+	}{
+		{"https://www.epa.gov", false},
+		{"http://www.epa.gov/climate", false},
+		{"", true},
+		{"www.epa.gov", true},
+		{"ftp://www.epa.gov", true},
+		{"https://", true},
+	}
+
+	for i, c := range cases {
+		if err := validSourceUrl(c.url); (err != nil) != c.err {
+			t.Errorf("case %d error mismatch. expected error: %t, got: %v", i, c.err, err)
+		}
+	}
+}
+
+func TestIsAdmin(t *testing.T) {
+	prev := cfg
+	defer func() { cfg = prev }()
+
+	cfg = &config{AdminKeys: []string{"admin"}}
+	if !isAdmin("admin") {
+		t.Errorf("expected admin key to be an admin")
+	}
+	if isAdmin("other") || isAdmin("") {
+		t.Errorf("expected only configured keys to be admins")
+	}
+	if err := requireAdmin(""); err == nil {
+		t.Errorf("expected anonymous users to be denied")
+	}
+}
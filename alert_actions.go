@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AlertsAct grabs a page of open or dismissed alerts, optionally only the
+// alerts for one source
+type AlertsAct struct {
+	ReqAction
+	PageParams
+	Dismissed bool   `json:"dismissed"`
+	SourceId  string `json:"sourceId"`
+}
+
+func (AlertsAct) Type() string        { return "ALERTS_REQUEST" }
+func (AlertsAct) SuccessType() string { return "ALERTS_SUCCESS" }
+func (AlertsAct) FailureType() string { return "ALERTS_FAILURE" }
+
+func (AlertsAct) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &AlertsAct{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *AlertsAct) Exec() (res *ClientResponse) {
+	alerts, page, err := ListAlertsPage(appDB, a.Dismissed, a.SourceId, &a.PageParams)
+	if err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return page.respond(&a.PageParams, &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "ALERT_ARRAY",
+		Id:        a.SourceId,
+		Data:      alerts,
+	})
+}
+
+// DismissAlertAct closes an open alert. only admins can dismiss alerts
+type DismissAlertAct struct {
+	ReqAction
+	Id string `json:"id"`
+}
+
+func (DismissAlertAct) Type() string        { return "ALERT_DISMISS_REQUEST" }
+func (DismissAlertAct) SuccessType() string { return "ALERT_DISMISS_SUCCESS" }
+func (DismissAlertAct) FailureType() string { return "ALERT_DISMISS_FAILURE" }
+
+func (DismissAlertAct) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &DismissAlertAct{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *DismissAlertAct) Exec() (res *ClientResponse) {
+	alert, err := a.run()
+	if err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "ALERT",
+		Id:        alert.Id,
+		Data:      alert,
+	}
+}
+
+func (a *DismissAlertAct) run() (*Alert, error) {
+	keyId := a.client.keyId()
+	if err := requireAdmin(keyId); err != nil {
+		return nil, err
+	}
+	return DismissAlert(appDB, a.Id, keyId)
+}
+
+// SuppressAlertsAct stops alerts for a source until a time, or indefinitely
+// if Until is omitted. open alerts for the source are dismissed. only admins
+// can suppress alerts
+type SuppressAlertsAct struct {
+	ReqAction
+	SourceId string     `json:"sourceId"`
+	Until    *time.Time `json:"until"`
+}
+
+func (SuppressAlertsAct) Type() string        { return "ALERT_SUPPRESS_REQUEST" }
+func (SuppressAlertsAct) SuccessType() string { return "ALERT_SUPPRESS_SUCCESS" }
+func (SuppressAlertsAct) FailureType() string { return "ALERT_SUPPRESS_FAILURE" }
+
+func (SuppressAlertsAct) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &SuppressAlertsAct{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *SuppressAlertsAct) Exec() (res *ClientResponse) {
+	s, err := a.run()
+	if err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "ALERT_SUPPRESSION",
+		Id:        s.SourceId,
+		Data:      s,
+	}
+}
+
+func (a *SuppressAlertsAct) run() (*AlertSuppression, error) {
+	keyId := a.client.keyId()
+	if err := requireAdmin(keyId); err != nil {
+		return nil, err
+	}
+	return SuppressAlerts(appDB, a.SourceId, keyId, a.Until)
+}
+
+// UnsuppressAlertsAct lets alerts be created for a suppressed source again.
+// only admins can unsuppress alerts
+type UnsuppressAlertsAct struct {
+	ReqAction
+	SourceId string `json:"sourceId"`
+}
+
+func (UnsuppressAlertsAct) Type() string        { return "ALERT_UNSUPPRESS_REQUEST" }
+func (UnsuppressAlertsAct) SuccessType() string { return "ALERT_UNSUPPRESS_SUCCESS" }
+func (UnsuppressAlertsAct) FailureType() string { return "ALERT_UNSUPPRESS_FAILURE" }
+
+func (UnsuppressAlertsAct) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &UnsuppressAlertsAct{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *UnsuppressAlertsAct) Exec() (res *ClientResponse) {
+	if err := a.run(); err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "ALERT_SUPPRESSION",
+		Id:        a.SourceId,
+		Data:      &AlertSuppression{SourceId: a.SourceId},
+	}
+}
+
+func (a *UnsuppressAlertsAct) run() error {
+	if err := requireAdmin(a.client.keyId()); err != nil {
+		return err
+	}
+	return UnsuppressAlerts(appDB, a.SourceId)
+}
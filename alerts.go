@@ -0,0 +1,318 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/datatogether/core"
+	"github.com/pborman/uuid"
+)
+
+// AlertsTopic is the subscription topic every new alert is published to
+const AlertsTopic = "ALERTS"
+
+// alert monitor defaults
+const (
+	// how often to check for stale sources
+	alertsCheckInterval = 15 * time.Minute
+	// max number of alerts created per check
+	alertsCheckLimit = 100
+)
+
+// alertMonitor is the server's stale source monitor, nil until the server starts
+var alertMonitor *AlertMonitor
+
+// Alert reports a source whose urls haven't been fetched within its stale
+// duration. Sources get at most one open alert at a time
+type Alert struct {
+	Id       string    `json:"id"`
+	Created  time.Time `json:"created"`
+	Updated  time.Time `json:"updated"`
+	SourceId string    `json:"sourceId"`
+	PrimerId string    `json:"primerId"`
+	Message  string    `json:"message"`
+	// latest fetch of any of the source's urls, nil if none have been fetched
+	LastFetched *time.Time `json:"lastFetched"`
+	Dismissed   bool       `json:"dismissed"`
+	// key that dismissed the alert
+	DismissedBy string `json:"dismissedBy,omitempty"`
+}
+
+// staleAlertMessage describes a stale source
+func staleAlertMessage(title, url string, staleDuration time.Duration, lastFetched *time.Time, now time.Time) string {
+	name := title
+	if name == "" {
+		name = url
+	}
+	if lastFetched == nil {
+		return fmt.Sprintf("%s has never been fetched", name)
+	}
+	return fmt.Sprintf("%s hasn't been fetched in %s, longer than its stale duration of %s",
+		name, now.Sub(*lastFetched).Round(time.Minute), staleDuration)
+}
+
+// staleSource is a source found by the monitor
+type staleSource struct {
+	Id, PrimerId, Title, Url string
+	StaleDuration            time.Duration
+	LastFetched              *time.Time
+}
+
+// ReadStaleSources lists up to limit sources that need an alert as of now
+func ReadStaleSources(db sqlQueryable, now time.Time, limit int) ([]*staleSource, error) {
+	rows, err := db.Query(qStaleSources, now.In(time.UTC), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sources := []*staleSource{}
+	for rows.Next() {
+		s := &staleSource{}
+		var staleMs int64
+		if err := rows.Scan(&s.Id, &s.PrimerId, &s.Title, &s.Url, &staleMs, &s.LastFetched); err != nil {
+			return nil, err
+		}
+		s.StaleDuration = time.Duration(staleMs) * time.Millisecond
+		if s.LastFetched != nil {
+			utc := s.LastFetched.In(time.UTC)
+			s.LastFetched = &utc
+		}
+		sources = append(sources, s)
+	}
+	return sources, rows.Err()
+}
+
+// CreateStaleAlert records an alert for a stale source & marks the source
+// as alerted
+func CreateStaleAlert(db *sql.DB, s *staleSource, now time.Time) (*Alert, error) {
+	a := &Alert{
+		Id:          uuid.New(),
+		Created:     now.Round(time.Second).In(time.UTC),
+		SourceId:    s.Id,
+		PrimerId:    s.PrimerId,
+		Message:     staleAlertMessage(s.Title, s.Url, s.StaleDuration, s.LastFetched, now),
+		LastFetched: s.LastFetched,
+	}
+	a.Updated = a.Created
+
+	err := withTx(db, func(tx sqlQueryExecable) error {
+		if _, err := tx.Exec(qAlertInsert, a.Id, a.Created, a.Updated, a.SourceId, a.PrimerId, a.Message, a.LastFetched, a.Dismissed, a.DismissedBy); err != nil {
+			return err
+		}
+		_, err := tx.Exec(qSourceAlertSent, a.SourceId, a.Created)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// publish sends a SOURCE_STALE_ALERT to the alerts topic & the topics of the
+// alert's source & primer
+func (a *Alert) publish() {
+	res := &ClientResponse{
+		Type:      "SOURCE_STALE_ALERT",
+		RequestId: "server",
+		Schema:    "ALERT",
+		Id:        a.Id,
+		Data:      a,
+	}
+	room.Publish(AlertsTopic, res)
+	room.Publish(AuditTopic("SOURCE", a.SourceId), res)
+	if a.PrimerId != "" {
+		room.Publish(AuditTopic("PRIMER", a.PrimerId), res)
+	}
+}
+
+func scanAlert(row sqlScannable) (*Alert, error) {
+	a := &Alert{}
+	if err := row.Scan(&a.Id, &a.Created, &a.Updated, &a.SourceId, &a.PrimerId, &a.Message, &a.LastFetched, &a.Dismissed, &a.DismissedBy); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, core.ErrNotFound
+		}
+		return nil, err
+	}
+	a.Created = a.Created.In(time.UTC)
+	a.Updated = a.Updated.In(time.UTC)
+	if a.LastFetched != nil {
+		utc := a.LastFetched.In(time.UTC)
+		a.LastFetched = &utc
+	}
+	return a, nil
+}
+
+// ReadAlert reads an alert by id
+func ReadAlert(db sqlQueryable, id string) (*Alert, error) {
+	return scanAlert(db.QueryRow(qAlertById, id))
+}
+
+// ListAlertsPage reads a page of open or dismissed alerts, latest first,
+// optionally only those for sourceId
+func ListAlertsPage(db sqlQueryable, dismissed bool, sourceId string, p *PageParams) ([]*Alert, *Page, error) {
+	results, page, err := readKeysetPage(db, alertsKeyset, p, func(rows *sql.Rows) (interface{}, Cursor, error) {
+		a, err := scanAlert(rows)
+		if err != nil {
+			return nil, Cursor{}, err
+		}
+		return a, Cursor{Sort: cursorTime(a.Created), Id: a.Id}, nil
+	}, dismissed, sourceId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	alerts := make([]*Alert, len(results))
+	for i, r := range results {
+		alerts[i] = r.(*Alert)
+	}
+	return alerts, page, nil
+}
+
+// DismissAlert closes an open alert as keyId
+func DismissAlert(db sqlQueryExecable, id, keyId string) (*Alert, error) {
+	res, err := db.Exec(qAlertDismiss, id, keyId, time.Now().Round(time.Second).In(time.UTC))
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		if _, err := ReadAlert(db, id); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("alert %s is already dismissed", id)
+	}
+	return ReadAlert(db, id)
+}
+
+// AlertSuppression stops alerts being created for a source
+type AlertSuppression struct {
+	SourceId string    `json:"sourceId"`
+	Created  time.Time `json:"created"`
+	// key that suppressed the alerts
+	KeyId string `json:"keyId"`
+	// nil suppresses alerts indefinitely
+	Until *time.Time `json:"until"`
+}
+
+// SuppressAlerts stops alerts for a source until a time, or indefinitely if
+// until is nil, dismissing any open alerts for the source
+func SuppressAlerts(db *sql.DB, sourceId, keyId string, until *time.Time) (*AlertSuppression, error) {
+	s := &AlertSuppression{
+		SourceId: sourceId,
+		Created:  time.Now().Round(time.Second).In(time.UTC),
+		KeyId:    keyId,
+	}
+	if until != nil {
+		if !until.After(s.Created) {
+			return nil, fmt.Errorf("until must be in the future")
+		}
+		utc := until.In(time.UTC)
+		s.Until = &utc
+	}
+
+	src := &core.Source{Id: sourceId}
+	if err := src.Read(store); err != nil {
+		return nil, err
+	}
+
+	err := withTx(db, func(tx sqlQueryExecable) error {
+		res, err := tx.Exec(qAlertSuppressUpdate, s.SourceId, s.Created, s.KeyId, s.Until)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			if _, err := tx.Exec(qAlertSuppressInsert, s.SourceId, s.Created, s.KeyId, s.Until); err != nil {
+				return err
+			}
+		}
+		_, err = tx.Exec(qSourceAlertsDismiss, s.SourceId, s.KeyId, s.Created)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// UnsuppressAlerts lets alerts be created for a source again
+func UnsuppressAlerts(db sqlExecable, sourceId string) error {
+	res, err := db.Exec(qAlertSuppressDelete, sourceId)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return core.ErrNotFound
+	}
+	return nil
+}
+
+// AlertMonitor periodically checks for stale sources, creating & publishing
+// an alert for each
+type AlertMonitor struct {
+	Interval time.Duration
+	db       *sql.DB
+	done     chan struct{}
+}
+
+// NewAlertMonitor creates a monitor that checks sources in db
+func NewAlertMonitor(db *sql.DB) *AlertMonitor {
+	return &AlertMonitor{
+		Interval: alertsCheckInterval,
+		db:       db,
+		done:     make(chan struct{}),
+	}
+}
+
+// Start checks for stale sources in the background
+func (m *AlertMonitor) Start() {
+	go func() {
+		ticker := time.NewTicker(m.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := m.Check(time.Now()); err != nil {
+					log.Infof("error checking for stale sources: %s", err.Error())
+				}
+			case <-m.done:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends background checks
+func (m *AlertMonitor) Stop() {
+	close(m.done)
+}
+
+// Check creates alerts for sources that are stale as of now
+func (m *AlertMonitor) Check(now time.Time) ([]*Alert, error) {
+	sources, err := ReadStaleSources(m.db, now, alertsCheckLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	alerts := []*Alert{}
+	for _, s := range sources {
+		a, err := CreateStaleAlert(m.db, s, now)
+		if err != nil {
+			log.Infof("error creating alert for source %s: %s", s.Id, err.Error())
+			continue
+		}
+		a.publish()
+		alerts = append(alerts, a)
+	}
+	return alerts, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStaleAlertMessage(t *testing.T) {
+	now := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+	fetched := now.Add(-25*time.Hour - 20*time.Second)
+
+	cases := []struct {
+		title, url  string
+		lastFetched *time.Time
+		expect      string
+	}{
+		{"EPA", "https://www.epa.gov", nil, "EPA has never been fetched"},
+		{"", "https://www.epa.gov", nil, "https://www.epa.gov has never been fetched"},
+		{"EPA", "https://www.epa.gov", &fetched, "EPA hasn't been fetched in 25h0m0s, longer than its stale duration of 12h0m0s"},
+	}
+
+	for i, c := range cases {
+		got := staleAlertMessage(c.title, c.url, 12*time.Hour, c.lastFetched, now)
+		if got != c.expect {
+			t.Errorf("case %d mismatch. expected: '%s', got: '%s'", i, c.expect, got)
+		}
+	}
+}
+
+func TestReadStaleSources(t *testing.T) {
+	sources, err := ReadStaleSources(appDB, time.Now(), 100)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	found := map[string]*staleSource{}
+	for _, s := range sources {
+		found[s.Url] = s
+	}
+
+	// source urls are stored without a scheme
+	census := found["www.census.gov"]
+	if census == nil {
+		t.Fatalf("expected census source to be stale")
+	}
+	if census.LastFetched == nil {
+		t.Errorf("expected census source to have been fetched")
+	}
+	if epa := found["www.epa.gov"]; epa == nil || epa.LastFetched != nil {
+		t.Errorf("expected epa source to be stale & never fetched")
+	}
+	if found["data.census.gov"] != nil {
+		t.Errorf("expected uncrawled source to be skipped")
+	}
+}
@@ -8,34 +8,38 @@ import (
 	"time"
 )
 
-// ValidArchivingUrl checks to see if this url pattern-matches the list of subprimers
+// ValidArchivingUrl checks to see if this url pattern-matches the list of sources
 // TODO - there are many ways to spoof this, replace with actual URL matching.
 func ValidArchivingUrl(db *sql.DB, url string) error {
 	var exists bool
-	err := db.QueryRow("select exists(select 1 from subprimers where $1 ilike concat('%', url ,'%'))", url).Scan(&exists)
+	err := db.QueryRow("select exists(select 1 from sources where deleted = false and $1 ilike concat('%', url ,'%'))", url).Scan(&exists)
 	if err != nil {
 		return err
 	}
 	if !exists {
-		return fmt.Errorf("Oops! Only urls contained in subprimers can be archived. cannot archive %s", url)
+		return fmt.Errorf("Oops! Only urls contained in sources can be archived. cannot archive %s", url)
 	}
 	return nil
 }
 
-func (c *Client) ArchiveUrl(db *sql.DB, reqId, url string) {
+// RecordArchiveRequest checks a url can be archived & records who asked for it
+func RecordArchiveRequest(db *sql.DB, url, userId, origin string) (*ArchiveRequest, error) {
 	if err := ValidArchivingUrl(db, url); err != nil {
-		log.Info(err.Error())
-		c.SendResponse(&ClientResponse{
-			Type:      "URL_ARCHIVE_ERROR",
-			RequestId: reqId,
-			Error:     err.Error(),
-		})
-		return
+		return nil, err
+	}
+	req := &ArchiveRequest{
+		Url:    url,
+		UserId: userId,
+		Origin: origin,
+	}
+	if err := req.Insert(db); err != nil {
+		return nil, err
 	}
+	return req, nil
+}
 
-	// TODO - plumb userId into this
-	_, err := db.Exec("insert into archive_requests (created,url,user_id) values ($1, $2, $3)", time.Now().Round(time.Second).In(time.UTC), url, "")
-	if err != nil {
+func (c *Client) ArchiveUrl(db *sql.DB, reqId, url string) {
+	if _, err := RecordArchiveRequest(db, url, c.userId(), c.origin); err != nil {
 		log.Info(err.Error())
 		c.SendResponse(&ClientResponse{
 			Type:      "URL_ARCHIVE_ERROR",
@@ -112,8 +116,12 @@ func (c *Client) ArchiveUrl(db *sql.DB, reqId, url string) {
 		for _, l := range links {
 			// need a sleep here to avoid bombing server with requests
 			// tooooo hard, also we sleep first b/c the websocket trips up if
-			// we jam the messages to hard.
-			time.Sleep(time.Second * 3)
+			// we jam the messages to hard. stop once the client has left
+			select {
+			case <-time.After(time.Second * 3):
+			case <-c.done:
+				return
+			}
 
 			c.SendResponse(&ClientResponse{
 				Type:      "URL_SET_LOADING",
@@ -134,6 +142,7 @@ func (c *Client) ArchiveUrl(db *sql.DB, reqId, url string) {
 						"error": err.Error(),
 					},
 				})
+				continue
 			}
 
 			c.SendResponse(&ClientResponse{
@@ -148,22 +157,53 @@ func (c *Client) ArchiveUrl(db *sql.DB, reqId, url string) {
 	}(db, links)
 }
 
-// ArchiveUrl GET's a url and if it's an HTML page, any links it directly references
-func ArchiveUrl(db *sql.DB, url string, done func(err error)) (*core.Url, []*core.Link, error) {
+// LinkResult is the outcome of archiving a single link referenced by an archived url
+type LinkResult struct {
+	Url     string `json:"url"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+	// time taken to GET the link, in milliseconds
+	Took int64 `json:"took"`
+}
+
+// ArchiveResult summarizes archiving a url & the links it directly references
+type ArchiveResult struct {
+	Url       *core.Url     `json:"url"`
+	Links     []*LinkResult `json:"links"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Started   time.Time     `json:"started"`
+	// time taken to GET the base url, in milliseconds
+	Took int64 `json:"took"`
+	// time taken to archive the url and all of its links, in milliseconds
+	TotalTook int64 `json:"totalTook"`
+}
+
+// Err returns an error if any links failed to archive, nil otherwise
+func (r *ArchiveResult) Err() error {
+	if r.Failed > 0 {
+		return fmt.Errorf("%d of %d links failed to archive", r.Failed, len(r.Links))
+	}
+	return nil
+}
+
+// ArchiveUrl GET's a url and if it's an HTML page, any links it directly references.
+// Errors archiving the base url are returned directly. Otherwise links are archived
+// in the background & done is called with the completed result, along with a non-nil
+// error if any links failed
+func ArchiveUrl(db *sql.DB, url string, done func(res *ArchiveResult, err error)) (*core.Url, []*core.Link, error) {
+	started := time.Now()
 	u := &core.Url{Url: url}
 	if _, err := u.ParsedUrl(); err != nil {
-		done(err)
 		return nil, nil, err
 	}
 
 	if err := u.Read(store); err != nil {
 		if err == core.ErrNotFound {
 			if err := u.Save(store); err != nil {
-				done(err)
 				return nil, nil, err
 			}
 		} else {
-			done(err)
 			return nil, nil, err
 		}
 	}
@@ -171,50 +211,66 @@ func ArchiveUrl(db *sql.DB, url string, done func(err error)) (*core.Url, []*cor
 	// Perform GET request
 	_, links, err := u.Get(store)
 	if err != nil {
-		done(err)
 		return u, links, err
 	}
 
-	tasks := len(links)
-	errs := make(chan error, tasks)
+	res := &ArchiveResult{
+		Url:     u,
+		Links:   make([]*LinkResult, len(links)),
+		Started: started,
+		Took:    msSince(started),
+	}
 
 	go func(store datastore.Datastore, links []*core.Link) {
-		// GET each destination link from this page in parallel
-		for _, l := range links {
+		// GET each destination link from this page in sequence
+		for i, l := range links {
+			lr := &LinkResult{Url: l.Dst.Url}
+			start := time.Now()
 			if _, _, err := l.Dst.Get(store); err != nil {
 				log.Info(err.Error())
+				lr.Error = err.Error()
+				res.Failed++
+			} else {
+				lr.Success = true
+				res.Succeeded++
 			}
-			errs <- nil
+			lr.Took = msSince(start)
+			res.Links[i] = lr
 
 			// need a sleep here to avoid bombing server with requests
 			// tooooo hard
-			time.Sleep(time.Second * 3)
-		}
-	}(store, links)
-
-	go func() {
-		for i := 0; i < tasks; i++ {
-			err := <-errs
-			if err != nil {
-				done(err)
-				return
+			if i < len(links)-1 {
+				time.Sleep(time.Second * 3)
 			}
 		}
-		done(nil)
-	}()
+
+		res.TotalTook = msSince(started)
+		done(res, res.Err())
+	}(store, links)
 
 	return u, links, err
 }
 
-func ArchiveUrlSync(db *sql.DB, url string) (*core.Url, error) {
-	done := make(chan error)
-	u, _, err := ArchiveUrl(db, url, func(err error) {
-		done <- err
-	})
-	if err != nil {
-		return u, err
+// ArchiveUrlSync archives a url & its links, blocking until all links have been
+// fetched. The returned result is non-nil whenever the base url was archived,
+// even if the returned error reports failed links
+func ArchiveUrlSync(db *sql.DB, url string) (*ArchiveResult, error) {
+	type archiveDone struct {
+		res *ArchiveResult
+		err error
+	}
+	done := make(chan archiveDone, 1)
+	if _, _, err := ArchiveUrl(db, url, func(res *ArchiveResult, err error) {
+		done <- archiveDone{res, err}
+	}); err != nil {
+		return nil, err
 	}
 
-	err = <-done
-	return u, err
+	d := <-done
+	return d.res, d.err
+}
+
+// msSince gives the number of milliseconds elapsed since t
+func msSince(t time.Time) int64 {
+	return int64(time.Since(t) / time.Millisecond)
 }
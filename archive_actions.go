@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/datatogether/core"
+)
+
+// ArchiveRequestsAct lists the history of archive requests, optionally
+// filtered to a single user or url
+type ArchiveRequestsAct struct {
+	ReqAction
+	UserId string
+	Url    string
+	PageParams
+}
+
+func (ArchiveRequestsAct) Type() string        { return "ARCHIVE_REQUESTS_REQUEST" }
+func (ArchiveRequestsAct) SuccessType() string { return "ARCHIVE_REQUESTS_SUCCESS" }
+func (ArchiveRequestsAct) FailureType() string { return "ARCHIVE_REQUESTS_FAILURE" }
+
+func (ArchiveRequestsAct) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &ArchiveRequestsAct{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *ArchiveRequestsAct) Exec() (res *ClientResponse) {
+	reqs, page, err := ListArchiveRequestsPage(appDB, a.UserId, a.Url, &a.PageParams)
+	if err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return page.respond(&a.PageParams, &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "ARCHIVE_REQUEST_ARRAY",
+		Data:      reqs,
+	})
+}
+
+// WarcExportAct checks a url, source or collection can be exported, giving
+// the path to download its WARC file from & the number of records it holds.
+// WARCs are too big to send over the websocket, clients download them over
+// HTTP instead
+type WarcExportAct struct {
+	ReqAction
+	WarcExport
+}
+
+func (WarcExportAct) Type() string        { return "WARC_EXPORT_REQUEST" }
+func (WarcExportAct) SuccessType() string { return "WARC_EXPORT_SUCCESS" }
+func (WarcExportAct) FailureType() string { return "WARC_EXPORT_FAILURE" }
+
+func (WarcExportAct) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &WarcExportAct{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *WarcExportAct) Exec() (res *ClientResponse) {
+	urls, err := a.urls()
+	if err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "WARC",
+		Data: map[string]interface{}{
+			"filename": a.Filename(),
+			"records":  warcRecordCount(len(urls)),
+			"url":      a.Path(),
+		},
+	}
+}
+
+func (a *WarcExportAct) urls() ([]*core.Url, error) {
+	if err := viewableCollection(a.CollectionId, a.client.keyId()); err != nil {
+		return nil, err
+	}
+	return a.WarcExport.Urls(appDB)
+}
+
+// WarcImportStatusAct fetches the current state of a WARC import. Progress
+// updates are published to the import's topic as it runs
+type WarcImportStatusAct struct {
+	ReqAction
+	Id string
+}
+
+func (WarcImportStatusAct) Type() string        { return "WARC_IMPORT_STATUS_REQUEST" }
+func (WarcImportStatusAct) SuccessType() string { return "WARC_IMPORT_STATUS_SUCCESS" }
+func (WarcImportStatusAct) FailureType() string { return "WARC_IMPORT_STATUS_FAILURE" }
+
+func (WarcImportStatusAct) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &WarcImportStatusAct{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *WarcImportStatusAct) Exec() (res *ClientResponse) {
+	imp, err := ReadWarcImport(a.Id)
+	if err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "WARC_IMPORT",
+		Id:        a.Id,
+		Data:      imp.Status(),
+	}
+}
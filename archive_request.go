@@ -0,0 +1,45 @@
+package main
+
+import (
+	"time"
+)
+
+// ArchiveRequest records a request to archive a url, who asked for it,
+// and where the request came from
+type ArchiveRequest struct {
+	Id      int       `json:"id"`
+	Created time.Time `json:"created"`
+	Url     string    `json:"url"`
+	// id of the authenticated user that made the request, "" if anonymous
+	UserId string `json:"userId"`
+	// origin of the connection the request came from
+	Origin string `json:"origin"`
+}
+
+// Insert writes a new archive request to the db, setting Id & Created
+func (r *ArchiveRequest) Insert(db sqlQueryable) error {
+	r.Created = time.Now().Round(time.Second).In(time.UTC)
+	return db.QueryRow(qArchiveRequestInsert, r.Created, r.Url, r.UserId, r.Origin).Scan(&r.Id)
+}
+
+// UnmarshalSQL reads an sql response into the archive request receiver
+func (r *ArchiveRequest) UnmarshalSQL(row sqlScannable) error {
+	var (
+		id                  int
+		created             time.Time
+		url, userId, origin string
+	)
+
+	if err := row.Scan(&id, &created, &url, &userId, &origin); err != nil {
+		return err
+	}
+
+	*r = ArchiveRequest{
+		Id:      id,
+		Created: created.In(time.UTC),
+		Url:     url,
+		UserId:  userId,
+		Origin:  origin,
+	}
+	return nil
+}
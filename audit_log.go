@@ -0,0 +1,126 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/pborman/uuid"
+)
+
+// audit log actions
+const (
+	AuditCreate   = "CREATE"
+	AuditUpdate   = "UPDATE"
+	AuditDelete   = "DELETE"
+	AuditReparent = "REPARENT"
+)
+
+// AuditEntry records a change an admin made to a primer or source
+type AuditEntry struct {
+	Id      string    `json:"id"`
+	Created time.Time `json:"created"`
+	// key of the admin that made the change
+	KeyId string `json:"keyId"`
+	// one of CREATE, UPDATE, DELETE or REPARENT
+	Action string `json:"action"`
+	// PRIMER or SOURCE
+	SubjectType string `json:"subjectType"`
+	SubjectId   string `json:"subjectId"`
+	// the subject before & after the change. Prev is null for creates
+	Prev json.RawMessage `json:"prev"`
+	Next json.RawMessage `json:"next"`
+}
+
+// NewAuditEntry creates an unsaved entry. prev & next are marshalled to json,
+// either may be nil
+func NewAuditEntry(keyId, action, subjectType, subjectId string, prev, next interface{}) (*AuditEntry, error) {
+	e := &AuditEntry{
+		Id:          uuid.New(),
+		Created:     time.Now().Round(time.Second).In(time.UTC),
+		KeyId:       keyId,
+		Action:      action,
+		SubjectType: subjectType,
+		SubjectId:   subjectId,
+	}
+	var err error
+	if e.Prev, err = auditJSON(prev); err != nil {
+		return nil, err
+	}
+	if e.Next, err = auditJSON(next); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func auditJSON(v interface{}) (json.RawMessage, error) {
+	if v == nil {
+		return json.RawMessage("null"), nil
+	}
+	return json.Marshal(v)
+}
+
+// Insert records the entry
+func (e *AuditEntry) Insert(db sqlExecable) error {
+	_, err := db.Exec(qAuditLogInsert, e.Id, e.Created, e.KeyId, e.Action, e.SubjectType, e.SubjectId, []byte(e.Prev), []byte(e.Next))
+	return err
+}
+
+// AuditTopic is the subscription topic changes to a primer or source are
+// published to
+func AuditTopic(subjectType, subjectId string) string {
+	return subjectType + ":" + subjectId
+}
+
+// publish sends the entry to the topic of its subject & of each primer given,
+// so viewers of a parent primer see changes to its children
+func (e *AuditEntry) publish(primerIds ...string) {
+	res := &ClientResponse{
+		Type:      e.SubjectType + "_CHANGE",
+		RequestId: "server",
+		Schema:    "AUDIT_ENTRY",
+		Id:        e.SubjectId,
+		Data:      e,
+	}
+	room.Publish(AuditTopic(e.SubjectType, e.SubjectId), res)
+
+	seen := map[string]bool{}
+	for _, id := range primerIds {
+		if id == "" || seen[id] || (e.SubjectType == "PRIMER" && id == e.SubjectId) {
+			continue
+		}
+		seen[id] = true
+		room.Publish(AuditTopic("PRIMER", id), res)
+	}
+}
+
+// ListAuditLogPage reads a page of audit log entries, latest first,
+// optionally only those for subjectId
+func ListAuditLogPage(db sqlQueryable, subjectId string, p *PageParams) ([]*AuditEntry, *Page, error) {
+	results, page, err := readKeysetPage(db, auditLogKeyset, p, func(rows *sql.Rows) (interface{}, Cursor, error) {
+		e := &AuditEntry{}
+		var prev, next []byte
+		if err := rows.Scan(&e.Id, &e.Created, &e.KeyId, &e.Action, &e.SubjectType, &e.SubjectId, &prev, &next); err != nil {
+			return nil, Cursor{}, err
+		}
+		e.Created = e.Created.In(time.UTC)
+		e.Prev, e.Next = auditRaw(prev), auditRaw(next)
+		return e, Cursor{Sort: cursorTime(e.Created), Id: e.Id}, nil
+	}, subjectId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entries := make([]*AuditEntry, len(results))
+	for i, r := range results {
+		entries[i] = r.(*AuditEntry)
+	}
+	return entries, page, nil
+}
+
+func auditRaw(data []byte) json.RawMessage {
+	if data == nil {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(data)
+}
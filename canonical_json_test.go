@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCanonicalJSON(t *testing.T) {
+	cases := []struct {
+		in     interface{}
+		expect string
+	}{
+		{nil, `null`},
+		{map[string]interface{}{"b": 1, "a": true, "c": nil}, `{"a":true,"b":1,"c":null}`},
+		{map[string]interface{}{"z": map[string]interface{}{"y": "", "x": []interface{}{}}}, `{"z":{"x":[],"y":""}}`},
+		{"<a href=\"x\">&amp;</a>", `"<a href=\"x\">&amp;</a>"`},
+		{"\b\t\n\f\r\x01\x1f\\   é", "\"\\b\\t\\n\\f\\r\\u0001\\u001f\\\\   é\""},
+		{[]interface{}{1e21, 1e20, 0.000001, 1e-7, 1.5, -0.0, 333333333.33333329}, `[1e+21,100000000000000000000,0.000001,1e-7,1.5,0,333333333.3333333]`},
+		// sorted by utf-16 code units, which puts astral plane characters
+		// before the end of the basic multilingual plane
+		{map[string]interface{}{"דּ": 1, "\U0001f600": 2}, "{\"\U0001f600\":2,\"דּ\":1}"},
+		{struct {
+			B string `json:"b"`
+			A int    `json:"a"`
+		}{"x", 2}, `{"a":2,"b":"x"}`},
+	}
+
+	for i, c := range cases {
+		got, err := canonicalJSON(c.in)
+		if err != nil {
+			t.Errorf("case %d unexpected error: %s", i, err.Error())
+			continue
+		}
+		if string(got) != c.expect {
+			t.Errorf("case %d mismatch.\nexpected: %s\ngot:      %s", i, c.expect, string(got))
+		}
+	}
+}
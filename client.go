@@ -45,6 +45,30 @@ type Client struct {
 	conn *websocket.Conn
 	// Buffered channel of outbound messages.
 	send chan []byte
+	// closed when the client leaves the room. send is never closed, so
+	// goroutines that outlive the connection can't send on a closed channel
+	done chan struct{}
+	// user is the authenticated user for this connection, nil if anonymous
+	user *User
+	// origin of the connection
+	origin string
+}
+
+// userId gives the id of the connection's authenticated user, "" if anonymous
+func (c *Client) userId() string {
+	if c == nil || c.user == nil {
+		return ""
+	}
+	return c.user.Id
+}
+
+// keyId gives the current key of the connection's authenticated user,
+// "" if anonymous
+func (c *Client) keyId() string {
+	if c == nil || c.user == nil {
+		return ""
+	}
+	return c.user.CurrentKey
 }
 
 // readPump pumps messages from the websocket connection to the hub.
@@ -93,13 +117,13 @@ func (c *Client) writePump() {
 	}()
 	for {
 		select {
-		case message, ok := <-c.send:
+		case <-c.done:
+			// The hub removed the client.
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+			return
+		case message := <-c.send:
 			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if !ok {
-				// The hub closed the channel.
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
-				return
-			}
 
 			// c.conn.WriteJSON()
 			w, err := c.conn.NextWriter(websocket.TextMessage)
@@ -143,19 +167,22 @@ func (c *Client) HandleAction(data []byte) {
 		return
 	}
 	// TODO - This looks a lot like a muxer...
-	// if action.Type == "URL_ARCHIVE_REQUEST" {
-	// 	act := struct {
-	// 		Url string
-	// 	}{}
-	// 	if err := json.Unmarshal(action.Data, &act); err != nil {
-	// 		c.SendResponse(&ClientResponse{
-	// 			Type:  "PARSE_ERROR",
-	// 			Error: fmt.Sprintf("action parsing error: %s", err.Error()),
-	// 		})
-	// 		return
-	// 	}
-	// 	c.ArchiveUrl(appDB, action.RequestId, act.Url)
-	// } else
+	if action.Type == "URL_ARCHIVE_REQUEST" {
+		act := struct {
+			Url string
+		}{}
+		if err := json.Unmarshal(action.Data, &act); err != nil {
+			c.SendResponse(&ClientResponse{
+				Type:  "PARSE_ERROR",
+				Error: fmt.Sprintf("action parsing error: %s", err.Error()),
+			})
+			return
+		}
+		// archiving can take a while, don't hold up reading the client's
+		// other requests. ArchiveUrl replies as it goes
+		go c.ArchiveUrl(appDB, action.RequestId, act.Url)
+		return
+	}
 
 	if strings.HasSuffix(action.Type, "REQUEST") {
 		log.Infof("%s: %s", action.RequestId, action.Type)
@@ -174,7 +201,11 @@ func (c *Client) SendResponse(res *ClientResponse) {
 		log.Info(err.Error())
 		return
 	}
-	c.send <- data
+	// responses to clients that have left are dropped
+	select {
+	case c.send <- data:
+	case <-c.done:
+	}
 	// if err := c.conn.WriteJSON(res); err != nil {
 	// 	log.Info(err.Error())
 	// }
@@ -183,7 +214,11 @@ func (c *Client) SendResponse(res *ClientResponse) {
 func (c *Client) HandleRequestAction(req string, reqId string, silentError bool, data json.RawMessage) {
 	for _, t := range ClientReqActions {
 		if t.Type() == req {
-			res := t.Parse(reqId, data).Exec()
+			act := t.Parse(reqId, data)
+			if ca, ok := act.(clientAction); ok {
+				ca.setClient(c)
+			}
+			res := act.Exec()
 			res.SilentError = silentError
 			c.SendResponse(res)
 		}
@@ -197,7 +232,12 @@ func serveWs(hub *Room, w http.ResponseWriter, r *http.Request) {
 		log.Info(err)
 		return
 	}
-	client := &Client{hub: hub, conn: conn, send: make(chan []byte, 256)}
+	user, err := SessionUser(r)
+	if err != nil {
+		log.Infof("error reading session user: %s", err.Error())
+	}
+
+	client := &Client{hub: hub, conn: conn, send: make(chan []byte, 256), done: make(chan struct{}), user: user, origin: requestOrigin(r)}
 	client.hub.register <- client
 	go client.writePump()
 	client.readPump()
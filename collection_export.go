@@ -0,0 +1,409 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/datatogether/core"
+)
+
+// collection export formats
+const (
+	CollectionFormatCSV         = "csv"
+	CollectionFormatJSONL       = "jsonl"
+	CollectionFormatBagIt       = "bagit"
+	CollectionFormatDatapackage = "datapackage"
+)
+
+// max number of items written to a single collection export
+const maxCollectionExportItems = 10000
+
+// sha256MultihashPrefix prefixes hex-encoded sha256 multihashes, which is
+// how content hashes are stored
+const sha256MultihashPrefix = "1220"
+
+// CollectionExportItem is a single item of an exported collection
+type CollectionExportItem struct {
+	Index         int    `json:"index"`
+	Url           string `json:"url"`
+	Hash          string `json:"hash,omitempty"`
+	Title         string `json:"title,omitempty"`
+	Description   string `json:"description,omitempty"`
+	ContentType   string `json:"contentType,omitempty"`
+	ContentLength int64  `json:"contentLength,omitempty"`
+	FileName      string `json:"fileName,omitempty"`
+	// latest metadata written for the item's content, if any
+	MetadataHash      string                 `json:"metadataHash,omitempty"`
+	MetadataKeyId     string                 `json:"metadataKeyId,omitempty"`
+	MetadataTimestamp *time.Time             `json:"metadataTimestamp,omitempty"`
+	Metadata          map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// CollectionExport describes a collection to export in one of the
+// collection export formats
+type CollectionExport struct {
+	CollectionId string
+	// defaults to JSON Lines
+	Format string
+}
+
+// Filename gives a name for the exported file
+func (e *CollectionExport) Filename() string {
+	switch e.Format {
+	case CollectionFormatBagIt:
+		return fmt.Sprintf("collection-%s.zip", e.CollectionId)
+	case CollectionFormatDatapackage:
+		return "datapackage.json"
+	}
+	return fmt.Sprintf("collection-%s.%s", e.CollectionId, e.Format)
+}
+
+// ContentType gives the mime type of the exported file
+func (e *CollectionExport) ContentType() string {
+	switch e.Format {
+	case CollectionFormatCSV:
+		return "text/csv"
+	case CollectionFormatBagIt:
+		return "application/zip"
+	case CollectionFormatDatapackage:
+		return "application/json"
+	}
+	return "application/x-ndjson"
+}
+
+// Path gives the url path that downloads the export
+func (e *CollectionExport) Path() string {
+	q := url.Values{}
+	q.Set("id", e.CollectionId)
+	if e.Format != "" {
+		q.Set("format", e.Format)
+	}
+	return "/collection/export?" + q.Encode()
+}
+
+// Items checks the export is valid & reads the collection & items it covers
+func (e *CollectionExport) Items(db sqlQueryable) (*core.Collection, []*CollectionExportItem, error) {
+	switch e.Format {
+	case "":
+		e.Format = CollectionFormatJSONL
+	case CollectionFormatCSV, CollectionFormatJSONL, CollectionFormatBagIt, CollectionFormatDatapackage:
+	default:
+		return nil, nil, fmt.Errorf("unsupported collection format: '%s'", e.Format)
+	}
+	if e.CollectionId == "" {
+		return nil, nil, fmt.Errorf("collectionId is required")
+	}
+
+	c := &core.Collection{Id: e.CollectionId}
+	if err := c.Read(store); err != nil {
+		return nil, nil, err
+	}
+	items, err := ReadCollectionExportItems(db, c.Id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, items, nil
+}
+
+// Write writes the export to w, returning the number of items written
+func (e *CollectionExport) Write(db *sql.DB, w io.Writer) (int, error) {
+	c, items, err := e.Items(db)
+	if err != nil {
+		return 0, err
+	}
+	return e.WriteItems(w, c, items)
+}
+
+// WriteItems writes items read by Items to w in the export's format,
+// returning the number of items written
+func (e *CollectionExport) WriteItems(w io.Writer, c *core.Collection, items []*CollectionExportItem) (int, error) {
+	var err error
+	switch e.Format {
+	case CollectionFormatCSV:
+		err = WriteCollectionCSV(w, items)
+	case CollectionFormatBagIt:
+		err = WriteCollectionBag(w, c, items)
+	case CollectionFormatDatapackage:
+		err = WriteCollectionDatapackage(w, c, items)
+	default:
+		err = WriteCollectionJSONL(w, items)
+	}
+	return len(items), err
+}
+
+// ReadCollectionExportItems reads the items of a collection in index order
+func ReadCollectionExportItems(db sqlQueryable, collectionId string) ([]*CollectionExportItem, error) {
+	rows, err := db.Query(qCollectionExportItems, collectionId, maxCollectionExportItems)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]*CollectionExportItem, 0)
+	for rows.Next() {
+		i := &CollectionExportItem{}
+		var meta []byte
+		if err := rows.Scan(&i.Index, &i.Description, &i.Url, &i.Hash, &i.Title, &i.ContentType, &i.ContentLength, &i.FileName,
+			&i.MetadataHash, &i.MetadataKeyId, &i.MetadataTimestamp, &meta); err != nil {
+			return nil, err
+		}
+		if i.MetadataTimestamp != nil {
+			ts := i.MetadataTimestamp.In(time.UTC)
+			i.MetadataTimestamp = &ts
+		}
+		if meta != nil {
+			if err := json.Unmarshal(meta, &i.Metadata); err != nil {
+				return nil, err
+			}
+		}
+		items = append(items, i)
+	}
+	return items, rows.Err()
+}
+
+// WriteCollectionJSONL writes one item per line
+func WriteCollectionJSONL(w io.Writer, items []*CollectionExportItem) error {
+	enc := json.NewEncoder(w)
+	for _, i := range items {
+		if err := enc.Encode(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteCollectionCSV writes items as CSV, with a "meta." prefixed column for
+// every metadata field in alphabetical order. non-string metadata values are
+// JSON encoded
+func WriteCollectionCSV(w io.Writer, items []*CollectionExportItem) error {
+	fieldSet := map[string]bool{}
+	for _, i := range items {
+		for field := range i.Metadata {
+			fieldSet[field] = true
+		}
+	}
+	fields := make([]string, 0, len(fieldSet))
+	for field := range fieldSet {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	header := []string{"index", "url", "hash", "title", "description", "contentType", "contentLength", "fileName", "metadataHash", "metadataKeyId"}
+	for _, field := range fields {
+		header = append(header, "meta."+field)
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, i := range items {
+		row := []string{strconv.Itoa(i.Index), i.Url, i.Hash, i.Title, i.Description, i.ContentType,
+			strconv.FormatInt(i.ContentLength, 10), i.FileName, i.MetadataHash, i.MetadataKeyId}
+		for _, field := range fields {
+			cell, err := csvMetadataCell(i.Metadata[field])
+			if err != nil {
+				return err
+			}
+			row = append(row, cell)
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteCollectionBag writes a zipped BagIt bag describing the collection.
+// content is archived separately, so the bag is "holey": fetch.txt lists the
+// url each payload file is retrieved from, & manifest-sha256.txt lists the
+// checksum it must match. items without fetched content are left out of the
+// payload, but all items & their metadata are listed in the items.jsonl tag file
+func WriteCollectionBag(w io.Writer, c *core.Collection, items []*CollectionExportItem) error {
+	var (
+		fetch    = &bytes.Buffer{}
+		manifest = &bytes.Buffer{}
+		oxum     int64
+		files    int
+	)
+	for _, i := range items {
+		sum := sha256Hex(i.Hash)
+		if sum == "" {
+			continue
+		}
+		p := bagPayloadPath(i)
+		length := "-"
+		if i.ContentLength > 0 {
+			length = strconv.FormatInt(i.ContentLength, 10)
+			oxum += i.ContentLength
+		}
+		fmt.Fprintf(fetch, "%s %s %s\n", i.Url, length, p)
+		fmt.Fprintf(manifest, "%s  %s\n", sum, p)
+		files++
+	}
+
+	itemsData := &bytes.Buffer{}
+	if err := WriteCollectionJSONL(itemsData, items); err != nil {
+		return err
+	}
+
+	info := &bytes.Buffer{}
+	fmt.Fprintf(info, "Source-Organization: Data Together\n")
+	fmt.Fprintf(info, "External-Identifier: %s\n", c.Id)
+	fmt.Fprintf(info, "External-Description: %s\n", bagInfoValue(c.Title))
+	if c.Description != "" {
+		fmt.Fprintf(info, "Internal-Sender-Description: %s\n", bagInfoValue(c.Description))
+	}
+	fmt.Fprintf(info, "Bagging-Date: %s\n", time.Now().In(time.UTC).Format("2006-01-02"))
+	fmt.Fprintf(info, "Payload-Oxum: %d.%d\n", oxum, files)
+
+	tags := []struct {
+		name string
+		data []byte
+	}{
+		{"bagit.txt", []byte("BagIt-Version: 0.97\nTag-File-Character-Encoding: UTF-8\n")},
+		{"bag-info.txt", info.Bytes()},
+		{"fetch.txt", fetch.Bytes()},
+		{"manifest-sha256.txt", manifest.Bytes()},
+		{"items.jsonl", itemsData.Bytes()},
+	}
+
+	root := fmt.Sprintf("collection-%s", c.Id)
+	zw := zip.NewWriter(w)
+	tagManifest := &bytes.Buffer{}
+	for _, t := range tags {
+		f, err := zw.Create(path.Join(root, t.name))
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(t.data); err != nil {
+			return err
+		}
+		sum := sha256.Sum256(t.data)
+		fmt.Fprintf(tagManifest, "%s  %s\n", hex.EncodeToString(sum[:]), t.name)
+	}
+
+	f, err := zw.Create(path.Join(root, "tagmanifest-sha256.txt"))
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(tagManifest.Bytes()); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// bagPayloadPath gives the path of an item's content within a bag, prefixed
+// with the item index to keep paths unique
+func bagPayloadPath(i *CollectionExportItem) string {
+	name := i.FileName
+	if name == "" {
+		name = i.Hash
+	}
+	// fetch.txt & manifest lines are space-separated
+	name = strings.Replace(path.Base(name), " ", "_", -1)
+	return fmt.Sprintf("data/%d-%s", i.Index, name)
+}
+
+// bagInfoValue keeps a bag-info.txt value on a single line
+func bagInfoValue(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// sha256Hex gives the hex sha256 checksum of a content hash, "" if the hash
+// isn't a sha256 multihash
+func sha256Hex(hash string) string {
+	if len(hash) != len(sha256MultihashPrefix)+sha256.Size*2 || !strings.HasPrefix(hash, sha256MultihashPrefix) {
+		return ""
+	}
+	return hash[len(sha256MultihashPrefix):]
+}
+
+// datapackage names are lowercase alphanumerics, "-", "_" & "."
+var datapackageNameInvalid = regexp.MustCompile(`[^a-z0-9\-_\.]+`)
+
+func datapackageName(s string) string {
+	return strings.Trim(datapackageNameInvalid.ReplaceAllString(strings.ToLower(s), "-"), "-.")
+}
+
+// WriteCollectionDatapackage writes a datapackage.json descriptor with a
+// resource for each item, pointing at the item's url
+func WriteCollectionDatapackage(w io.Writer, c *core.Collection, items []*CollectionExportItem) error {
+	name := datapackageName(c.Title)
+	if name == "" {
+		name = c.Id
+	}
+
+	resources := make([]map[string]interface{}, len(items))
+	used := map[string]bool{}
+	for idx, i := range items {
+		var rname string
+		if i.FileName != "" {
+			rname = datapackageName(path.Base(i.FileName))
+		}
+		if rname == "" || used[rname] {
+			rname = fmt.Sprintf("item-%d", i.Index)
+		}
+		used[rname] = true
+
+		r := map[string]interface{}{
+			"name": rname,
+			"path": i.Url,
+		}
+		if i.Title != "" {
+			r["title"] = i.Title
+		}
+		if i.Description != "" {
+			r["description"] = i.Description
+		}
+		if i.ContentType != "" {
+			r["mediatype"] = i.ContentType
+		}
+		if i.ContentLength > 0 {
+			r["bytes"] = i.ContentLength
+		}
+		if sum := sha256Hex(i.Hash); sum != "" {
+			r["hash"] = "sha256:" + sum
+		}
+		if i.Metadata != nil {
+			r["metadata"] = i.Metadata
+		}
+		resources[idx] = r
+	}
+
+	pkg := map[string]interface{}{
+		"name":      name,
+		"id":        c.Id,
+		"title":     c.Title,
+		"created":   c.Created.In(time.UTC).Format(time.RFC3339),
+		"resources": resources,
+	}
+	if c.Description != "" {
+		pkg["description"] = c.Description
+	}
+	if c.Url != "" {
+		pkg["homepage"] = c.Url
+	}
+
+	data, err := json.MarshalIndent(pkg, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
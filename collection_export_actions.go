@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+)
+
+// CollectionExportAct checks a collection can be exported as a CSV, JSON
+// Lines, BagIt zip or datapackage.json file, giving the path to download the
+// file from & the number of items it holds. exports are too big to send over
+// the websocket, clients download them over HTTP instead
+type CollectionExportAct struct {
+	ReqAction
+	CollectionExport
+}
+
+func (CollectionExportAct) Type() string        { return "COLLECTION_EXPORT_REQUEST" }
+func (CollectionExportAct) SuccessType() string { return "COLLECTION_EXPORT_SUCCESS" }
+func (CollectionExportAct) FailureType() string { return "COLLECTION_EXPORT_FAILURE" }
+
+func (CollectionExportAct) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &CollectionExportAct{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *CollectionExportAct) Exec() (res *ClientResponse) {
+	items, err := a.items()
+	if err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "COLLECTION_EXPORT",
+		Id:        a.CollectionId,
+		Data: map[string]interface{}{
+			"filename":    a.Filename(),
+			"format":      a.Format,
+			"contentType": a.ContentType(),
+			"items":       len(items),
+			"url":         a.Path(),
+		},
+	}
+}
+
+func (a *CollectionExportAct) items() ([]*CollectionExportItem, error) {
+	if err := requireCollectionRole(appDB, a.CollectionId, a.client.keyId(), CollectionRoleViewer); err != nil {
+		return nil, err
+	}
+	_, items, err := a.CollectionExport.Items(appDB)
+	return items, err
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/datatogether/core"
+)
+
+var exportTestItems = []*CollectionExportItem{
+	{Index: 0, Url: "http://epa.gov/air.csv", Hash: "1220" + strings.Repeat("ab", 32), FileName: "air.csv", ContentLength: 10, ContentType: "text/csv",
+		Metadata: map[string]interface{}{"title": "Air Quality"}},
+	{Index: 1, Url: "http://epa.gov/water", Title: "Water"},
+}
+
+func TestWriteCollectionBag(t *testing.T) {
+	c := &core.Collection{Id: "col", Title: "EPA\nData"}
+	buf := &bytes.Buffer{}
+	if err := WriteCollectionBag(buf, c, exportTestItems); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		files[f.Name] = string(data)
+	}
+
+	expect := map[string]string{
+		"collection-col/fetch.txt":           "http://epa.gov/air.csv 10 data/0-air.csv\n",
+		"collection-col/manifest-sha256.txt": strings.Repeat("ab", 32) + "  data/0-air.csv\n",
+	}
+	for name, data := range expect {
+		if files[name] != data {
+			t.Errorf("%s mismatch. expected: %q, got: %q", name, data, files[name])
+		}
+	}
+	for _, name := range []string{"bagit.txt", "bag-info.txt", "items.jsonl", "tagmanifest-sha256.txt"} {
+		if _, ok := files["collection-col/"+name]; !ok {
+			t.Errorf("expected bag to contain %s", name)
+		}
+	}
+	if !strings.Contains(files["collection-col/bag-info.txt"], "External-Description: EPA Data\n") {
+		t.Errorf("expected bag-info description on a single line, got: %s", files["collection-col/bag-info.txt"])
+	}
+	if lines := strings.Count(files["collection-col/items.jsonl"], "\n"); lines != 2 {
+		t.Errorf("expected 2 items in items.jsonl, got %d", lines)
+	}
+}
+
+func TestWriteCollectionDatapackage(t *testing.T) {
+	c := &core.Collection{Id: "col", Title: "EPA Air & Water"}
+	buf := &bytes.Buffer{}
+	if err := WriteCollectionDatapackage(buf, c, exportTestItems); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	pkg := struct {
+		Name      string
+		Resources []map[string]interface{}
+	}{}
+	if err := json.Unmarshal(buf.Bytes(), &pkg); err != nil {
+		t.Fatal(err.Error())
+	}
+	if pkg.Name != "epa-air-water" {
+		t.Errorf("name mismatch. expected: %s, got: %s", "epa-air-water", pkg.Name)
+	}
+	if len(pkg.Resources) != 2 {
+		t.Fatalf("expected 2 resources, got %d", len(pkg.Resources))
+	}
+	if pkg.Resources[0]["hash"] != "sha256:"+strings.Repeat("ab", 32) {
+		t.Errorf("expected sha256 hash, got: %v", pkg.Resources[0]["hash"])
+	}
+	if pkg.Resources[1]["name"] != "item-1" {
+		t.Errorf("expected item without a filename to be named by index, got: %v", pkg.Resources[1]["name"])
+	}
+}
+
+func TestCollectionExportPath(t *testing.T) {
+	cases := []struct {
+		e      *CollectionExport
+		expect string
+	}{
+		{&CollectionExport{CollectionId: "col"}, "/collection/export?id=col"},
+		{&CollectionExport{CollectionId: "col", Format: CollectionFormatBagIt}, "/collection/export?format=bagit&id=col"},
+	}
+
+	for i, c := range cases {
+		if got := c.e.Path(); got != c.expect {
+			t.Errorf("case %d mismatch. expected: '%s', got: '%s'", i, c.expect, got)
+		}
+	}
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/datatogether/core"
+)
+
+// collection import formats. CSV & JSON Lines match the collection export
+// formats, JSON files hold an array of records
+const (
+	CollectionImportCSV   = CollectionFormatCSV
+	CollectionImportJSON  = "json"
+	CollectionImportJSONL = CollectionFormatJSONL
+)
+
+// max number of rows read from a single collection import
+const maxCollectionImportRows = 5000
+
+// max number of urls archived for a single collection import
+const maxCollectionImportArchive = 100
+
+// collectionImportArchiving bounds the number of imports archiving urls at
+// once. imports that find it full skip archiving
+var collectionImportArchiving = make(chan struct{}, 2)
+
+// CollectionRecord is a single row of a collection import file
+type CollectionRecord struct {
+	Url         string `json:"url"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	// position in the collection, rows without an index are added after
+	// the last item in file order
+	Index *int `json:"index"`
+}
+
+// CollectionImportRow is the outcome of importing a single row
+type CollectionImportRow struct {
+	Row int `json:"row"`
+	// normalized url
+	Url   string `json:"url,omitempty"`
+	Index int    `json:"index"`
+	// the url wasn't previously known & was created
+	Created bool `json:"created,omitempty"`
+	// archiving was requested for the url
+	Archiving bool   `json:"archiving,omitempty"`
+	Error     string `json:"error,omitempty"`
+	// per-field errors when the item doesn't match the collection's items schema
+	Errors ValidationError `json:"errors,omitempty"`
+}
+
+// CollectionImportResult summarizes an import
+type CollectionImportResult struct {
+	CollectionId string `json:"collectionId"`
+	Rows         int    `json:"rows"`
+	Imported     int    `json:"imported"`
+	Failed       int    `json:"failed"`
+	// urls that could have been archived, but weren't because of archiving
+	// limits
+	ArchiveSkipped int                    `json:"archiveSkipped,omitempty"`
+	Results        []*CollectionImportRow `json:"results"`
+}
+
+// CollectionImport adds the urls in a file to a collection
+type CollectionImport struct {
+	CollectionId string
+	// one of the collection import formats, detected from Filename if empty
+	Format   string
+	Filename string
+	// request archiving of imported urls that belong to a source
+	Archive bool
+	// key of the user importing, which the new collection version is
+	// recorded under
+	keyId string
+	// user & connection origin requesting archiving
+	userId, origin string
+}
+
+// CollectionImportFormat picks a file format from a format name or
+// filename, defaulting to JSON Lines
+func CollectionImportFormat(format, filename string) (string, error) {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(filename)) {
+		case ".csv":
+			return CollectionImportCSV, nil
+		case ".json":
+			return CollectionImportJSON, nil
+		}
+		return CollectionImportJSONL, nil
+	}
+	switch format {
+	case CollectionImportCSV, CollectionImportJSON, CollectionImportJSONL:
+		return format, nil
+	}
+	return "", fmt.Errorf("unsupported collection import format: '%s'", format)
+}
+
+// Run reads rows from r, creating urls that don't exist yet & saving each
+// as an item of the collection. rows that fail are reported in the result
+// & don't stop the import. items are written & versioned in one transaction
+func (imp *CollectionImport) Run(db *sql.DB, r io.Reader) (*CollectionImportResult, error) {
+	format, err := CollectionImportFormat(imp.Format, imp.Filename)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &core.Collection{Id: imp.CollectionId}
+	if err := c.Read(store); err != nil {
+		return nil, err
+	}
+	_, schema, err := ReadCollectionSchemas(db, c.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &CollectionImportResult{CollectionId: c.Id, Results: []*CollectionImportRow{}}
+	archive := []*CollectionImportRow{}
+	err = changeCollection(db, c.Id, imp.keyId, func(tx sqlQueryExecable) error {
+		next := 0
+		if err := tx.QueryRow(qCollectionMaxIndex, c.Id).Scan(&next); err != nil {
+			return err
+		}
+		next++
+
+		// a failed write aborts the transaction, so it stops the import
+		var txErr error
+		err := ReadCollectionRecords(format, r, func(row int, rec *CollectionRecord, err error) {
+			if txErr != nil {
+				return
+			}
+			result := &CollectionImportRow{Row: row}
+			if err == nil {
+				var (
+					item  *core.CollectionItem
+					known bool
+				)
+				if item, known, err = imp.item(rec); err == nil {
+					if rec.Index != nil {
+						item.Index = *rec.Index
+					} else {
+						item.Index = next
+					}
+					result.Url, result.Index = item.Url.Url, item.Index
+					if err = imp.prepareItem(schema, item, known); err == nil {
+						if txErr = saveCollectionItem(tx, c.Id, item); txErr != nil {
+							return
+						}
+						result.Created = !known
+					}
+				}
+				if err == nil && rec.Index == nil {
+					next++
+				}
+			}
+
+			if err != nil {
+				result.Error = err.Error()
+				if verr, ok := err.(ValidationError); ok {
+					result.Errors = verr
+				}
+				res.Failed++
+			} else {
+				res.Imported++
+				if imp.Archive && ValidArchivingUrl(db, result.Url) == nil {
+					archive = append(archive, result)
+				}
+			}
+			res.Rows++
+			res.Results = append(res.Results, result)
+		})
+		if err != nil {
+			return err
+		}
+		return txErr
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(archive) > 0 {
+		imp.archive(db, res, archive)
+	}
+	return res, nil
+}
+
+// archive starts archiving up to maxCollectionImportArchive of rows in the
+// background, marking them as archiving. rows that aren't archived are
+// counted as skipped
+func (imp *CollectionImport) archive(db *sql.DB, res *CollectionImportResult, rows []*CollectionImportRow) {
+	select {
+	case collectionImportArchiving <- struct{}{}:
+	default:
+		log.Infof("collection import %s: too many imports archiving, skipping %d urls", imp.CollectionId, len(rows))
+		res.ArchiveSkipped = len(rows)
+		return
+	}
+
+	if len(rows) > maxCollectionImportArchive {
+		res.ArchiveSkipped = len(rows) - maxCollectionImportArchive
+		rows = rows[:maxCollectionImportArchive]
+	}
+	urls := make([]string, len(rows))
+	for i, row := range rows {
+		row.Archiving = true
+		urls[i] = row.Url
+	}
+
+	go func() {
+		defer func() { <-collectionImportArchiving }()
+		imp.archiveUrls(db, urls)
+	}()
+}
+
+// item normalizes a record's url, reading it if it's already known. unknown
+// urls aren't created until the item is saved
+func (imp *CollectionImport) item(rec *CollectionRecord) (item *core.CollectionItem, known bool, err error) {
+	if strings.TrimSpace(rec.Url) == "" {
+		return nil, false, fmt.Errorf("url is required")
+	}
+	normalized, err := core.NormalizeURLString(strings.TrimSpace(rec.Url))
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid url: %s", err.Error())
+	}
+
+	u := &core.Url{Url: normalized}
+	if _, err := u.ParsedUrl(); err != nil {
+		return nil, false, fmt.Errorf("invalid url: %s", err.Error())
+	}
+	if err := u.Read(store); err != nil {
+		if err != core.ErrNotFound {
+			return nil, false, err
+		}
+		u.Title = rec.Title
+		return &core.CollectionItem{Url: *u, Description: rec.Description}, false, nil
+	}
+
+	return &core.CollectionItem{Url: *u, Description: rec.Description}, true, nil
+}
+
+// prepareItem checks item against the collection's items schema before
+// creating its url if it isn't known, so invalid rows don't leave urls behind
+func (imp *CollectionImport) prepareItem(schema map[string]interface{}, item *core.CollectionItem, known bool) error {
+	if schema != nil {
+		verr, err := validateCollectionItem(schema, item)
+		if err != nil {
+			return err
+		}
+		if len(verr) > 0 {
+			return verr
+		}
+	}
+	if known {
+		return nil
+	}
+	return item.Url.Save(store)
+}
+
+// archiveUrls archives urls one at a time, recording an archive request
+// for each
+func (imp *CollectionImport) archiveUrls(db *sql.DB, urls []string) {
+	for _, url := range urls {
+		req := &ArchiveRequest{Url: url, UserId: imp.userId, Origin: imp.origin}
+		if err := req.Insert(db); err != nil {
+			log.Info(err.Error())
+			continue
+		}
+		if _, err := ArchiveUrlSync(db, url); err != nil {
+			log.Infof("collection import %s: error archiving %s: %s", imp.CollectionId, url, err.Error())
+		}
+	}
+}
+
+// ReadCollectionRecords reads records from r, calling fn with the row number
+// of each. rows that can't be parsed are passed to fn with an error instead
+// of a record. the returned error is for failures that stop reading
+//
+// CSV files must have a header row with a url column, & may have title,
+// description & index columns. JSON & JSON Lines files hold CollectionRecord
+// objects, which is a subset of the collection export item format
+func ReadCollectionRecords(format string, r io.Reader, fn func(row int, rec *CollectionRecord, err error)) error {
+	rows := 0
+	limited := func(row int, rec *CollectionRecord, err error) error {
+		if rows++; rows > maxCollectionImportRows {
+			return fmt.Errorf("imports are limited to %d rows", maxCollectionImportRows)
+		}
+		fn(row, rec, err)
+		return nil
+	}
+
+	switch format {
+	case CollectionImportCSV:
+		return readCollectionCSV(r, limited)
+	case CollectionImportJSON:
+		return readCollectionJSON(r, limited)
+	case CollectionImportJSONL:
+		return readCollectionJSONL(r, limited)
+	}
+	return fmt.Errorf("unsupported collection import format: '%s'", format)
+}
+
+func readCollectionCSV(r io.Reader, fn func(row int, rec *CollectionRecord, err error) error) error {
+	rdr := csv.NewReader(r)
+	rdr.FieldsPerRecord = -1
+	header, err := rdr.Read()
+	if err == io.EOF {
+		return fmt.Errorf("csv file is empty")
+	}
+	if err != nil {
+		return err
+	}
+
+	cols := map[string]int{}
+	for i, col := range header {
+		cols[strings.ToLower(strings.TrimSpace(col))] = i
+	}
+	if _, ok := cols["url"]; !ok {
+		return fmt.Errorf("csv header must include a url column")
+	}
+	cell := func(cells []string, col string) string {
+		if i, ok := cols[col]; ok && i < len(cells) {
+			return strings.TrimSpace(cells[i])
+		}
+		return ""
+	}
+
+	for row := 1; ; row++ {
+		cells, err := rdr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if _, ok := err.(*csv.ParseError); !ok {
+				return err
+			}
+			if err := fn(row, nil, err); err != nil {
+				return err
+			}
+			continue
+		}
+
+		rec := &CollectionRecord{
+			Url:         cell(cells, "url"),
+			Title:       cell(cells, "title"),
+			Description: cell(cells, "description"),
+		}
+		if idx := cell(cells, "index"); idx != "" {
+			i, err := strconv.Atoi(idx)
+			if err != nil {
+				if err := fn(row, nil, fmt.Errorf("invalid index: '%s'", idx)); err != nil {
+					return err
+				}
+				continue
+			}
+			rec.Index = &i
+		}
+		if err := fn(row, rec, nil); err != nil {
+			return err
+		}
+	}
+}
+
+func readCollectionJSON(r io.Reader, fn func(row int, rec *CollectionRecord, err error) error) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	var raw []json.RawMessage
+	if err := json.Unmarshal(bytes.TrimSpace(data), &raw); err != nil {
+		return fmt.Errorf("json file must hold an array of records: %s", err.Error())
+	}
+	for i, msg := range raw {
+		rec := &CollectionRecord{}
+		if err := json.Unmarshal(msg, rec); err != nil {
+			err = fn(i+1, nil, fmt.Errorf("invalid record: %s", err.Error()))
+		} else {
+			err = fn(i+1, rec, nil)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readCollectionJSONL(r io.Reader, fn func(row int, rec *CollectionRecord, err error) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxMetadataLineSize)
+	row := 0
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		row++
+		rec := &CollectionRecord{}
+		var err error
+		if jerr := json.Unmarshal([]byte(line), rec); jerr != nil {
+			err = fn(row, nil, fmt.Errorf("invalid json: %s", jerr.Error()))
+		} else {
+			err = fn(row, rec, nil)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
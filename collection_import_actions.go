@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// CollectionImportAct adds the urls listed in a CSV or JSON file to a
+// collection, reporting the outcome of each row
+type CollectionImportAct struct {
+	ReqAction
+	CollectionImport
+	// contents of the file
+	Data string
+}
+
+func (CollectionImportAct) Type() string        { return "COLLECTION_IMPORT_REQUEST" }
+func (CollectionImportAct) SuccessType() string { return "COLLECTION_IMPORT_SUCCESS" }
+func (CollectionImportAct) FailureType() string { return "COLLECTION_IMPORT_FAILURE" }
+
+func (CollectionImportAct) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &CollectionImportAct{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *CollectionImportAct) Exec() (res *ClientResponse) {
+	result, err := a.run()
+	if err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "COLLECTION_IMPORT",
+		Id:        a.CollectionId,
+		Data:      result,
+	}
+}
+
+func (a *CollectionImportAct) run() (*CollectionImportResult, error) {
+	keyId := a.client.keyId()
+	if keyId == "" {
+		return nil, fmt.Errorf("you must be logged in to import into a collection")
+	}
+	if err := requireCollectionRole(appDB, a.CollectionId, keyId, CollectionRoleEditor); err != nil {
+		return nil, err
+	}
+
+	a.keyId = keyId
+	a.userId = a.client.userId()
+	if a.client != nil {
+		a.origin = a.client.origin
+	}
+	return a.CollectionImport.Run(appDB, strings.NewReader(a.Data))
+}
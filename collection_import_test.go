@@ -0,0 +1,88 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadCollectionRecords(t *testing.T) {
+	cases := []struct {
+		format string
+		data   string
+		urls   []string
+		errs   int
+		err    bool
+	}{
+		{CollectionImportCSV, "URL,description,index\nhttp://epa.gov,air,2\nhttp://noaa.gov,,x\nhttps://nasa.gov\n", []string{"http://epa.gov", "https://nasa.gov"}, 1, false},
+		{CollectionImportCSV, "title\nEPA\n", nil, 0, true},
+		{CollectionImportJSON, `[{"url":"http://epa.gov","index":0},{"url":5},{"url":"http://noaa.gov"}]`, []string{"http://epa.gov", "http://noaa.gov"}, 1, false},
+		{CollectionImportJSON, `{"url":"http://epa.gov"}`, nil, 0, true},
+		{CollectionImportJSONL, "{\"url\":\"http://epa.gov\",\"hash\":\"1220\"}\n\n{\"url\":\"http://noaa.gov\"}\n", []string{"http://epa.gov", "http://noaa.gov"}, 0, false},
+		{"xml", "", nil, 0, true},
+	}
+
+	for i, c := range cases {
+		urls := []string{}
+		errs := 0
+		err := ReadCollectionRecords(c.format, strings.NewReader(c.data), func(row int, rec *CollectionRecord, err error) {
+			if err != nil {
+				errs++
+				return
+			}
+			urls = append(urls, rec.Url)
+		})
+		if (err != nil) != c.err {
+			t.Errorf("case %d error mismatch. expected error: %t, got: %v", i, c.err, err)
+			continue
+		}
+		if strings.Join(urls, ",") != strings.Join(c.urls, ",") {
+			t.Errorf("case %d urls mismatch. expected: %v, got: %v", i, c.urls, urls)
+		}
+		if errs != c.errs {
+			t.Errorf("case %d: expected %d row errors, got %d", i, c.errs, errs)
+		}
+	}
+}
+
+func TestReadCollectionRecordsIndex(t *testing.T) {
+	var got []*CollectionRecord
+	err := ReadCollectionRecords(CollectionImportCSV, strings.NewReader("url,index\nhttp://epa.gov,3\nhttp://noaa.gov,\n"), func(row int, rec *CollectionRecord, err error) {
+		got = append(got, rec)
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(got))
+	}
+	if got[0].Index == nil || *got[0].Index != 3 {
+		t.Errorf("expected first record to have index 3")
+	}
+	if got[1].Index != nil {
+		t.Errorf("expected second record to have no index, got: %d", *got[1].Index)
+	}
+}
+
+func TestCollectionImportArchiveSkipped(t *testing.T) {
+	for i := 0; i < cap(collectionImportArchiving); i++ {
+		collectionImportArchiving <- struct{}{}
+	}
+	defer func() {
+		for i := 0; i < cap(collectionImportArchiving); i++ {
+			<-collectionImportArchiving
+		}
+	}()
+
+	imp := &CollectionImport{CollectionId: "test"}
+	res := &CollectionImportResult{}
+	rows := []*CollectionImportRow{{Url: "http://epa.gov"}, {Url: "http://noaa.gov"}}
+	imp.archive(nil, res, rows)
+	if res.ArchiveSkipped != 2 {
+		t.Errorf("expected 2 skipped urls, got %d", res.ArchiveSkipped)
+	}
+	for _, row := range rows {
+		if row.Archiving {
+			t.Errorf("expected %s not to be archiving", row.Url)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/datatogether/core"
+	"github.com/pborman/uuid"
+)
+
+// collection change operations
+const (
+	CollectionOpReorder   = "REORDER"
+	CollectionOpMove      = "MOVE"
+	CollectionOpDuplicate = "DUPLICATE"
+	CollectionOpRestore   = "RESTORE"
+)
+
+// CollectionChange describes a completed change to the items of one or more
+// collections. A single change is published to the topic of every collection
+// it affects as a COLLECTION_CHANGE action
+type CollectionChange struct {
+	Op string `json:"op"`
+	// collections involved in the change, source first for moves & duplicates
+	CollectionIds []string `json:"collectionIds"`
+	// url ids of the items that were changed
+	UrlIds []string `json:"urlIds"`
+	// item order of each affected collection after the change, by collection id
+	Order map[string][]string `json:"order"`
+}
+
+// CollectionTopic is the subscription topic changes to a collection are
+// published to
+func CollectionTopic(collectionId string) string {
+	return "COLLECTION:" + collectionId
+}
+
+// publish sends the change to the topic of each affected collection
+func (ch *CollectionChange) publish() {
+	for _, id := range ch.CollectionIds {
+		room.Publish(CollectionTopic(id), &ClientResponse{
+			Type:      "COLLECTION_CHANGE",
+			RequestId: "server",
+			Schema:    "COLLECTION_CHANGE",
+			Id:        id,
+			Data:      ch,
+		})
+	}
+}
+
+// lockCollections locks collections for the rest of a transaction, in id
+// order so concurrent operations on the same collections can't deadlock
+func lockCollections(tx sqlQueryable, ids ...string) error {
+	sorted := append([]string{}, ids...)
+	sort.Strings(sorted)
+	for _, id := range sorted {
+		var locked string
+		if err := tx.QueryRow(qCollectionLock, id).Scan(&locked); err != nil {
+			if err == sql.ErrNoRows {
+				return core.ErrNotFound
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// readCollectionOrder reads the url ids of a collection's items in order
+func readCollectionOrder(tx sqlQueryable, collectionId string) ([]string, error) {
+	rows, err := tx.Query(qCollectionItemOrder, collectionId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	order := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		order = append(order, id)
+	}
+	return order, rows.Err()
+}
+
+// writeCollectionOrder sets item indexes to their position in order
+func writeCollectionOrder(tx sqlExecable, collectionId string, order []string) error {
+	for i, id := range order {
+		if _, err := tx.Exec(qCollectionItemSetIndex, collectionId, id, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moveInOrder moves id to position to, clamping to the ends of the order
+func moveInOrder(order []string, id string, to int) ([]string, error) {
+	from := -1
+	for i, o := range order {
+		if o == id {
+			from = i
+			break
+		}
+	}
+	if from < 0 {
+		return nil, fmt.Errorf("item %s isn't in the collection", id)
+	}
+
+	moved := make([]string, 0, len(order))
+	moved = append(moved, order[:from]...)
+	moved = append(moved, order[from+1:]...)
+	if to < 0 {
+		to = 0
+	}
+	if to > len(moved) {
+		to = len(moved)
+	}
+	moved = append(moved[:to], append([]string{id}, moved[to:]...)...)
+	return moved, nil
+}
+
+// removeFromOrder drops ids from an order
+func removeFromOrder(order []string, ids []string) []string {
+	remove := map[string]bool{}
+	for _, id := range ids {
+		remove[id] = true
+	}
+	kept := make([]string, 0, len(order))
+	for _, id := range order {
+		if !remove[id] {
+			kept = append(kept, id)
+		}
+	}
+	return kept
+}
+
+// ReorderCollectionItem moves an item to position index in a collection,
+// shifting the items between. indexes of all items are rewritten to be
+// contiguous from zero. the new order is recorded as a version made by keyId
+func ReorderCollectionItem(db *sql.DB, keyId, collectionId, urlId string, index int) (*CollectionChange, error) {
+	ch := &CollectionChange{Op: CollectionOpReorder, CollectionIds: []string{collectionId}, UrlIds: []string{urlId}}
+	err := withTx(db, func(tx sqlQueryExecable) error {
+		if err := lockCollections(tx, collectionId); err != nil {
+			return err
+		}
+		order, err := readCollectionOrder(tx, collectionId)
+		if err != nil {
+			return err
+		}
+		if order, err = moveInOrder(order, urlId, index); err != nil {
+			return err
+		}
+		ch.Order = map[string][]string{collectionId: order}
+		if err := writeCollectionOrder(tx, collectionId, order); err != nil {
+			return err
+		}
+		_, err = RecordCollectionVersion(tx, collectionId, keyId)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ch.publish()
+	return ch, nil
+}
+
+// MoveCollectionItems moves items from one collection to the end of another,
+// keeping their relative order. items already in the destination are removed
+// from the source without changing their place in the destination. both
+// collections are versioned
+func MoveCollectionItems(db *sql.DB, keyId, fromId, toId string, urlIds []string) (*CollectionChange, error) {
+	if fromId == toId {
+		return nil, fmt.Errorf("can't move items to the collection they're in")
+	}
+	if len(urlIds) == 0 {
+		return nil, fmt.Errorf("no items to move")
+	}
+
+	ch := &CollectionChange{Op: CollectionOpMove, CollectionIds: []string{fromId, toId}}
+	err := withTx(db, func(tx sqlQueryExecable) error {
+		if err := lockCollections(tx, fromId, toId); err != nil {
+			return err
+		}
+		from, err := readCollectionOrder(tx, fromId)
+		if err != nil {
+			return err
+		}
+		to, err := readCollectionOrder(tx, toId)
+		if err != nil {
+			return err
+		}
+
+		inFrom, inTo := map[string]bool{}, map[string]bool{}
+		for _, id := range from {
+			inFrom[id] = true
+		}
+		for _, id := range to {
+			inTo[id] = true
+		}
+
+		// move in source order
+		moving := []string{}
+		for _, id := range from {
+			for _, m := range urlIds {
+				if id == m {
+					moving = append(moving, id)
+					break
+				}
+			}
+		}
+		for _, id := range urlIds {
+			if !inFrom[id] {
+				return fmt.Errorf("item %s isn't in collection %s", id, fromId)
+			}
+		}
+
+		for _, id := range moving {
+			if inTo[id] {
+				if _, err := tx.Exec(qCollectionItemDelete, fromId, id); err != nil {
+					return err
+				}
+				continue
+			}
+			if _, err := tx.Exec(qCollectionItemMove, fromId, id, toId, len(to)); err != nil {
+				return err
+			}
+			to = append(to, id)
+		}
+
+		from = removeFromOrder(from, moving)
+		ch.UrlIds = moving
+		ch.Order = map[string][]string{fromId: from, toId: to}
+		if err := writeCollectionOrder(tx, fromId, from); err != nil {
+			return err
+		}
+		if _, err := RecordCollectionVersion(tx, fromId, keyId); err != nil {
+			return err
+		}
+		_, err = RecordCollectionVersion(tx, toId, keyId)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ch.publish()
+	return ch, nil
+}
+
+// DuplicateCollection copies a collection, its schemas & all of its items
+// to a new collection owned by creator. title defaults to the original
+// title with " (copy)" appended
+func DuplicateCollection(db *sql.DB, collectionId, creator, title string) (*core.Collection, *CollectionChange, error) {
+	orig := &core.Collection{Id: collectionId}
+	if err := orig.Read(store); err != nil {
+		return nil, nil, err
+	}
+	if title == "" {
+		title = orig.Title + " (copy)"
+	}
+
+	c := &core.Collection{
+		Id:          uuid.New(),
+		Created:     time.Now().Round(time.Second).In(time.UTC),
+		Creator:     creator,
+		Title:       title,
+		Description: orig.Description,
+		Url:         orig.Url,
+	}
+	c.Updated = c.Created
+
+	ch := &CollectionChange{Op: CollectionOpDuplicate, CollectionIds: []string{orig.Id, c.Id}}
+	err := withTx(db, func(tx sqlQueryExecable) error {
+		if err := lockCollections(tx, orig.Id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(qCollectionDuplicate, orig.Id, c.Id, c.Created, c.Creator, c.Title); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(qCollectionItemsDuplicate, orig.Id, c.Id); err != nil {
+			return err
+		}
+		order, err := readCollectionOrder(tx, c.Id)
+		if err != nil {
+			return err
+		}
+		ch.UrlIds = order
+		ch.Order = map[string][]string{c.Id: order}
+		_, err = RecordCollectionVersion(tx, c.Id, creator)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ch.publish()
+	return c, ch, nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/datatogether/core"
+)
+
+// ReorderCollectionItemAct moves an item to a new position in its collection
+type ReorderCollectionItemAct struct {
+	ReqAction
+	CollectionId string
+	UrlId        string
+	Index        int
+}
+
+func (ReorderCollectionItemAct) Type() string        { return "COLLECTION_REORDER_REQUEST" }
+func (ReorderCollectionItemAct) SuccessType() string { return "COLLECTION_REORDER_SUCCESS" }
+func (ReorderCollectionItemAct) FailureType() string { return "COLLECTION_REORDER_FAILURE" }
+
+func (ReorderCollectionItemAct) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &ReorderCollectionItemAct{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *ReorderCollectionItemAct) Exec() (res *ClientResponse) {
+	ch, err := a.reorder()
+	if err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "COLLECTION_CHANGE",
+		Id:        a.CollectionId,
+		Data:      ch,
+	}
+}
+
+func (a *ReorderCollectionItemAct) reorder() (*CollectionChange, error) {
+	if err := requireCollectionRole(appDB, a.CollectionId, a.client.keyId(), CollectionRoleEditor); err != nil {
+		return nil, err
+	}
+	return ReorderCollectionItem(appDB, a.client.keyId(), a.CollectionId, a.UrlId, a.Index)
+}
+
+// MoveCollectionItemsAct moves items from one collection to another
+type MoveCollectionItemsAct struct {
+	ReqAction
+	FromId string
+	ToId   string
+	UrlIds []string
+}
+
+func (MoveCollectionItemsAct) Type() string        { return "COLLECTION_MOVE_ITEMS_REQUEST" }
+func (MoveCollectionItemsAct) SuccessType() string { return "COLLECTION_MOVE_ITEMS_SUCCESS" }
+func (MoveCollectionItemsAct) FailureType() string { return "COLLECTION_MOVE_ITEMS_FAILURE" }
+
+func (MoveCollectionItemsAct) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &MoveCollectionItemsAct{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *MoveCollectionItemsAct) Exec() (res *ClientResponse) {
+	ch, err := a.move()
+	if err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "COLLECTION_CHANGE",
+		Id:        a.FromId,
+		Data:      ch,
+	}
+}
+
+func (a *MoveCollectionItemsAct) move() (*CollectionChange, error) {
+	keyId := a.client.keyId()
+	if err := requireCollectionRole(appDB, a.FromId, keyId, CollectionRoleEditor); err != nil {
+		return nil, err
+	}
+	if err := requireCollectionRole(appDB, a.ToId, keyId, CollectionRoleEditor); err != nil {
+		return nil, err
+	}
+	return MoveCollectionItems(appDB, keyId, a.FromId, a.ToId, a.UrlIds)
+}
+
+// DuplicateCollectionAct copies a collection & its items to a new collection
+// owned by the requesting user
+type DuplicateCollectionAct struct {
+	ReqAction
+	CollectionId string
+	// title of the copy, defaults to the original title marked as a copy
+	Title string
+}
+
+func (DuplicateCollectionAct) Type() string        { return "COLLECTION_DUPLICATE_REQUEST" }
+func (DuplicateCollectionAct) SuccessType() string { return "COLLECTION_DUPLICATE_SUCCESS" }
+func (DuplicateCollectionAct) FailureType() string { return "COLLECTION_DUPLICATE_FAILURE" }
+
+func (DuplicateCollectionAct) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &DuplicateCollectionAct{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *DuplicateCollectionAct) Exec() (res *ClientResponse) {
+	c, err := a.duplicate()
+	if err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "COLLECTION",
+		Id:        c.Id,
+		Data:      c,
+	}
+}
+
+func (a *DuplicateCollectionAct) duplicate() (*core.Collection, error) {
+	keyId := a.client.keyId()
+	if keyId == "" {
+		return nil, fmt.Errorf("you must be logged in to duplicate a collection")
+	}
+	if err := requireCollectionRole(appDB, a.CollectionId, keyId, CollectionRoleViewer); err != nil {
+		return nil, err
+	}
+	c, _, err := DuplicateCollection(appDB, a.CollectionId, keyId, a.Title)
+	return c, err
+}
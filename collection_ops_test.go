@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMoveInOrder(t *testing.T) {
+	order := []string{"a", "b", "c", "d"}
+	cases := []struct {
+		id     string
+		to     int
+		expect string
+		err    bool
+	}{
+		{"a", 2, "b,c,a,d", false},
+		{"d", 0, "d,a,b,c", false},
+		{"b", 10, "a,c,d,b", false},
+		{"c", -1, "c,a,b,d", false},
+		{"b", 1, "a,b,c,d", false},
+		{"e", 0, "", true},
+	}
+
+	for i, c := range cases {
+		got, err := moveInOrder(order, c.id, c.to)
+		if (err != nil) != c.err {
+			t.Errorf("case %d error mismatch. expected error: %t, got: %v", i, c.err, err)
+			continue
+		}
+		if strings.Join(got, ",") != c.expect {
+			t.Errorf("case %d order mismatch. expected: %s, got: %s", i, c.expect, strings.Join(got, ","))
+		}
+	}
+
+	if strings.Join(order, ",") != "a,b,c,d" {
+		t.Errorf("expected original order to be unchanged, got: %v", order)
+	}
+}
+
+func TestRemoveFromOrder(t *testing.T) {
+	got := removeFromOrder([]string{"a", "b", "c", "d"}, []string{"d", "b", "e"})
+	if strings.Join(got, ",") != "a,c" {
+		t.Errorf("order mismatch. expected: a,c, got: %s", strings.Join(got, ","))
+	}
+}
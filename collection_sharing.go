@@ -0,0 +1,246 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/datatogether/core"
+)
+
+// roles a key can have on a collection. each role can do everything the
+// roles before it can: viewers read, editors change items & details, owners
+// also manage sharing & delete the collection
+const (
+	CollectionRoleViewer = "viewer"
+	CollectionRoleEditor = "editor"
+	CollectionRoleOwner  = "owner"
+)
+
+// collection visibilities
+const (
+	// listed & readable by anyone
+	CollectionPublic = "public"
+	// readable by anyone with the collection's id, but not listed
+	CollectionUnlisted = "unlisted"
+	// only readable by collaborators
+	CollectionPrivate = "private"
+)
+
+// collectionRoleRank orders roles by access, 0 for no role
+func collectionRoleRank(role string) int {
+	switch role {
+	case CollectionRoleViewer:
+		return 1
+	case CollectionRoleEditor:
+		return 2
+	case CollectionRoleOwner:
+		return 3
+	}
+	return 0
+}
+
+func validCollectionRole(role string) error {
+	if collectionRoleRank(role) == 0 {
+		return fmt.Errorf("invalid collection role: '%s'", role)
+	}
+	return nil
+}
+
+func validCollectionVisibility(visibility string) error {
+	switch visibility {
+	case CollectionPublic, CollectionUnlisted, CollectionPrivate:
+		return nil
+	}
+	return fmt.Errorf("invalid collection visibility: '%s'", visibility)
+}
+
+// CollectionAccess is what a key can do with a collection
+type CollectionAccess struct {
+	CollectionId string `json:"collectionId"`
+	KeyId        string `json:"keyId"`
+	Creator      string `json:"creator"`
+	Visibility   string `json:"visibility"`
+	// role of the key, "" if it isn't a collaborator. the creator of a
+	// collection is always an owner
+	Role string `json:"role"`
+}
+
+// ReadCollectionAccess reads the access keyId has to a collection. keyId is
+// "" for anonymous users
+func ReadCollectionAccess(db sqlQueryable, collectionId, keyId string) (*CollectionAccess, error) {
+	a := &CollectionAccess{CollectionId: collectionId, KeyId: keyId}
+	if err := db.QueryRow(qCollectionAccess, collectionId, keyId).Scan(&a.Creator, &a.Visibility, &a.Role); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, core.ErrNotFound
+		}
+		return nil, err
+	}
+	if keyId == "" {
+		a.Role = ""
+	} else if a.Creator == keyId {
+		a.Role = CollectionRoleOwner
+	}
+	return a, nil
+}
+
+// allows reports whether the access includes role. anyone can view
+// collections that aren't private
+func (a *CollectionAccess) allows(role string) bool {
+	if role == CollectionRoleViewer && a.Visibility != CollectionPrivate {
+		return true
+	}
+	return collectionRoleRank(a.Role) >= collectionRoleRank(role)
+}
+
+// require errors if the access doesn't include role. private collections
+// are reported as not found to keys that can't view them
+func (a *CollectionAccess) require(role string) error {
+	if a.allows(role) {
+		return nil
+	}
+	if !a.allows(CollectionRoleViewer) {
+		return core.ErrNotFound
+	}
+	if a.KeyId == "" {
+		return fmt.Errorf("you must be logged in to change a collection")
+	}
+	if role == CollectionRoleOwner {
+		return fmt.Errorf("only owners of a collection can do that")
+	}
+	return fmt.Errorf("you don't have permission to change this collection")
+}
+
+// requireCollectionRole confirms keyId has at least role on a collection
+func requireCollectionRole(db sqlQueryable, collectionId, keyId, role string) error {
+	a, err := ReadCollectionAccess(db, collectionId, keyId)
+	if err != nil {
+		return err
+	}
+	return a.require(role)
+}
+
+// viewableCollection confirms keyId can view a collection, for requests that
+// may or may not be scoped to one. an empty collectionId is always viewable
+func viewableCollection(collectionId, keyId string) error {
+	if collectionId == "" {
+		return nil
+	}
+	return requireCollectionRole(appDB, collectionId, keyId, CollectionRoleViewer)
+}
+
+// CollectionCollaborator is a key that's been given a role on a collection
+type CollectionCollaborator struct {
+	CollectionId string    `json:"collectionId"`
+	KeyId        string    `json:"keyId"`
+	Role         string    `json:"role"`
+	Created      time.Time `json:"created"`
+	Updated      time.Time `json:"updated"`
+}
+
+// ReadCollectionCollaborators lists the keys a collection is shared with,
+// oldest first. the creator isn't included
+func ReadCollectionCollaborators(db sqlQueryable, collectionId string) ([]*CollectionCollaborator, error) {
+	rows, err := db.Query(qCollectionCollaborators, collectionId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collaborators := []*CollectionCollaborator{}
+	for rows.Next() {
+		c := &CollectionCollaborator{}
+		if err := rows.Scan(&c.CollectionId, &c.KeyId, &c.Role, &c.Created, &c.Updated); err != nil {
+			return nil, err
+		}
+		c.Created = c.Created.In(time.UTC)
+		c.Updated = c.Updated.In(time.UTC)
+		collaborators = append(collaborators, c)
+	}
+	return collaborators, rows.Err()
+}
+
+// SetCollectionRole gives keyId role on a collection, adding them as a
+// collaborator if they aren't one already
+func SetCollectionRole(db *sql.DB, collectionId, keyId, role string) (*CollectionCollaborator, error) {
+	if keyId == "" {
+		return nil, fmt.Errorf("keyId is required")
+	}
+	if err := validCollectionRole(role); err != nil {
+		return nil, err
+	}
+
+	c := &CollectionCollaborator{
+		CollectionId: collectionId,
+		KeyId:        keyId,
+		Role:         role,
+		Updated:      time.Now().Round(time.Second).In(time.UTC),
+	}
+	err := withTx(db, func(tx sqlQueryExecable) error {
+		if err := lockCollections(tx, collectionId); err != nil {
+			return err
+		}
+		a, err := ReadCollectionAccess(tx, collectionId, keyId)
+		if err != nil {
+			return err
+		}
+		if a.Creator == keyId {
+			return fmt.Errorf("the creator of a collection is always an owner")
+		}
+
+		res, err := tx.Exec(qCollectionCollaboratorUpdate, collectionId, keyId, role, c.Updated)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return tx.QueryRow(qCollectionCollaboratorCreated, collectionId, keyId).Scan(&c.Created)
+		}
+
+		c.Created = c.Updated
+		_, err = tx.Exec(qCollectionCollaboratorInsert, collectionId, keyId, role, c.Created)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// RemoveCollectionCollaborator takes away keyId's role on a collection
+func RemoveCollectionCollaborator(db sqlExecable, collectionId, keyId string) error {
+	res, err := db.Exec(qCollectionCollaboratorDelete, collectionId, keyId)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return core.ErrNotFound
+	}
+	return nil
+}
+
+// SetCollectionVisibility changes who can read a collection
+func SetCollectionVisibility(db sqlExecable, collectionId, visibility string) error {
+	if err := validCollectionVisibility(visibility); err != nil {
+		return err
+	}
+	res, err := db.Exec(qCollectionVisibilityUpdate, collectionId, visibility, time.Now().Round(time.Second).In(time.UTC))
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return core.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/datatogether/core"
+)
+
+// CollectionSharing describes who can read & change a collection
+type CollectionSharing struct {
+	// access of the requesting key
+	Access        *CollectionAccess         `json:"access"`
+	Collaborators []*CollectionCollaborator `json:"collaborators"`
+}
+
+// CollectionSharingAct reads a collection's visibility, collaborators & the
+// requesting user's role
+type CollectionSharingAct struct {
+	ReqAction
+	CollectionId string
+}
+
+func (CollectionSharingAct) Type() string        { return "COLLECTION_SHARING_REQUEST" }
+func (CollectionSharingAct) SuccessType() string { return "COLLECTION_SHARING_SUCCESS" }
+func (CollectionSharingAct) FailureType() string { return "COLLECTION_SHARING_FAILURE" }
+
+func (CollectionSharingAct) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &CollectionSharingAct{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *CollectionSharingAct) Exec() (res *ClientResponse) {
+	s, err := readCollectionSharing(a.CollectionId, a.client.keyId())
+	if err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "COLLECTION_SHARING",
+		Id:        a.CollectionId,
+		Data:      s,
+	}
+}
+
+// readCollectionSharing reads the sharing details of a collection keyId can view
+func readCollectionSharing(collectionId, keyId string) (*CollectionSharing, error) {
+	access, err := ReadCollectionAccess(appDB, collectionId, keyId)
+	if err != nil {
+		return nil, err
+	}
+	if err := access.require(CollectionRoleViewer); err != nil {
+		return nil, err
+	}
+	collaborators, err := ReadCollectionCollaborators(appDB, collectionId)
+	if err != nil {
+		return nil, err
+	}
+	return &CollectionSharing{Access: access, Collaborators: collaborators}, nil
+}
+
+// ShareCollectionAct gives a key a role on a collection. only owners can
+// share a collection
+type ShareCollectionAct struct {
+	ReqAction
+	CollectionId string
+	KeyId        string
+	Role         string
+}
+
+func (ShareCollectionAct) Type() string        { return "COLLECTION_SHARE_REQUEST" }
+func (ShareCollectionAct) SuccessType() string { return "COLLECTION_SHARE_SUCCESS" }
+func (ShareCollectionAct) FailureType() string { return "COLLECTION_SHARE_FAILURE" }
+
+func (ShareCollectionAct) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &ShareCollectionAct{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *ShareCollectionAct) Exec() (res *ClientResponse) {
+	s, err := a.share()
+	if err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "COLLECTION_SHARING",
+		Id:        a.CollectionId,
+		Data:      s,
+	}
+}
+
+func (a *ShareCollectionAct) share() (*CollectionSharing, error) {
+	keyId := a.client.keyId()
+	if err := requireCollectionRole(appDB, a.CollectionId, keyId, CollectionRoleOwner); err != nil {
+		return nil, err
+	}
+	if _, err := SetCollectionRole(appDB, a.CollectionId, a.KeyId, a.Role); err != nil {
+		return nil, err
+	}
+	return readCollectionSharing(a.CollectionId, keyId)
+}
+
+// UnshareCollectionAct removes a collaborator from a collection. owners can
+// remove anyone, other collaborators can only remove themselves
+type UnshareCollectionAct struct {
+	ReqAction
+	CollectionId string
+	KeyId        string
+}
+
+func (UnshareCollectionAct) Type() string        { return "COLLECTION_UNSHARE_REQUEST" }
+func (UnshareCollectionAct) SuccessType() string { return "COLLECTION_UNSHARE_SUCCESS" }
+func (UnshareCollectionAct) FailureType() string { return "COLLECTION_UNSHARE_FAILURE" }
+
+func (UnshareCollectionAct) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &UnshareCollectionAct{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *UnshareCollectionAct) Exec() (res *ClientResponse) {
+	if err := a.unshare(); err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "COLLECTION_COLLABORATOR",
+		Id:        a.CollectionId,
+		Data:      &CollectionCollaborator{CollectionId: a.CollectionId, KeyId: a.KeyId},
+	}
+}
+
+func (a *UnshareCollectionAct) unshare() error {
+	keyId := a.client.keyId()
+	if keyId == "" {
+		return fmt.Errorf("you must be logged in to change a collection")
+	}
+	if a.KeyId != keyId {
+		if err := requireCollectionRole(appDB, a.CollectionId, keyId, CollectionRoleOwner); err != nil {
+			return err
+		}
+	}
+	return RemoveCollectionCollaborator(appDB, a.CollectionId, a.KeyId)
+}
+
+// CollectionVisibilityAct sets a collection to public, unlisted or private.
+// only owners can change visibility
+type CollectionVisibilityAct struct {
+	ReqAction
+	CollectionId string
+	Visibility   string
+}
+
+func (CollectionVisibilityAct) Type() string        { return "COLLECTION_VISIBILITY_REQUEST" }
+func (CollectionVisibilityAct) SuccessType() string { return "COLLECTION_VISIBILITY_SUCCESS" }
+func (CollectionVisibilityAct) FailureType() string { return "COLLECTION_VISIBILITY_FAILURE" }
+
+func (CollectionVisibilityAct) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &CollectionVisibilityAct{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *CollectionVisibilityAct) Exec() (res *ClientResponse) {
+	s, err := a.set()
+	if err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "COLLECTION_SHARING",
+		Id:        a.CollectionId,
+		Data:      s,
+	}
+}
+
+func (a *CollectionVisibilityAct) set() (*CollectionSharing, error) {
+	keyId := a.client.keyId()
+	if err := requireCollectionRole(appDB, a.CollectionId, keyId, CollectionRoleOwner); err != nil {
+		return nil, err
+	}
+	if err := SetCollectionVisibility(appDB, a.CollectionId, a.Visibility); err != nil {
+		return nil, err
+	}
+	return readCollectionSharing(a.CollectionId, keyId)
+}
+
+// SharedCollectionsAct grabs a page of the collections shared with the
+// current user
+type SharedCollectionsAct struct {
+	ReqAction
+	PageParams
+}
+
+func (SharedCollectionsAct) Type() string        { return "SHARED_COLLECTIONS_REQUEST" }
+func (SharedCollectionsAct) SuccessType() string { return "SHARED_COLLECTIONS_SUCCESS" }
+func (SharedCollectionsAct) FailureType() string { return "SHARED_COLLECTIONS_FAILURE" }
+
+func (SharedCollectionsAct) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &SharedCollectionsAct{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *SharedCollectionsAct) Exec() (res *ClientResponse) {
+	collections, page, err := a.read()
+	if err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return page.respond(&a.PageParams, &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "COLLECTION_ARRAY",
+		Data:      collections,
+	})
+}
+
+func (a *SharedCollectionsAct) read() ([]*core.Collection, *Page, error) {
+	keyId := a.client.keyId()
+	if keyId == "" {
+		return nil, nil, fmt.Errorf("you must be logged in to list shared collections")
+	}
+	return ListSharedCollectionsPage(appDB, keyId, &a.PageParams)
+}
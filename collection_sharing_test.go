@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/datatogether/core"
+)
+
+func TestCollectionAccessAllows(t *testing.T) {
+	cases := []struct {
+		visibility, role string
+		view, edit, own  bool
+	}{
+		{CollectionPublic, "", true, false, false},
+		{CollectionUnlisted, "", true, false, false},
+		{CollectionPrivate, "", false, false, false},
+		{CollectionPrivate, CollectionRoleViewer, true, false, false},
+		{CollectionPrivate, CollectionRoleEditor, true, true, false},
+		{CollectionPublic, CollectionRoleEditor, true, true, false},
+		{CollectionPrivate, CollectionRoleOwner, true, true, true},
+	}
+
+	for i, c := range cases {
+		a := &CollectionAccess{Visibility: c.visibility, Role: c.role}
+		if got := a.allows(CollectionRoleViewer); got != c.view {
+			t.Errorf("case %d view mismatch. expected: %t, got: %t", i, c.view, got)
+		}
+		if got := a.allows(CollectionRoleEditor); got != c.edit {
+			t.Errorf("case %d edit mismatch. expected: %t, got: %t", i, c.edit, got)
+		}
+		if got := a.allows(CollectionRoleOwner); got != c.own {
+			t.Errorf("case %d own mismatch. expected: %t, got: %t", i, c.own, got)
+		}
+	}
+}
+
+func TestCollectionAccessRequire(t *testing.T) {
+	private := &CollectionAccess{KeyId: "key", Visibility: CollectionPrivate}
+	if err := private.require(CollectionRoleEditor); err != core.ErrNotFound {
+		t.Errorf("expected private collections to be not found, got: %v", err)
+	}
+
+	public := &CollectionAccess{KeyId: "key", Visibility: CollectionPublic, Role: CollectionRoleEditor}
+	if err := public.require(CollectionRoleEditor); err != nil {
+		t.Errorf("expected editor to be allowed to edit, got: %s", err.Error())
+	}
+	if err := public.require(CollectionRoleOwner); err == nil || err == core.ErrNotFound {
+		t.Errorf("expected editor to be denied ownership, got: %v", err)
+	}
+}
+
+func TestValidCollectionSharing(t *testing.T) {
+	for _, role := range []string{CollectionRoleViewer, CollectionRoleEditor, CollectionRoleOwner} {
+		if err := validCollectionRole(role); err != nil {
+			t.Errorf("expected role %s to be valid, got: %s", role, err.Error())
+		}
+	}
+	if err := validCollectionRole("admin"); err == nil {
+		t.Errorf("expected invalid role to error")
+	}
+
+	for _, v := range []string{CollectionPublic, CollectionUnlisted, CollectionPrivate} {
+		if err := validCollectionVisibility(v); err != nil {
+			t.Errorf("expected visibility %s to be valid, got: %s", v, err.Error())
+		}
+	}
+	if err := validCollectionVisibility(""); err == nil {
+		t.Errorf("expected empty visibility to error")
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/datatogether/core"
+)
+
+// CollectionVersionsAct grabs a page of a collection's versions, latest first
+type CollectionVersionsAct struct {
+	ReqAction
+	PageParams
+	CollectionId string
+}
+
+func (CollectionVersionsAct) Type() string        { return "COLLECTION_VERSIONS_REQUEST" }
+func (CollectionVersionsAct) SuccessType() string { return "COLLECTION_VERSIONS_SUCCESS" }
+func (CollectionVersionsAct) FailureType() string { return "COLLECTION_VERSIONS_FAILURE" }
+
+func (CollectionVersionsAct) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &CollectionVersionsAct{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *CollectionVersionsAct) Exec() (res *ClientResponse) {
+	versions, page, err := a.read()
+	if err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return page.respond(&a.PageParams, &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "COLLECTION_VERSION_ARRAY",
+		Id:        a.CollectionId,
+		Data:      versions,
+	})
+}
+
+func (a *CollectionVersionsAct) read() ([]*CollectionVersion, *Page, error) {
+	if err := requireCollectionRole(appDB, a.CollectionId, a.client.keyId(), CollectionRoleViewer); err != nil {
+		return nil, nil, err
+	}
+	return ListCollectionVersionsPage(appDB, a.CollectionId, &a.PageParams)
+}
+
+// CollectionVersionAct fetches a collection as of a version, either by
+// version hash or as it was at a point in time
+type CollectionVersionAct struct {
+	ReqAction
+	Hash         string
+	CollectionId string
+	At           *time.Time
+}
+
+func (CollectionVersionAct) Type() string        { return "COLLECTION_VERSION_REQUEST" }
+func (CollectionVersionAct) SuccessType() string { return "COLLECTION_VERSION_SUCCESS" }
+func (CollectionVersionAct) FailureType() string { return "COLLECTION_VERSION_FAILURE" }
+
+func (CollectionVersionAct) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &CollectionVersionAct{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *CollectionVersionAct) Exec() (res *ClientResponse) {
+	v, err := a.read()
+	if err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "COLLECTION_VERSION",
+		Id:        v.Hash,
+		Data:      v,
+	}
+}
+
+func (a *CollectionVersionAct) read() (v *CollectionVersion, err error) {
+	if a.Hash != "" {
+		if v, err = ReadCollectionVersion(appDB, a.Hash); err != nil {
+			return nil, err
+		}
+		if err := v.validate(a.CollectionId); err != nil {
+			return nil, err
+		}
+	} else if a.CollectionId == "" {
+		return nil, fmt.Errorf("hash or collectionId is required")
+	} else {
+		at := time.Now()
+		if a.At != nil {
+			at = *a.At
+		}
+		if v, err = ReadCollectionVersionAt(appDB, a.CollectionId, at); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := requireCollectionRole(appDB, v.CollectionId, a.client.keyId(), CollectionRoleViewer); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// RestoreCollectionVersionAct sets a collection back to the state recorded in
+// one of its versions
+type RestoreCollectionVersionAct struct {
+	ReqAction
+	CollectionId string
+	Hash         string
+}
+
+func (RestoreCollectionVersionAct) Type() string        { return "COLLECTION_RESTORE_REQUEST" }
+func (RestoreCollectionVersionAct) SuccessType() string { return "COLLECTION_RESTORE_SUCCESS" }
+func (RestoreCollectionVersionAct) FailureType() string { return "COLLECTION_RESTORE_FAILURE" }
+
+func (RestoreCollectionVersionAct) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &RestoreCollectionVersionAct{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *RestoreCollectionVersionAct) Exec() (res *ClientResponse) {
+	v, err := a.restore()
+	if err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "COLLECTION_VERSION",
+		Id:        v.Hash,
+		Data:      v,
+	}
+}
+
+func (a *RestoreCollectionVersionAct) restore() (*CollectionVersion, error) {
+	v, err := ReadCollectionVersion(appDB, a.Hash)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.validate(a.CollectionId); err != nil {
+		return nil, err
+	}
+
+	keyId := a.client.keyId()
+	if err := requireCollectionRole(appDB, v.CollectionId, keyId, CollectionRoleEditor); err != nil {
+		if err == core.ErrNotFound {
+			return nil, fmt.Errorf("collection %s no longer exists", v.CollectionId)
+		}
+		return nil, err
+	}
+	return RestoreCollectionVersion(appDB, v.Hash, keyId)
+}
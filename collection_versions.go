@@ -0,0 +1,374 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/datatogether/core"
+	"github.com/pborman/uuid"
+)
+
+// CollectionVersion is an immutable record of the state of a collection & its
+// items. Versions form a chain through Prev, much like metadata. Hash is the
+// multihash of the version's contents including Prev & Created, so a version
+// hash identifies a single, stable state of a collection that can be cited
+type CollectionVersion struct {
+	Hash         string    `json:"hash"`
+	CollectionId string    `json:"collectionId"`
+	Prev         string    `json:"prev"`
+	Created      time.Time `json:"created"`
+	// key of the user that made the change this version records
+	KeyId string `json:"keyId"`
+	// hash of the version this version was restored from, if any
+	RestoredFrom string `json:"restoredFrom,omitempty"`
+
+	Creator     string `json:"creator"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Url         string `json:"url"`
+	// items in collection order. not set when listing versions
+	Items     []*CollectionVersionItem `json:"items,omitempty"`
+	ItemCount int                      `json:"itemCount"`
+}
+
+// CollectionVersionItem is an item of a collection version
+type CollectionVersionItem struct {
+	UrlId       string `json:"urlId"`
+	Url         string `json:"url"`
+	Hash        string `json:"hash,omitempty"`
+	Index       int    `json:"index"`
+	Description string `json:"description,omitempty"`
+}
+
+// HashableBytes gives the bytes a version hash is calculated from
+func (v *CollectionVersion) HashableBytes() ([]byte, error) {
+	return json.Marshal(&struct {
+		CollectionId string                   `json:"collectionId"`
+		Prev         string                   `json:"prev"`
+		Created      string                   `json:"created"`
+		KeyId        string                   `json:"keyId"`
+		RestoredFrom string                   `json:"restoredFrom"`
+		Creator      string                   `json:"creator"`
+		Title        string                   `json:"title"`
+		Description  string                   `json:"description"`
+		Url          string                   `json:"url"`
+		Items        []*CollectionVersionItem `json:"items"`
+	}{
+		CollectionId: v.CollectionId,
+		Prev:         v.Prev,
+		Created:      v.Created.In(time.UTC).Format(time.RFC3339Nano),
+		KeyId:        v.KeyId,
+		RestoredFrom: v.RestoredFrom,
+		Creator:      v.Creator,
+		Title:        v.Title,
+		Description:  v.Description,
+		Url:          v.Url,
+		Items:        v.Items,
+	})
+}
+
+// calcHash sets the version's hash from its contents
+func (v *CollectionVersion) calcHash() error {
+	data, err := v.HashableBytes()
+	if err != nil {
+		return err
+	}
+	v.Hash, err = core.CalcHash(data)
+	return err
+}
+
+// sameState reports whether two versions record the same collection state
+func (v *CollectionVersion) sameState(b *CollectionVersion) bool {
+	if v.Creator != b.Creator || v.Title != b.Title || v.Description != b.Description || v.Url != b.Url || len(v.Items) != len(b.Items) {
+		return false
+	}
+	for i, item := range v.Items {
+		if *item != *b.Items[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// readCollectionState reads the current state of a collection into a new,
+// unsaved version
+func readCollectionState(db sqlQueryable, collectionId string) (*CollectionVersion, error) {
+	v := &CollectionVersion{CollectionId: collectionId}
+	if err := db.QueryRow(qCollectionVersionState, collectionId).Scan(&v.Creator, &v.Title, &v.Description, &v.Url); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, core.ErrNotFound
+		}
+		return nil, err
+	}
+
+	rows, err := db.Query(qCollectionVersionItems, collectionId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	v.Items = []*CollectionVersionItem{}
+	for rows.Next() {
+		i := &CollectionVersionItem{}
+		if err := rows.Scan(&i.UrlId, &i.Url, &i.Hash, &i.Index, &i.Description); err != nil {
+			return nil, err
+		}
+		v.Items = append(v.Items, i)
+	}
+	v.ItemCount = len(v.Items)
+	return v, rows.Err()
+}
+
+// RecordCollectionVersion records the current state of a collection as a new
+// version made by keyId. if the state matches the latest version no version
+// is recorded & the latest version is returned
+func RecordCollectionVersion(db sqlQueryExecable, collectionId, keyId string) (*CollectionVersion, error) {
+	return recordCollectionVersion(db, collectionId, keyId, "")
+}
+
+func recordCollectionVersion(db sqlQueryExecable, collectionId, keyId, restoredFrom string) (*CollectionVersion, error) {
+	v, err := readCollectionState(db, collectionId)
+	if err != nil {
+		return nil, err
+	}
+
+	// callers hold the collection's lock, so the head can't move until the
+	// new version is recorded
+	latest, err := scanCollectionVersion(db.QueryRow(qCollectionVersionHead, collectionId))
+	if err != nil && err != core.ErrNotFound {
+		return nil, err
+	}
+	if latest != nil {
+		if restoredFrom == "" && v.sameState(latest) {
+			return latest, nil
+		}
+		v.Prev = latest.Hash
+	}
+
+	// round to the second, as postgres would truncate the hashed time
+	v.Created = time.Now().Round(time.Second).In(time.UTC)
+	v.KeyId = keyId
+	v.RestoredFrom = restoredFrom
+	if err := v.calcHash(); err != nil {
+		return nil, err
+	}
+
+	items, err := json.Marshal(v.Items)
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.Exec(qCollectionVersionInsert, v.Hash, v.CollectionId, v.Prev, v.Created, v.KeyId, v.RestoredFrom,
+		v.Creator, v.Title, v.Description, v.Url, items)
+	return v, err
+}
+
+// changeCollection locks a collection, makes a change & records the result
+// as a version made by keyId in a single transaction, so concurrent changes
+// can't both build on the same previous version
+func changeCollection(db *sql.DB, collectionId, keyId string, change func(tx sqlQueryExecable) error) error {
+	return withTx(db, func(tx sqlQueryExecable) error {
+		if err := lockCollections(tx, collectionId); err != nil {
+			return err
+		}
+		if err := change(tx); err != nil {
+			return err
+		}
+		_, err := RecordCollectionVersion(tx, collectionId, keyId)
+		return err
+	})
+}
+
+// SaveCollection updates a collection's fields, or creates it if it has no
+// id or its id isn't known, recording the change as a version made by keyId.
+// as with core, new collections are given a new id
+func SaveCollection(db *sql.DB, c *core.Collection, keyId string) error {
+	now := time.Now().Round(time.Second).In(time.UTC)
+	if c.Id != "" {
+		err := changeCollection(db, c.Id, keyId, func(tx sqlQueryExecable) error {
+			c.Updated = now
+			return tx.QueryRow(qCollectionUpdateFields, c.Id, c.Updated, c.Creator, c.Title, c.Description, c.Url).Scan(&c.Created)
+		})
+		if err != core.ErrNotFound {
+			c.Created = c.Created.In(time.UTC)
+			return err
+		}
+	}
+
+	c.Id = uuid.New()
+	c.Created, c.Updated = now, now
+	return withTx(db, func(tx sqlQueryExecable) error {
+		if _, err := tx.Exec(qCollectionInsert, c.Id, c.Created, c.Updated, c.Creator, c.Title, c.Description, c.Url); err != nil {
+			return err
+		}
+		_, err := RecordCollectionVersion(tx, c.Id, keyId)
+		return err
+	})
+}
+
+// SaveCollectionItems adds items to a collection, or updates the index &
+// description of items already in it, recording the change as a version made
+// by keyId. item urls are saved first, as core does
+func SaveCollectionItems(db *sql.DB, collectionId, keyId string, items []*core.CollectionItem) error {
+	for _, item := range items {
+		if err := item.Url.Save(store); err != nil {
+			return err
+		}
+	}
+	return changeCollection(db, collectionId, keyId, func(tx sqlQueryExecable) error {
+		for _, item := range items {
+			if err := saveCollectionItem(tx, collectionId, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// saveCollectionItem updates an item in a collection, inserting it if the
+// collection doesn't have it yet
+func saveCollectionItem(tx sqlExecable, collectionId string, item *core.CollectionItem) error {
+	res, err := tx.Exec(qCollectionItemUpdate, collectionId, item.Url.Id, item.Index, item.Description)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		_, err = tx.Exec(qCollectionItemInsert, collectionId, item.Url.Id, item.Index, item.Description)
+	}
+	return err
+}
+
+// DeleteCollectionItems removes items from a collection, recording the change
+// as a version made by keyId
+func DeleteCollectionItems(db *sql.DB, collectionId, keyId string, items []*core.CollectionItem) error {
+	return changeCollection(db, collectionId, keyId, func(tx sqlQueryExecable) error {
+		for _, item := range items {
+			if _, err := tx.Exec(qCollectionItemDelete, collectionId, item.Url.Id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ReadCollectionVersion reads a version by hash
+func ReadCollectionVersion(db sqlQueryable, hash string) (*CollectionVersion, error) {
+	return scanCollectionVersion(db.QueryRow(qCollectionVersionByHash, hash))
+}
+
+// ReadCollectionVersionAt reads the version of a collection that was current
+// at time t
+func ReadCollectionVersionAt(db sqlQueryable, collectionId string, t time.Time) (*CollectionVersion, error) {
+	return scanCollectionVersion(db.QueryRow(qCollectionVersionAt, collectionId, t.In(time.UTC)))
+}
+
+func scanCollectionVersion(row sqlScannable) (*CollectionVersion, error) {
+	v := &CollectionVersion{}
+	var items []byte
+	if err := row.Scan(&v.Hash, &v.CollectionId, &v.Prev, &v.Created, &v.KeyId, &v.RestoredFrom,
+		&v.Creator, &v.Title, &v.Description, &v.Url, &items); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, core.ErrNotFound
+		}
+		return nil, err
+	}
+	v.Created = v.Created.In(time.UTC)
+	if items != nil {
+		if err := json.Unmarshal(items, &v.Items); err != nil {
+			return nil, err
+		}
+	}
+	v.ItemCount = len(v.Items)
+	return v, nil
+}
+
+// RestoreCollectionVersion sets a collection's fields & items back to the
+// state recorded in a version, recording the restored state as a new version.
+// items whose url no longer exists are skipped
+func RestoreCollectionVersion(db *sql.DB, hash, keyId string) (*CollectionVersion, error) {
+	var restored *CollectionVersion
+	err := withTx(db, func(tx sqlQueryExecable) error {
+		v, err := ReadCollectionVersion(tx, hash)
+		if err != nil {
+			return err
+		}
+		if err := lockCollections(tx, v.CollectionId); err != nil {
+			return err
+		}
+
+		now := time.Now().Round(time.Second).In(time.UTC)
+		if _, err := tx.Exec(qCollectionRestore, v.CollectionId, now, v.Title, v.Description, v.Url); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(qCollectionItemsClear, v.CollectionId); err != nil {
+			return err
+		}
+		for _, i := range v.Items {
+			var exists bool
+			if err := tx.QueryRow(qUrlIdExists, i.UrlId).Scan(&exists); err != nil {
+				return err
+			}
+			if !exists {
+				continue
+			}
+			if _, err := tx.Exec(qCollectionItemInsert, v.CollectionId, i.UrlId, i.Index, i.Description); err != nil {
+				return err
+			}
+		}
+
+		restored, err = recordCollectionVersion(tx, v.CollectionId, keyId, v.Hash)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	order := make([]string, len(restored.Items))
+	for i, item := range restored.Items {
+		order[i] = item.UrlId
+	}
+	ch := &CollectionChange{
+		Op:            CollectionOpRestore,
+		CollectionIds: []string{restored.CollectionId},
+		UrlIds:        order,
+		Order:         map[string][]string{restored.CollectionId: order},
+	}
+	ch.publish()
+	return restored, nil
+}
+
+// ListCollectionVersionsPage reads a page of a collection's versions, latest
+// first. versions are listed without their items
+func ListCollectionVersionsPage(db sqlQueryable, collectionId string, p *PageParams) ([]*CollectionVersion, *Page, error) {
+	results, page, err := readKeysetPage(db, collectionVersionsKeyset, p, func(rows *sql.Rows) (interface{}, Cursor, error) {
+		v := &CollectionVersion{}
+		var seq int
+		err := rows.Scan(&v.Hash, &v.CollectionId, &v.Prev, &v.Created, &v.KeyId, &v.RestoredFrom,
+			&v.Creator, &v.Title, &v.Description, &v.Url, &v.ItemCount, &seq)
+		v.Created = v.Created.In(time.UTC)
+		return v, Cursor{Sort: cursorTime(v.Created), Id: strconv.Itoa(seq)}, err
+	}, collectionId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	versions := make([]*CollectionVersion, len(results))
+	for i, r := range results {
+		versions[i] = r.(*CollectionVersion)
+	}
+	return versions, page, nil
+}
+
+// validate confirms a version belongs to a collection
+func (v *CollectionVersion) validate(collectionId string) error {
+	if collectionId != "" && v.CollectionId != collectionId {
+		return fmt.Errorf("version %s isn't a version of collection %s", v.Hash, collectionId)
+	}
+	return nil
+}
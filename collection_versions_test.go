@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCollectionVersionHash(t *testing.T) {
+	v := &CollectionVersion{
+		CollectionId: "a",
+		Created:      time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+		Title:        "collection",
+		Items: []*CollectionVersionItem{
+			{UrlId: "1", Url: "http://a.com", Index: 0},
+			{UrlId: "2", Url: "http://b.com", Index: 1},
+		},
+	}
+	if err := v.calcHash(); err != nil {
+		t.Fatal(err)
+	}
+	hash := v.Hash
+
+	// hashes don't depend on the timezone created is read in
+	v.Created = v.Created.In(time.FixedZone("EST", -5*60*60))
+	if err := v.calcHash(); err != nil {
+		t.Fatal(err)
+	}
+	if v.Hash != hash {
+		t.Errorf("expected hash to be stable across timezones. %s != %s", v.Hash, hash)
+	}
+
+	v.Prev = hash
+	if err := v.calcHash(); err != nil {
+		t.Fatal(err)
+	}
+	if v.Hash == hash {
+		t.Errorf("expected changing prev to change the hash")
+	}
+}
+
+func TestCollectionVersionSameState(t *testing.T) {
+	items := func(ids ...string) []*CollectionVersionItem {
+		is := make([]*CollectionVersionItem, len(ids))
+		for i, id := range ids {
+			is[i] = &CollectionVersionItem{UrlId: id, Index: i}
+		}
+		return is
+	}
+
+	a := &CollectionVersion{Hash: "a", Created: time.Now(), Title: "t", Items: items("1", "2")}
+	cases := []struct {
+		b      *CollectionVersion
+		expect bool
+	}{
+		{&CollectionVersion{Hash: "b", Title: "t", Items: items("1", "2")}, true},
+		{&CollectionVersion{Title: "t", KeyId: "other", Items: items("1", "2")}, true},
+		{&CollectionVersion{Title: "u", Items: items("1", "2")}, false},
+		{&CollectionVersion{Title: "t", Items: items("2", "1")}, false},
+		{&CollectionVersion{Title: "t", Items: items("1")}, false},
+	}
+
+	for i, c := range cases {
+		if got := a.sameState(c.b); got != c.expect {
+			t.Errorf("case %d mismatch. expected: %t, got: %t", i, c.expect, got)
+		}
+	}
+}
+
+func TestRecordCollectionVersionSameSecond(t *testing.T) {
+	id := "a73a9d04-0fdb-40c8-a97f-288af36e8f6f"
+	defer func() {
+		appDB.Exec("UPDATE collections SET title = 'Test Collection' WHERE id = $1", id)
+		appDB.Exec("DELETE FROM collection_versions WHERE collection_id = $1", id)
+	}()
+
+	// record versions faster than created times can tell apart
+	prev := ""
+	var head *CollectionVersion
+	for i := 0; i < 3; i++ {
+		if _, err := appDB.Exec("UPDATE collections SET title = $2 WHERE id = $1", id, fmt.Sprintf("Test Collection %d", i)); err != nil {
+			t.Fatal(err.Error())
+		}
+		v, err := RecordCollectionVersion(appDB, id, "key")
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if v.Prev != prev {
+			t.Errorf("version %d prev mismatch. expected: %s, got: %s", i, prev, v.Prev)
+		}
+		prev, head = v.Hash, v
+	}
+
+	got, err := ReadCollectionVersionAt(appDB, id, head.Created)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if got.Hash != head.Hash {
+		t.Errorf("expected latest version %s, got: %s", head.Hash, got.Hash)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	conf "github.com/datatogether/config"
+	"github.com/datatogether/core"
 	"html/template"
 	"os"
 	"path/filepath"
@@ -50,6 +51,11 @@ type config struct {
 
 	// Public Key to use for signing metablocks. required.
 	PublicKey string
+	// PEM-encoded RSA private key matching PublicKey. when set metadata
+	// written by logged in users without a signature is signed with this key
+	PrivateKey string
+	// key ids of users allowed to create, change & delete primers & sources
+	AdminKeys []string
 
 	// TLS (HTTPS) enable support via LetsEncrypt, default false
 	// should be true in production
@@ -83,6 +89,9 @@ type config struct {
 	// if true, requests that have X-Forwarded-Proto: http will be redirected
 	// to their https variant
 	ProxyForceHttps bool
+	// addresses of reverse proxies in front of the server. the X-Forwarded-For
+	// header is only trusted on requests from these addresses
+	TrustedProxies []string
 	// Segment Analytics API token for server-side analytics
 	SegmentApiToken string
 	// list of urls to webapp entry point(s)
@@ -135,6 +144,26 @@ func initConfig(mode string) (cfg *config, err error) {
 	return
 }
 
+// setCoreAwsConfig copies any configured AWS settings into the core package,
+// which otherwise reads them from the environment on init
+func setCoreAwsConfig(cfg *config) {
+	if cfg.AwsRegion != "" {
+		core.AwsRegion = cfg.AwsRegion
+	}
+	if cfg.AwsAccessKeyId != "" {
+		core.AwsAccessKeyId = cfg.AwsAccessKeyId
+	}
+	if cfg.AwsSecretAccessKey != "" {
+		core.AwsSecretAccessKey = cfg.AwsSecretAccessKey
+	}
+	if cfg.AwsS3BucketName != "" {
+		core.AwsS3BucketName = cfg.AwsS3BucketName
+	}
+	if cfg.AwsS3BucketPath != "" {
+		core.AwsS3BucketPath = cfg.AwsS3BucketPath
+	}
+}
+
 func packagePath(path string) string {
 	return filepath.Join(os.Getenv("GOPATH"), "src/github.com/datatogether/patchbay", path)
 }
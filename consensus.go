@@ -0,0 +1,289 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/datatogether/core"
+)
+
+// Consensus strategies
+const (
+	// value given by the most keys wins
+	ConsensusMajority = "majority"
+	// value with the greatest total key weight wins. weights come from a
+	// trust list if one is given, otherwise from key reputation
+	ConsensusWeighted = "weighted"
+	// value from the most recently written metadata wins
+	ConsensusRecent = "recent"
+	// value given by the most keys wins, so long as at least Threshold
+	// keys agree on it
+	ConsensusThreshold = "threshold"
+)
+
+// defaultConsensusThreshold is the number of agreeing keys threshold
+// consensus needs when no threshold is set
+const defaultConsensusThreshold = 2
+
+// ConsensusOptions configures how consensus on a subject's metadata is
+// reached. Primers set options for their content in Meta["consensus"]
+type ConsensusOptions struct {
+	Strategy string `json:"strategy"`
+	// trust list of key weights for weighted consensus. when set, keys not
+	// in the list have no say
+	Trusted map[string]float64 `json:"trusted,omitempty"`
+	// number of keys that must agree on a value for threshold consensus
+	Threshold int `json:"threshold,omitempty"`
+}
+
+// normalize sets defaults & checks the strategy is known
+func (o *ConsensusOptions) normalize() error {
+	switch o.Strategy {
+	case "":
+		o.Strategy = ConsensusMajority
+	case ConsensusMajority, ConsensusWeighted, ConsensusRecent:
+	case ConsensusThreshold:
+		if o.Threshold <= 0 {
+			o.Threshold = defaultConsensusThreshold
+		}
+	default:
+		return fmt.Errorf("unknown consensus strategy: '%s'", o.Strategy)
+	}
+	return nil
+}
+
+// ConsensusValue is a value given for a field & the keys that gave it
+type ConsensusValue struct {
+	Value interface{} `json:"value"`
+	Keys  []string    `json:"keys"`
+	// total weight of Keys, the number of keys for unweighted strategies
+	Weight float64 `json:"weight"`
+}
+
+// FieldConsensus is the outcome of consensus on a single field
+type FieldConsensus struct {
+	ConsensusValue
+	// share of the total weight given to the chosen value, from 0-1
+	Agreement float64 `json:"agreement"`
+	// false if no value met the strategy's requirements, in which case
+	// Value is the leading value but isn't included in the consensus
+	Reached bool `json:"reached"`
+	// all other values given for the field, strongest first
+	Dissent []*ConsensusValue `json:"dissent,omitempty"`
+}
+
+// ConsensusResult is the consensus on a subject's metadata
+type ConsensusResult struct {
+	Subject  string `json:"subject"`
+	Strategy string `json:"strategy"`
+	// chosen value for each field that reached consensus
+	Data   map[string]interface{}     `json:"data"`
+	Fields map[string]*FieldConsensus `json:"fields"`
+}
+
+// ResolveConsensus reaches consensus on the latest metadata each key has
+// written for a subject. with no strategy set, options come from the primer
+// the subject belongs to, falling back to majority
+func ResolveConsensus(db sqlQueryable, subject string, opt ConsensusOptions) (*ConsensusResult, error) {
+	if opt.Strategy == "" {
+		primerOpt, err := SubjectConsensusOptions(db, subject)
+		if err != nil {
+			return nil, err
+		}
+		if primerOpt != nil {
+			opt = *primerOpt
+		}
+	}
+	if err := opt.normalize(); err != nil {
+		return nil, err
+	}
+
+	blocks, err := SubjectLatestMetadata(db, subject)
+	if err != nil {
+		return nil, err
+	}
+
+	weight := func(string) float64 { return 1 }
+	if opt.Strategy == ConsensusWeighted {
+		if opt.Trusted != nil {
+			weight = func(keyId string) float64 { return opt.Trusted[keyId] }
+		} else {
+			rep, err := SubjectKeyReputation(db, subject)
+			if err != nil {
+				return nil, err
+			}
+			weight = func(keyId string) float64 { return rep[keyId] }
+		}
+	}
+
+	return ReachConsensus(subject, blocks, opt, weight)
+}
+
+// SubjectConsensusOptions reads the consensus options of the primer a
+// subject belongs to, nil if the primer doesn't set any
+func SubjectConsensusOptions(db sqlQueryable, subject string) (*ConsensusOptions, error) {
+	var data []byte
+	if err := db.QueryRow(qSubjectPrimerConsensus, subject).Scan(&data); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	opt := &ConsensusOptions{}
+	if err := json.Unmarshal(data, opt); err != nil {
+		return nil, fmt.Errorf("invalid primer consensus settings: %s", err.Error())
+	}
+	return opt, nil
+}
+
+// SubjectLatestMetadata reads the latest metadata each key has written
+// for a subject
+func SubjectLatestMetadata(db sqlQueryable, subject string) ([]*core.Metadata, error) {
+	rows, err := db.Query(qSubjectLatestMetadata, subject)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	blocks := make([]*core.Metadata, 0)
+	for rows.Next() {
+		m := &core.Metadata{}
+		if err := m.UnmarshalSQL(rows); err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, m)
+	}
+	return blocks, rows.Err()
+}
+
+// SubjectKeyReputation weighs each key that has described a subject by the
+// number of subjects it has described, on a log scale so prolific keys
+// don't drown out everyone else
+func SubjectKeyReputation(db sqlQueryable, subject string) (map[string]float64, error) {
+	rows, err := db.Query(qSubjectKeyReputation, subject)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rep := map[string]float64{}
+	for rows.Next() {
+		var (
+			keyId string
+			n     int
+		)
+		if err := rows.Scan(&keyId, &n); err != nil {
+			return nil, err
+		}
+		rep[keyId] = 1 + math.Log(float64(n))
+	}
+	return rep, rows.Err()
+}
+
+// consensusTally accumulates votes for a single value of a field
+type consensusTally struct {
+	ConsensusValue
+	hash string
+	// index of the most recent block that gave this value
+	latest int
+}
+
+// ReachConsensus tallies blocks about subject field-by-field with the given
+// strategy, weighing each block by its key. blocks should hold at most one
+// entry per key, in any order
+func ReachConsensus(subject string, blocks []*core.Metadata, opt ConsensusOptions, weight func(keyId string) float64) (*ConsensusResult, error) {
+	if err := opt.normalize(); err != nil {
+		return nil, err
+	}
+
+	// order blocks by time so recency can be compared by index
+	blocks = append([]*core.Metadata{}, blocks...)
+	sort.SliceStable(blocks, func(i, j int) bool { return blocks[i].Timestamp.Before(blocks[j].Timestamp) })
+
+	fields := map[string]map[string]*consensusTally{}
+	for i, m := range blocks {
+		if m.Subject != subject || m.Meta == nil {
+			continue
+		}
+		hashes, values, err := m.HashMaps()
+		if err != nil {
+			return nil, err
+		}
+
+		w := weight(m.KeyId)
+		for field, hash := range hashes {
+			if fields[field] == nil {
+				fields[field] = map[string]*consensusTally{}
+			}
+			t := fields[field][hash]
+			if t == nil {
+				t = &consensusTally{ConsensusValue: ConsensusValue{Value: values[hash]}, hash: hash}
+				fields[field][hash] = t
+			}
+			t.Keys = append(t.Keys, m.KeyId)
+			t.Weight += w
+			t.latest = i
+		}
+	}
+
+	res := &ConsensusResult{
+		Subject:  subject,
+		Strategy: opt.Strategy,
+		Data:     map[string]interface{}{},
+		Fields:   map[string]*FieldConsensus{},
+	}
+	for field, votes := range fields {
+		fc := decideField(votes, opt)
+		res.Fields[field] = fc
+		if fc.Reached {
+			res.Data[field] = fc.Value
+		}
+	}
+	return res, nil
+}
+
+func decideField(votes map[string]*consensusTally, opt ConsensusOptions) *FieldConsensus {
+	tallies := make([]*consensusTally, 0, len(votes))
+	total := 0.0
+	for _, t := range votes {
+		sort.Strings(t.Keys)
+		tallies = append(tallies, t)
+		total += t.Weight
+	}
+
+	sort.Slice(tallies, func(i, j int) bool {
+		a, b := tallies[i], tallies[j]
+		if opt.Strategy == ConsensusRecent && a.latest != b.latest {
+			return a.latest > b.latest
+		}
+		if a.Weight != b.Weight {
+			return a.Weight > b.Weight
+		}
+		if a.latest != b.latest {
+			return a.latest > b.latest
+		}
+		return a.hash < b.hash
+	})
+
+	win := tallies[0]
+	fc := &FieldConsensus{ConsensusValue: win.ConsensusValue, Reached: true}
+	if total > 0 {
+		fc.Agreement = win.Weight / total
+	}
+	for _, t := range tallies[1:] {
+		v := t.ConsensusValue
+		fc.Dissent = append(fc.Dissent, &v)
+	}
+
+	switch opt.Strategy {
+	case ConsensusThreshold:
+		fc.Reached = len(win.Keys) >= opt.Threshold
+	case ConsensusWeighted:
+		fc.Reached = win.Weight > 0
+	}
+	return fc
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/datatogether/core"
+)
+
+func TestReachConsensus(t *testing.T) {
+	t0 := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	blocks := []*core.Metadata{
+		{KeyId: "a", Subject: "s", Timestamp: t0, Meta: map[string]interface{}{"title": "EPA", "license": "cc-by"}},
+		{KeyId: "b", Subject: "s", Timestamp: t0.Add(time.Hour), Meta: map[string]interface{}{"title": "EPA", "license": "public domain"}},
+		{KeyId: "c", Subject: "s", Timestamp: t0.Add(2 * time.Hour), Meta: map[string]interface{}{"title": "Environmental Protection Agency"}},
+		{KeyId: "d", Subject: "other", Timestamp: t0, Meta: map[string]interface{}{"title": "NOAA"}},
+	}
+	unweighted := func(string) float64 { return 1 }
+
+	cases := []struct {
+		opt     ConsensusOptions
+		weight  func(string) float64
+		title   interface{}
+		reached bool
+		agree   float64
+	}{
+		{ConsensusOptions{}, unweighted, "EPA", true, 2.0 / 3.0},
+		{ConsensusOptions{Strategy: ConsensusRecent}, unweighted, "Environmental Protection Agency", true, 1.0 / 3.0},
+		{ConsensusOptions{Strategy: ConsensusThreshold, Threshold: 3}, unweighted, "EPA", false, 2.0 / 3.0},
+		{ConsensusOptions{Strategy: ConsensusWeighted}, func(k string) float64 {
+			if k == "c" {
+				return 5
+			}
+			return 1
+		}, "Environmental Protection Agency", true, 5.0 / 7.0},
+	}
+
+	for i, c := range cases {
+		res, err := ReachConsensus("s", blocks, c.opt, c.weight)
+		if err != nil {
+			t.Errorf("case %d unexpected error: %s", i, err.Error())
+			continue
+		}
+		f := res.Fields["title"]
+		if f == nil {
+			t.Errorf("case %d: expected title field", i)
+			continue
+		}
+		if f.Value != c.title {
+			t.Errorf("case %d value mismatch. expected: %v, got: %v", i, c.title, f.Value)
+		}
+		if f.Reached != c.reached {
+			t.Errorf("case %d reached mismatch. expected: %t, got: %t", i, c.reached, f.Reached)
+		}
+		if _, ok := res.Data["title"]; ok != c.reached {
+			t.Errorf("case %d: expected title in data to be %t", i, c.reached)
+		}
+		if f.Agreement != c.agree {
+			t.Errorf("case %d agreement mismatch. expected: %f, got: %f", i, c.agree, f.Agreement)
+		}
+		if len(f.Dissent) != 1 {
+			t.Errorf("case %d: expected 1 dissenting value, got %d", i, len(f.Dissent))
+		}
+	}
+
+	if _, err := ReachConsensus("s", blocks, ConsensusOptions{Strategy: "coin flip"}, unweighted); err == nil {
+		t.Errorf("expected unknown strategy to error")
+	}
+}
+
+func TestSubjectConsensusOptions(t *testing.T) {
+	// census primer, whose www.census.gov source has no scheme
+	primerId := "d9deff9d-15e8-43f1-9d00-51160c0bffbe"
+	if _, err := appDB.Exec("UPDATE primers SET meta = $2 WHERE id = $1", primerId, `{"consensus":{"strategy":"recent"}}`); err != nil {
+		t.Fatal(err.Error())
+	}
+	defer appDB.Exec("UPDATE primers SET meta = null WHERE id = $1", primerId)
+
+	// content hash of https://www.census.gov/nometa.pdf
+	opt, err := SubjectConsensusOptions(appDB, "1220af06510193276b5fd9ad2fc55dcc004ada557d9259ca3505478bfef0b12ed988")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if opt == nil || opt.Strategy != ConsensusRecent {
+		t.Errorf("expected census primer consensus options, got: %v", opt)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/datatogether/core"
+)
+
+// FetchCustomCrawlsAction grabs a page of custom crawls, optionally limited
+// to crawls covering a single url
+type FetchCustomCrawlsAction struct {
+	ReqAction
+	Url string
+	PageParams
+}
+
+func (FetchCustomCrawlsAction) Type() string        { return "CUSTOM_CRAWLS_FETCH_REQUEST" }
+func (FetchCustomCrawlsAction) SuccessType() string { return "CUSTOM_CRAWLS_FETCH_SUCCESS" }
+func (FetchCustomCrawlsAction) FailureType() string { return "CUSTOM_CRAWLS_FETCH_FAILURE" }
+
+func (FetchCustomCrawlsAction) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &FetchCustomCrawlsAction{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *FetchCustomCrawlsAction) Exec() (res *ClientResponse) {
+	crawls, page, err := ListCustomCrawlsPage(appDB, a.Url, &a.PageParams)
+	if err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	for i, c := range crawls {
+		crawls[i] = withoutJwt(c)
+	}
+
+	return page.respond(&a.PageParams, &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "CUSTOM_CRAWL_ARRAY",
+		Data:      crawls,
+	})
+}
+
+// FetchCustomCrawlAction grabs a single custom crawl by id
+type FetchCustomCrawlAction struct {
+	ReqAction
+	Id string
+}
+
+func (FetchCustomCrawlAction) Type() string        { return "CUSTOM_CRAWL_FETCH_REQUEST" }
+func (FetchCustomCrawlAction) SuccessType() string { return "CUSTOM_CRAWL_FETCH_SUCCESS" }
+func (FetchCustomCrawlAction) FailureType() string { return "CUSTOM_CRAWL_FETCH_FAILURE" }
+
+func (FetchCustomCrawlAction) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &FetchCustomCrawlAction{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *FetchCustomCrawlAction) Exec() (res *ClientResponse) {
+	c := &core.CustomCrawl{Id: a.Id}
+	if err := c.Read(store); err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "CUSTOM_CRAWL",
+		Data:      withoutJwt(c),
+	}
+}
+
+// SaveCustomCrawlAction creates or updates a custom crawl. Completion is
+// only set through CompleteCustomCrawlAction, so saving never changes
+// a crawl's DateCompleted. Only the key that created a crawl may change it
+type SaveCustomCrawlAction struct {
+	ReqAction
+	CustomCrawl *core.CustomCrawl `json:"customCrawl"`
+}
+
+func (SaveCustomCrawlAction) Type() string        { return "CUSTOM_CRAWL_SAVE_REQUEST" }
+func (SaveCustomCrawlAction) SuccessType() string { return "CUSTOM_CRAWL_SAVE_SUCCESS" }
+func (SaveCustomCrawlAction) FailureType() string { return "CUSTOM_CRAWL_SAVE_FAILURE" }
+
+func (SaveCustomCrawlAction) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &SaveCustomCrawlAction{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *SaveCustomCrawlAction) Exec() (res *ClientResponse) {
+	if err := a.save(); err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "CUSTOM_CRAWL",
+		Data:      withoutJwt(a.CustomCrawl),
+	}
+}
+
+func (a *SaveCustomCrawlAction) save() error {
+	keyId := a.client.keyId()
+	if keyId == "" {
+		return fmt.Errorf("you must be logged in to save custom crawls")
+	}
+	c := a.CustomCrawl
+	if c == nil || c.OriginalUrl == "" {
+		return fmt.Errorf("custom crawl originalUrl is required")
+	}
+
+	// new crawls, including ones saved with an unknown id, start incomplete
+	completed := time.Time{}
+	exists := false
+	if c.Id != "" {
+		prev := &core.CustomCrawl{Id: c.Id}
+		if err := prev.Read(store); err == nil {
+			if err := requireCustomCrawlCreator(appDB, prev.Id, keyId); err != nil {
+				return err
+			}
+			exists = true
+			c.Created = prev.Created
+			completed = prev.DateCompleted
+			// clients never see the token, so keep it unless a new one is given
+			if c.Jwt == "" {
+				c.Jwt = prev.Jwt
+			}
+		} else if err != core.ErrNotFound {
+			return err
+		}
+	}
+	c.DateCompleted = completed
+
+	return SaveCustomCrawl(appDB, keyId, c, exists)
+}
+
+// CompleteCustomCrawlAction marks a custom crawl as complete, recording the
+// run that produced it. Only the key that created a crawl may complete it.
+// Clients subscribed to the crawl's url topic are sent
+// a CUSTOM_CRAWL_COMPLETE event
+type CompleteCustomCrawlAction struct {
+	ReqAction
+	Id             string `json:"id"`
+	MorphRunId     string `json:"morphRunId"`
+	SqliteChecksum string `json:"sqliteChecksum"`
+}
+
+func (CompleteCustomCrawlAction) Type() string        { return "CUSTOM_CRAWL_COMPLETE_REQUEST" }
+func (CompleteCustomCrawlAction) SuccessType() string { return "CUSTOM_CRAWL_COMPLETE_SUCCESS" }
+func (CompleteCustomCrawlAction) FailureType() string { return "CUSTOM_CRAWL_COMPLETE_FAILURE" }
+
+func (CompleteCustomCrawlAction) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &CompleteCustomCrawlAction{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *CompleteCustomCrawlAction) Exec() (res *ClientResponse) {
+	c := &core.CustomCrawl{Id: a.Id}
+	if err := a.complete(c); err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "CUSTOM_CRAWL",
+		Data:      withoutJwt(c),
+	}
+}
+
+func (a *CompleteCustomCrawlAction) complete(c *core.CustomCrawl) error {
+	keyId := a.client.keyId()
+	if keyId == "" {
+		return fmt.Errorf("you must be logged in to complete custom crawls")
+	}
+	if err := c.Read(store); err != nil {
+		return err
+	}
+	if err := requireCustomCrawlCreator(appDB, c.Id, keyId); err != nil {
+		return err
+	}
+	if CustomCrawlComplete(c) {
+		return fmt.Errorf("custom crawl %s is already complete", c.Id)
+	}
+	if a.MorphRunId != "" {
+		c.MorphRunId = a.MorphRunId
+	}
+	if a.SqliteChecksum != "" {
+		c.SqliteChecksum = a.SqliteChecksum
+	}
+	return CompleteCustomCrawl(c)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/datatogether/core"
+	"github.com/pborman/uuid"
+)
+
+// UrlTopic is the subscription topic for events concerning a url
+func UrlTopic(url string) string {
+	return "URL:" + url
+}
+
+// withoutJwt copies a custom crawl without the token that created it, for
+// sending to clients
+func withoutJwt(c *core.CustomCrawl) *core.CustomCrawl {
+	cp := *c
+	cp.Jwt = ""
+	return &cp
+}
+
+// requireCustomCrawlCreator confirms keyId created a custom crawl
+func requireCustomCrawlCreator(db sqlQueryable, id, keyId string) error {
+	var creator string
+	if err := db.QueryRow(qCustomCrawlCreator, id).Scan(&creator); err != nil {
+		if err == sql.ErrNoRows {
+			return core.ErrNotFound
+		}
+		return err
+	}
+	if creator != keyId {
+		return fmt.Errorf("only the creator of a custom crawl can change it")
+	}
+	return nil
+}
+
+// SaveCustomCrawl updates a custom crawl if exists is true, creating it as
+// keyId with a new id otherwise
+func SaveCustomCrawl(db *sql.DB, keyId string, c *core.CustomCrawl, exists bool) error {
+	now := time.Now().Round(time.Second).In(time.UTC)
+	if !exists {
+		c.Id = uuid.New()
+		c.Created = now
+	}
+	c.Updated = now
+
+	return withTx(db, func(tx sqlQueryExecable) error {
+		if err := putModel(tx, c, exists); err != nil {
+			return err
+		}
+		if exists {
+			return nil
+		}
+		_, err := tx.Exec(qCustomCrawlSetCreator, c.Id, keyId)
+		return err
+	})
+}
+
+// CustomCrawlComplete reports whether a custom crawl has been marked complete.
+// incomplete crawls have a zero DateCompleted, which may come back from
+// postgres in a non-UTC location, so check the year instead of IsZero
+func CustomCrawlComplete(c *core.CustomCrawl) bool {
+	return c.DateCompleted.Year() > 1
+}
+
+// CompleteCustomCrawl marks a custom crawl as complete, saves it & notifies
+// clients subscribed to the crawl's url
+func CompleteCustomCrawl(c *core.CustomCrawl) error {
+	c.DateCompleted = time.Now().Round(time.Second).In(time.UTC)
+	if err := c.Save(store); err != nil {
+		return err
+	}
+
+	room.Publish(UrlTopic(c.OriginalUrl), &ClientResponse{
+		Type:      "CUSTOM_CRAWL_COMPLETE",
+		RequestId: "server",
+		Schema:    "CUSTOM_CRAWL",
+		Id:        c.Id,
+		Data:      withoutJwt(c),
+	})
+	return nil
+}
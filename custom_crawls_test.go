@@ -0,0 +1,21 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/datatogether/core"
+)
+
+func TestWithoutJwt(t *testing.T) {
+	c := &core.CustomCrawl{Id: "a", Jwt: "token", OriginalUrl: "http://www.epa.gov"}
+	got := withoutJwt(c)
+	if got.Jwt != "" {
+		t.Errorf("expected jwt to be removed, got: %s", got.Jwt)
+	}
+	if got.Id != c.Id || got.OriginalUrl != c.OriginalUrl {
+		t.Errorf("expected other fields to be copied")
+	}
+	if c.Jwt != "token" {
+		t.Errorf("expected original crawl to keep its jwt")
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/datatogether/core"
+)
+
+// FetchDataReposAction grabs a page of data repos, optionally searching
+// titles & descriptions
+type FetchDataReposAction struct {
+	ReqAction
+	Query string
+	PageParams
+}
+
+func (FetchDataReposAction) Type() string        { return "DATA_REPOS_FETCH_REQUEST" }
+func (FetchDataReposAction) SuccessType() string { return "DATA_REPOS_FETCH_SUCCESS" }
+func (FetchDataReposAction) FailureType() string { return "DATA_REPOS_FETCH_FAILURE" }
+
+func (FetchDataReposAction) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &FetchDataReposAction{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *FetchDataReposAction) Exec() (res *ClientResponse) {
+	repos, page, err := ListDataReposPage(appDB, a.Query, &a.PageParams)
+	if err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return page.respond(&a.PageParams, &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "DATA_REPO_ARRAY",
+		Data:      repos,
+	})
+}
+
+// FetchDataRepoAction grabs a single data repo by id
+type FetchDataRepoAction struct {
+	ReqAction
+	Id string
+}
+
+func (FetchDataRepoAction) Type() string        { return "DATA_REPO_FETCH_REQUEST" }
+func (FetchDataRepoAction) SuccessType() string { return "DATA_REPO_FETCH_SUCCESS" }
+func (FetchDataRepoAction) FailureType() string { return "DATA_REPO_FETCH_FAILURE" }
+
+func (FetchDataRepoAction) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &FetchDataRepoAction{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *FetchDataRepoAction) Exec() (res *ClientResponse) {
+	d, err := ReadDataRepo(appDB, a.Id)
+	if err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "DATA_REPO",
+		Data:      d,
+	}
+}
+
+// SaveDataRepoAction creates or updates a data repo
+type SaveDataRepoAction struct {
+	ReqAction
+	DataRepo *core.DataRepo `json:"dataRepo"`
+}
+
+func (SaveDataRepoAction) Type() string        { return "DATA_REPO_SAVE_REQUEST" }
+func (SaveDataRepoAction) SuccessType() string { return "DATA_REPO_SAVE_SUCCESS" }
+func (SaveDataRepoAction) FailureType() string { return "DATA_REPO_SAVE_FAILURE" }
+
+func (SaveDataRepoAction) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &SaveDataRepoAction{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *SaveDataRepoAction) Exec() (res *ClientResponse) {
+	if err := a.save(); err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "DATA_REPO",
+		Data:      a.DataRepo,
+	}
+}
+
+func (a *SaveDataRepoAction) save() error {
+	if a.client.keyId() == "" {
+		return fmt.Errorf("you must be logged in to save data repos")
+	}
+	d := a.DataRepo
+	if d == nil || d.Title == "" {
+		return fmt.Errorf("data repo title is required")
+	}
+
+	if d.Id != "" {
+		// deleted repos can't be edited
+		prev, err := ReadDataRepo(appDB, d.Id)
+		if err != nil {
+			return err
+		}
+		d.Created = prev.Created
+	}
+
+	return d.Save(store)
+}
+
+// DeleteDataRepoAction marks a data repo as deleted
+type DeleteDataRepoAction struct {
+	ReqAction
+	Id string `json:"id"`
+}
+
+func (DeleteDataRepoAction) Type() string        { return "DATA_REPO_DELETE_REQUEST" }
+func (DeleteDataRepoAction) SuccessType() string { return "DATA_REPO_DELETE_SUCCESS" }
+func (DeleteDataRepoAction) FailureType() string { return "DATA_REPO_DELETE_FAILURE" }
+
+func (DeleteDataRepoAction) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &DeleteDataRepoAction{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *DeleteDataRepoAction) Exec() (res *ClientResponse) {
+	d := &core.DataRepo{Id: a.Id}
+	if err := a.delete(d); err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "DATA_REPO",
+		Data:      d,
+	}
+}
+
+func (a *DeleteDataRepoAction) delete(d *core.DataRepo) error {
+	if a.client.keyId() == "" {
+		return fmt.Errorf("you must be logged in to delete data repos")
+	}
+	return DeleteDataRepo(appDB, d)
+}
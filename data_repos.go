@@ -0,0 +1,33 @@
+package main
+
+import (
+	"time"
+
+	"github.com/datatogether/core"
+)
+
+// ReadDataRepo reads a data repo by id, treating deleted repos as not found.
+// core's DataRepo.Read doesn't know about the deleted column
+func ReadDataRepo(db sqlQueryable, id string) (*core.DataRepo, error) {
+	d := &core.DataRepo{}
+	if err := d.UnmarshalSQL(db.QueryRow(qDataRepoActiveById, id)); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// DeleteDataRepo marks a data repo as deleted
+func DeleteDataRepo(db sqlExecable, d *core.DataRepo) error {
+	res, err := db.Exec(qDataRepoSoftDelete, d.Id, time.Now().Round(time.Second).In(time.UTC))
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return core.ErrNotFound
+	}
+	return nil
+}
@@ -1,11 +1,15 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"html/template"
 	"io"
+	"io/ioutil"
 	"net/http"
+	"os"
+	"strconv"
 )
 
 // templates is a collection of views for rendering with the renderTemplate function
@@ -28,19 +32,88 @@ func UserProfileHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// ArchiveUrlHandler records a request to archive the url form value & starts
+// archiving it & all of the links it references in the background, responding
+// with the recorded archive request. with a wait=true form value it instead
+// blocks until every link has been fetched, responding with the archive
+// request & the per-link archive result
 func ArchiveUrlHandler(w http.ResponseWriter, r *http.Request) {
-	done := func(err error) {}
-	res, _, err := ArchiveUrl(appDB, r.FormValue("url"), done)
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		io.WriteString(w, fmt.Sprintf("method %s not allowed", r.Method))
+		return
+	}
+
+	user, err := SessionUser(r)
+	if err != nil {
+		log.Info(err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, fmt.Sprintf("error reading session: %s", err.Error()))
+		return
+	}
+	userId := ""
+	if user != nil {
+		userId = user.Id
+	}
+
+	url := r.FormValue("url")
+	req, err := RecordArchiveRequest(appDB, url, userId, requestOrigin(r))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, fmt.Sprintf("archive url '%s' error: %s", url, err.Error()))
+		return
+	}
+
+	if r.FormValue("wait") == "true" {
+		archiveUrlSyncResponse(w, req)
+		return
+	}
+
+	go func() {
+		if _, _, err := ArchiveUrl(appDB, url, func(res *ArchiveResult, err error) {
+			if err != nil {
+				log.Infof("archive url '%s' error: %s", url, err.Error())
+			}
+		}); err != nil {
+			log.Infof("archive url '%s' error: %s", url, err.Error())
+		}
+	}()
+
+	data, err := json.MarshalIndent(req, "", "  ")
 	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, fmt.Sprintf("error marshalling archive request json: %s", err.Error()))
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	w.Write(data)
+}
+
+// archiveUrlSyncResponse archives the url of req, writing the request & the
+// archive result once all links have been fetched. links that failed are
+// reported in the result & error, errors archiving the url itself fail the
+// request
+func archiveUrlSyncResponse(w http.ResponseWriter, req *ArchiveRequest) {
+	res, err := ArchiveUrlSync(appDB, req.Url)
+	if res == nil {
 		w.WriteHeader(http.StatusBadRequest)
-		io.WriteString(w, fmt.Sprintf("archive url '%s' error: %s", r.FormValue("url"), err.Error()))
+		io.WriteString(w, fmt.Sprintf("archive url '%s' error: %s", req.Url, err.Error()))
 		return
 	}
 
-	data, err := json.MarshalIndent(res.Url, "", "  ")
+	body := struct {
+		Request *ArchiveRequest `json:"request"`
+		Result  *ArchiveResult  `json:"result"`
+		Error   string          `json:"error,omitempty"`
+	}{Request: req, Result: res}
+	if err != nil {
+		body.Error = err.Error()
+	}
+	data, err := json.MarshalIndent(body, "", "  ")
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		io.WriteString(w, fmt.Sprintf("error marshalling url json: %s", err.Error()))
+		io.WriteString(w, fmt.Sprintf("error marshalling archive result json: %s", err.Error()))
 		return
 	}
 
@@ -48,6 +121,245 @@ func ArchiveUrlHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(data)
 }
 
+// WarcExportHandler writes a WARC file for the url, source or collection
+// query param
+func WarcExportHandler(w http.ResponseWriter, r *http.Request) {
+	e := &WarcExport{
+		Url:          r.FormValue("url"),
+		SourceId:     r.FormValue("source"),
+		CollectionId: r.FormValue("collection"),
+	}
+	if l, err := strconv.Atoi(r.FormValue("limit")); err == nil {
+		e.Limit = l
+	}
+	if err := viewableCollection(e.CollectionId, ""); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, fmt.Sprintf("warc export error: %s", err.Error()))
+		return
+	}
+
+	urls, err := e.Urls(appDB)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, fmt.Sprintf("warc export error: %s", err.Error()))
+		return
+	}
+
+	// records are streamed, so errors past this point can only be logged
+	w.Header().Set("Content-Type", "application/warc")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", e.Filename()))
+	w.WriteHeader(http.StatusOK)
+	if _, err := e.WriteUrls(w, urls); err != nil {
+		log.Infof("warc export error: %s", err.Error())
+	}
+}
+
+// WarcImportHandler accepts a WARC file upload as the "file" form field & starts
+// importing it in the background. It responds with the import status, clients
+// should subscribe to the status topic for progress. imports overwrite urls &
+// stored content, so only admins can import
+func WarcImportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		io.WriteString(w, fmt.Sprintf("method %s not allowed", r.Method))
+		return
+	}
+
+	user, status, err := adminSessionUser(r)
+	if err != nil {
+		w.WriteHeader(status)
+		io.WriteString(w, err.Error())
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, fmt.Sprintf("error reading warc file: %s", err.Error()))
+		return
+	}
+	defer file.Close()
+
+	// the uploaded file is removed once this handler returns, so buffer the
+	// file to disk for the import to read
+	tmp, err := ioutil.TempFile("", "warc_import")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, fmt.Sprintf("error buffering warc file: %s", err.Error()))
+		return
+	}
+	if _, err := io.Copy(tmp, file); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, fmt.Sprintf("error buffering warc file: %s", err.Error()))
+		return
+	}
+
+	imp := NewWarcImport(header.Filename, user.Id)
+	go func() {
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+		if _, err := tmp.Seek(0, 0); err != nil {
+			imp.finish(err)
+			return
+		}
+		if err := imp.Run(tmp); err != nil {
+			log.Infof("warc import %s error: %s", imp.Id, err.Error())
+		}
+	}()
+
+	data, err := json.MarshalIndent(map[string]interface{}{
+		"topic":  imp.Topic(),
+		"import": imp.Status(),
+	}, "", "  ")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, fmt.Sprintf("error marshalling import json: %s", err.Error()))
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	w.Write(data)
+}
+
+// MetadataExportHandler writes a CSV or JSON Lines file of metadata for the
+// key, source or collection query param
+func MetadataExportHandler(w http.ResponseWriter, r *http.Request) {
+	e := &MetadataExport{
+		KeyId:        r.FormValue("key"),
+		SourceId:     r.FormValue("source"),
+		CollectionId: r.FormValue("collection"),
+		Format:       r.FormValue("format"),
+	}
+	if err := viewableCollection(e.CollectionId, ""); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, fmt.Sprintf("metadata export error: %s", err.Error()))
+		return
+	}
+
+	rows, fields, err := e.Query(appDB)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, fmt.Sprintf("metadata export error: %s", err.Error()))
+		return
+	}
+
+	// rows are streamed, so errors past this point can only be logged
+	if e.Format == MetadataFormatCSV {
+		w.Header().Set("Content-Type", "text/csv")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", e.Filename()))
+	w.WriteHeader(http.StatusOK)
+	if _, err := e.WriteRows(w, rows, fields); err != nil {
+		log.Infof("metadata export error: %s", err.Error())
+	}
+}
+
+// MetadataImportHandler accepts a CSV or JSON Lines file upload as the "file"
+// form field & starts writing its metadata under the session user's key in
+// the background. It responds with the import status, clients should
+// subscribe to the status topic for per-row progress
+func MetadataImportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		io.WriteString(w, fmt.Sprintf("method %s not allowed", r.Method))
+		return
+	}
+
+	var keyId string
+	if user, err := SessionUser(r); err != nil {
+		log.Infof("error reading session user: %s", err.Error())
+	} else if user != nil {
+		keyId = user.CurrentKey
+	}
+
+	// uploads are read into memory, so limit their size
+	r.Body = http.MaxBytesReader(w, r.Body, maxMetadataImportSize)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, fmt.Sprintf("error reading metadata file (max size is %d bytes): %s", maxMetadataImportSize, err.Error()))
+		return
+	}
+	defer file.Close()
+
+	imp, err := NewMetadataImport(header.Filename, r.FormValue("format"), keyId)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, err.Error())
+		return
+	}
+
+	// the uploaded file is removed once this handler returns, so read it
+	// into memory for the import
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		imp.finish(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, fmt.Sprintf("error reading metadata file: %s", err.Error()))
+		return
+	}
+	go func() {
+		if err := imp.Run(bytes.NewReader(data)); err != nil {
+			log.Infof("metadata import %s error: %s", imp.Id, err.Error())
+		}
+	}()
+
+	res, err := json.MarshalIndent(map[string]interface{}{
+		"topic":  imp.Topic(),
+		"import": imp.Status(),
+	}, "", "  ")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, fmt.Sprintf("error marshalling import json: %s", err.Error()))
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	w.Write(res)
+}
+
+// CollectionExportHandler writes the collection query param as a CSV, JSON
+// Lines, BagIt zip or datapackage.json file, chosen by the format query param.
+// non-public collections can only be exported by a logged in user with a
+// role on the collection
+func CollectionExportHandler(w http.ResponseWriter, r *http.Request) {
+	e := &CollectionExport{
+		CollectionId: r.FormValue("id"),
+		Format:       r.FormValue("format"),
+	}
+
+	var keyId string
+	if user, err := SessionUser(r); err != nil {
+		log.Infof("error reading session user: %s", err.Error())
+	} else if user != nil {
+		keyId = user.CurrentKey
+	}
+	if err := viewableCollection(e.CollectionId, keyId); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, fmt.Sprintf("collection export error: %s", err.Error()))
+		return
+	}
+
+	c, items, err := e.Items(appDB)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, fmt.Sprintf("collection export error: %s", err.Error()))
+		return
+	}
+
+	// the export is streamed, so errors past this point can only be logged
+	w.Header().Set("Content-Type", e.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", e.Filename()))
+	w.WriteHeader(http.StatusOK)
+	if _, err := e.WriteItems(w, c, items); err != nil {
+		log.Infof("collection export error: %s", err.Error())
+	}
+}
+
 // WebappHandler renders the home page
 func WebappHandler(w http.ResponseWriter, r *http.Request) {
 	renderTemplate(w, "webapp.html", nil)
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/rpc"
+	"strings"
+	"time"
+)
+
+// sessionCookieName is the cookie the identity server uses to track sessions
+const sessionCookieName = "session"
+
+// identityDialTimeout limits how long connecting to the identity server can
+// hold up a request
+const identityDialTimeout = 5 * time.Second
+
+// User is the subset of an identity server user that patchbay cares about
+type User struct {
+	Id       string `json:"id"`
+	Username string `json:"username"`
+	// sha256 multihash of the user's current public key
+	CurrentKey string `json:"currentKey"`
+}
+
+// SessionUserParams are the arguments for looking up a session user
+// from the identity server
+type SessionUserParams struct {
+	Session string
+}
+
+// SessionUser asks the identity server for the user behind a request's
+// session cookie. It returns a nil user if no session is present or
+// no identity server is configured
+func SessionUser(r *http.Request) (*User, error) {
+	if cfg.IdentityServiceUrl == "" {
+		return nil, nil
+	}
+
+	ck, err := r.Cookie(sessionCookieName)
+	if err != nil || ck.Value == "" {
+		return nil, nil
+	}
+
+	conn, err := net.DialTimeout("tcp", cfg.IdentityServiceUrl, identityDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	cli := rpc.NewClient(conn)
+	defer cli.Close()
+
+	u := &User{}
+	if err := cli.Call("UserRequests.Session", &SessionUserParams{Session: ck.Value}, u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// requestOrigin gives the origin of a request, preferring the Origin header
+// and falling back to the remote address of the connection. X-Forwarded-For
+// is only used on requests from a trusted proxy
+func requestOrigin(r *http.Request) string {
+	if o := r.Header.Get("Origin"); o != "" {
+		return o
+	}
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" && trustedProxy(r.RemoteAddr) {
+		// proxies append the address they saw, earlier entries are client-supplied
+		addrs := strings.Split(fwd, ",")
+		return strings.TrimSpace(addrs[len(addrs)-1])
+	}
+	return r.RemoteAddr
+}
+
+// trustedProxy reports whether a remote address is one of the configured
+// trusted proxies
+func trustedProxy(remoteAddr string) bool {
+	if cfg == nil {
+		return false
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	for _, p := range cfg.TrustedProxies {
+		if p == host {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestOrigin(t *testing.T) {
+	prev := cfg
+	defer func() { cfg = prev }()
+	cfg = &config{TrustedProxies: []string{"10.0.0.1"}}
+
+	cases := []struct {
+		remoteAddr, origin, forwarded string
+		expect                        string
+	}{
+		{"1.2.3.4:5000", "https://example.com", "", "https://example.com"},
+		{"1.2.3.4:5000", "", "", "1.2.3.4:5000"},
+		// forwarded addresses from untrusted remotes are ignored
+		{"1.2.3.4:5000", "", "9.9.9.9", "1.2.3.4:5000"},
+		{"10.0.0.1:5000", "", "9.9.9.9", "9.9.9.9"},
+		// only the address appended by the proxy is trusted
+		{"10.0.0.1:5000", "", "6.6.6.6, 9.9.9.9", "9.9.9.9"},
+	}
+
+	for i, c := range cases {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = c.remoteAddr
+		if c.origin != "" {
+			r.Header.Set("Origin", c.origin)
+		}
+		if c.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", c.forwarded)
+		}
+		if got := requestOrigin(r); got != c.expect {
+			t.Errorf("case %d mismatch. expected: '%s', got: '%s'", i, c.expect, got)
+		}
+	}
+}
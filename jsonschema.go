@@ -0,0 +1,291 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// SchemaError is a single failure to match a JSON Schema. Field is the
+// dot-separated path to the failing value, "" for the document itself
+type SchemaError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError collects all the ways a document fails to match a schema
+type ValidationError []*SchemaError
+
+func (e ValidationError) Error() string {
+	msgs := make([]string, len(e))
+	for i, se := range e {
+		if se.Field == "" {
+			msgs[i] = se.Message
+		} else {
+			msgs[i] = fmt.Sprintf("%s: %s", se.Field, se.Message)
+		}
+	}
+	return "invalid data: " + strings.Join(msgs, ", ")
+}
+
+// ValidateSchema checks a decoded json document against a JSON Schema. It
+// supports the subset of keywords used to describe metadata: type, enum,
+// properties, required, additionalProperties, items, minItems, maxItems,
+// minLength, maxLength, pattern, minimum & maximum
+func ValidateSchema(schema map[string]interface{}, doc interface{}) ValidationError {
+	errs := ValidationError{}
+	validateSchema("", schema, doc, &errs)
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// schemaKeywords are the keywords CheckSchema accepts: those ValidateSchema
+// enforces, and annotations that don't affect validation
+var schemaKeywords = map[string]bool{
+	"type": true, "enum": true, "properties": true, "required": true,
+	"additionalProperties": true, "items": true, "minItems": true, "maxItems": true,
+	"minLength": true, "maxLength": true, "pattern": true, "minimum": true, "maximum": true,
+	"$schema": true, "$id": true, "$comment": true, "title": true, "description": true,
+	"default": true, "examples": true,
+}
+
+// CheckSchema confirms a schema only uses types & keywords ValidateSchema
+// understands correctly. unsupported keywords are an error rather than being
+// ignored, so schemas never look stricter than they are
+func CheckSchema(schema map[string]interface{}) error {
+	for keyword, val := range schema {
+		if !schemaKeywords[keyword] {
+			return fmt.Errorf("unsupported schema keyword: '%s'", keyword)
+		}
+		switch keyword {
+		case "enum", "required":
+			if _, ok := val.([]interface{}); !ok {
+				return fmt.Errorf("%s must be an array", keyword)
+			}
+		case "properties":
+			if _, ok := val.(map[string]interface{}); !ok {
+				return fmt.Errorf("properties must be an object")
+			}
+		case "items":
+			if _, ok := val.(map[string]interface{}); !ok {
+				return fmt.Errorf("items must be a schema object")
+			}
+		case "additionalProperties":
+			switch val.(type) {
+			case bool, map[string]interface{}:
+			default:
+				return fmt.Errorf("additionalProperties must be a boolean or schema object")
+			}
+		case "minItems", "maxItems", "minLength", "maxLength", "minimum", "maximum":
+			if _, ok := val.(float64); !ok {
+				return fmt.Errorf("%s must be a number", keyword)
+			}
+		case "pattern":
+			if _, ok := val.(string); !ok {
+				return fmt.Errorf("pattern must be a string")
+			}
+		case "type":
+			switch val.(type) {
+			case string, []interface{}:
+			default:
+				return fmt.Errorf("type must be a string or array")
+			}
+		}
+	}
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, r := range required {
+			if _, ok := r.(string); !ok {
+				return fmt.Errorf("required must list field names")
+			}
+		}
+	}
+
+	for _, t := range schemaTypes(schema) {
+		switch t {
+		case "object", "array", "string", "number", "integer", "boolean", "null":
+		default:
+			return fmt.Errorf("unsupported schema type: '%s'", t)
+		}
+	}
+	if p, ok := schema["pattern"].(string); ok {
+		if _, err := regexp.Compile(p); err != nil {
+			return fmt.Errorf("invalid pattern: %s", err.Error())
+		}
+	}
+	if props, ok := schema["properties"].(map[string]interface{}); ok {
+		for name, prop := range props {
+			ps, ok := prop.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("property '%s' must be a schema object", name)
+			}
+			if err := CheckSchema(ps); err != nil {
+				return fmt.Errorf("property '%s': %s", name, err.Error())
+			}
+		}
+	}
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		if err := CheckSchema(items); err != nil {
+			return fmt.Errorf("items: %s", err.Error())
+		}
+	}
+	if ap, ok := schema["additionalProperties"].(map[string]interface{}); ok {
+		if err := CheckSchema(ap); err != nil {
+			return fmt.Errorf("additionalProperties: %s", err.Error())
+		}
+	}
+	return nil
+}
+
+func validateSchema(path string, schema map[string]interface{}, val interface{}, errs *ValidationError) {
+	addErr := func(format string, args ...interface{}) {
+		*errs = append(*errs, &SchemaError{Field: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if types := schemaTypes(schema); len(types) > 0 {
+		matched := false
+		for _, t := range types {
+			if jsonTypeMatches(t, val) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			addErr("must be of type %s", strings.Join(types, " or "))
+			return
+		}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			// decoded json values are equal when they share a type & value
+			if reflect.DeepEqual(e, val) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			addErr("must be one of %v", enum)
+		}
+	}
+
+	switch v := val.(type) {
+	case map[string]interface{}:
+		props, _ := schema["properties"].(map[string]interface{})
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, r := range required {
+				name, _ := r.(string)
+				if _, ok := v[name]; !ok {
+					*errs = append(*errs, &SchemaError{Field: joinSchemaPath(path, name), Message: "is required"})
+				}
+			}
+		}
+		for name, pv := range v {
+			if ps, ok := props[name].(map[string]interface{}); ok {
+				validateSchema(joinSchemaPath(path, name), ps, pv, errs)
+				continue
+			}
+			switch ap := schema["additionalProperties"].(type) {
+			case bool:
+				if !ap {
+					*errs = append(*errs, &SchemaError{Field: joinSchemaPath(path, name), Message: "is not an allowed field"})
+				}
+			case map[string]interface{}:
+				validateSchema(joinSchemaPath(path, name), ap, pv, errs)
+			}
+		}
+	case []interface{}:
+		if min, ok := schemaNumber(schema, "minItems"); ok && float64(len(v)) < min {
+			addErr("must have at least %v items", min)
+		}
+		if max, ok := schemaNumber(schema, "maxItems"); ok && float64(len(v)) > max {
+			addErr("must have at most %v items", max)
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				validateSchema(fmt.Sprintf("%s[%d]", path, i), items, item, errs)
+			}
+		}
+	case string:
+		length := float64(len([]rune(v)))
+		if min, ok := schemaNumber(schema, "minLength"); ok && length < min {
+			addErr("must be at least %v characters", min)
+		}
+		if max, ok := schemaNumber(schema, "maxLength"); ok && length > max {
+			addErr("must be at most %v characters", max)
+		}
+		if p, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(p); err == nil && !re.MatchString(v) {
+				addErr("must match pattern %s", p)
+			}
+		}
+	case float64:
+		if min, ok := schemaNumber(schema, "minimum"); ok && v < min {
+			addErr("must be at least %v", min)
+		}
+		if max, ok := schemaNumber(schema, "maximum"); ok && v > max {
+			addErr("must be at most %v", max)
+		}
+	}
+}
+
+// schemaTypes reads the "type" keyword, which can be a string or array
+func schemaTypes(schema map[string]interface{}) []string {
+	switch t := schema["type"].(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		types := []string{}
+		for _, v := range t {
+			if s, ok := v.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+func schemaNumber(schema map[string]interface{}, key string) (float64, bool) {
+	n, ok := schema[key].(float64)
+	return n, ok
+}
+
+func jsonTypeMatches(t string, val interface{}) bool {
+	switch t {
+	case "object":
+		_, ok := val.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := val.([]interface{})
+		return ok
+	case "string":
+		_, ok := val.(string)
+		return ok
+	case "number":
+		_, ok := val.(float64)
+		return ok
+	case "integer":
+		n, ok := val.(float64)
+		return ok && n == math.Trunc(n)
+	case "boolean":
+		_, ok := val.(bool)
+		return ok
+	case "null":
+		return val == nil
+	}
+	return false
+}
+
+func joinSchemaPath(path, field string) string {
+	if path == "" {
+		return field
+	} else if field == "" {
+		return path
+	}
+	return path + "." + field
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestValidateSchema(t *testing.T) {
+	var schema map[string]interface{}
+	if err := json.Unmarshal([]byte(`{
+		"type": "object",
+		"required": ["title", "license"],
+		"additionalProperties": false,
+		"properties": {
+			"title": { "type": "string", "minLength": 1 },
+			"license": { "enum": ["public domain", "cc-by"] },
+			"year": { "type": "integer", "minimum": 1900 },
+			"keywords": { "type": "array", "items": { "type": "string" } }
+		}
+	}`), &schema); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := CheckSchema(schema); err != nil {
+		t.Fatalf("expected valid schema, got: %s", err.Error())
+	}
+
+	cases := []struct {
+		doc    string
+		fields []string
+	}{
+		{`{ "title": "EPA", "license": "cc-by", "year": 2017, "keywords": ["air"] }`, nil},
+		{`{ "title": "", "license": "cc-by" }`, []string{"title"}},
+		{`{ "title": "EPA" }`, []string{"license"}},
+		{`{ "title": "EPA", "license": "mit", "year": 1850.5 }`, []string{"license", "year"}},
+		{`{ "title": "EPA", "license": "cc-by", "keywords": ["air", 5] }`, []string{"keywords[1]"}},
+		{`{ "title": "EPA", "license": "cc-by", "agency": "EPA" }`, []string{"agency"}},
+		{`[]`, []string{""}},
+	}
+
+	for i, c := range cases {
+		var doc interface{}
+		if err := json.Unmarshal([]byte(c.doc), &doc); err != nil {
+			t.Fatal(err.Error())
+		}
+		errs := ValidateSchema(schema, doc)
+		if len(errs) != len(c.fields) {
+			t.Errorf("case %d: expected %d errors, got %d: %v", i, len(c.fields), len(errs), errs)
+			continue
+		}
+		got := map[string]bool{}
+		for _, se := range errs {
+			got[se.Field] = true
+		}
+		for _, f := range c.fields {
+			if !got[f] {
+				t.Errorf("case %d: expected an error for field '%s', got: %v", i, f, errs)
+			}
+		}
+	}
+
+	if err := CheckSchema(map[string]interface{}{"type": "date"}); err == nil {
+		t.Errorf("expected unsupported type to error")
+	}
+}
+
+func TestCheckSchemaKeywords(t *testing.T) {
+	cases := []struct {
+		schema string
+		err    bool
+	}{
+		{`{ "$schema": "http://json-schema.org/draft-07/schema#", "title": "t", "type": "string", "format": "date" }`, true},
+		{`{ "type": "object", "properties": { "a": { "$ref": "#/definitions/a" } } }`, true},
+		{`{ "anyOf": [{ "type": "string" }, { "type": "number" }] }`, true},
+		{`{ "type": "array", "items": [{ "type": "string" }] }`, true},
+		{`{ "type": "object", "additionalProperties": { "oneOf": [] } }`, true},
+		{`{ "type": "string", "minLength": "1" }`, true},
+		{`{ "required": [1] }`, true},
+		{`{ "title": "t", "description": "d", "type": ["string", "null"], "default": null, "enum": ["a", null] }`, false},
+	}
+
+	for i, c := range cases {
+		var schema map[string]interface{}
+		if err := json.Unmarshal([]byte(c.schema), &schema); err != nil {
+			t.Fatal(err.Error())
+		}
+		if err := CheckSchema(schema); c.err != (err != nil) {
+			t.Errorf("case %d error mismatch. expected error: %t, got: %v", i, c.err, err)
+		}
+	}
+}
+
+func TestValidateSchemaEnum(t *testing.T) {
+	var schema map[string]interface{}
+	if err := json.Unmarshal([]byte(`{ "enum": ["1", true, null, [1], { "a": 1 }] }`), &schema); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	cases := []struct {
+		doc   string
+		valid bool
+	}{
+		{`"1"`, true},
+		{`1`, false},
+		{`true`, true},
+		{`"true"`, false},
+		{`null`, true},
+		{`"<nil>"`, false},
+		{`[1]`, true},
+		{`["1"]`, false},
+		{`{ "a": 1 }`, true},
+		{`"map[a:1]"`, false},
+	}
+
+	for i, c := range cases {
+		var doc interface{}
+		if err := json.Unmarshal([]byte(c.doc), &doc); err != nil {
+			t.Fatal(err.Error())
+		}
+		if errs := ValidateSchema(schema, doc); c.valid != (errs == nil) {
+			t.Errorf("case %d valid mismatch. expected: %t, got errors: %v", i, c.valid, errs)
+		}
+	}
+}
@@ -0,0 +1,535 @@
+package main
+
+import (
+	"database/sql"
+	"strconv"
+
+	"github.com/datatogether/core"
+)
+
+const (
+	primerCols = `id, created, updated, short_title, title, description,
+  parent_id, stats, meta`
+	sourceCols = `id, created, updated, title, description, url, primer_id, crawl, stale_duration,
+  last_alert_sent, meta, stats`
+	urlCols = `urls.url, urls.created, urls.updated, last_head, last_get, status, content_type, content_sniff,
+  content_length, file_name, title, id, headers_took, download_took, headers, meta, hash`
+	collectionCols = `id, created, updated, creator, title, description, url`
+	metadataCols   = `hash, time_stamp, key_id, subject, prev, meta`
+	alertCols      = `id, created, updated, source_id, primer_id, message, last_fetched, dismissed, dismissed_by`
+)
+
+// conditions for fetched, non-empty, non-html content urls matching the url
+// pattern $1, as core's source content queries match them
+const sourceContentWhere = `url ilike $1 AND
+  content_sniff != 'text/html; charset=utf-8' AND
+  last_get is not null AND
+  hash != '1220e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855'`
+
+var (
+	primersKeyset = keyset{
+		cols:     primerCols,
+		from:     "primers",
+		where:    "deleted = false",
+		sort:     "created",
+		sortType: "timestamp",
+		id:       "id",
+		idType:   "uuid",
+	}
+	// primers without a parent
+	basePrimersKeyset = keyset{
+		cols:     primerCols,
+		from:     "primers",
+		where:    "deleted = false AND parent_id = ''",
+		sort:     "created",
+		sortType: "timestamp",
+		id:       "id",
+		idType:   "uuid",
+	}
+	sourcesKeyset = keyset{
+		cols:     sourceCols,
+		from:     "sources",
+		where:    "deleted = false",
+		sort:     "created",
+		sortType: "timestamp",
+		id:       "id",
+		idType:   "uuid",
+	}
+	// urls that have been fetched & resolve to non-html content
+	contentUrlsKeyset = keyset{
+		cols: urlCols,
+		from: "urls",
+		where: `last_get is not null AND
+  content_sniff != 'text/html; charset=utf-8' AND
+  content_sniff != '' AND
+  hash != ''`,
+		sort:     "urls.created",
+		sortType: "timestamp",
+		id:       "urls.url",
+		idType:   "text",
+	}
+	// urls that link to the url given as $1
+	inboundLinksKeyset = keyset{
+		cols:     urlCols,
+		from:     "urls, links",
+		where:    "links.dst = $1 AND links.src = urls.url",
+		sort:     "urls.url",
+		sortType: "text",
+		id:       "urls.url",
+		idType:   "text",
+		asc:      true,
+	}
+	// urls the url given as $1 links to
+	outboundLinksKeyset = keyset{
+		cols:     urlCols,
+		from:     "urls, links",
+		where:    "links.src = $1 AND links.dst = urls.url",
+		sort:     "urls.url",
+		sortType: "text",
+		id:       "urls.url",
+		idType:   "text",
+		asc:      true,
+	}
+	// content urls matching the source url pattern $1 whose content has no
+	// metadata, matching core's undescribed content
+	sourceUndescribedKeyset = keyset{
+		cols:     urlCols,
+		from:     "urls",
+		where:    sourceContentWhere + " AND NOT EXISTS (SELECT 1 FROM metadata WHERE metadata.subject = urls.hash)",
+		sort:     "urls.created",
+		sortType: "timestamp",
+		id:       "urls.url",
+		idType:   "text",
+	}
+	// content urls matching the source url pattern $1 whose content has
+	// metadata, matching core's described content
+	sourceDescribedKeyset = keyset{
+		cols:     urlCols,
+		from:     "urls",
+		where:    sourceContentWhere + " AND EXISTS (SELECT 1 FROM metadata WHERE metadata.subject = urls.hash)",
+		sort:     "urls.created",
+		sortType: "timestamp",
+		id:       "urls.url",
+		idType:   "text",
+	}
+	// collections anyone can browse
+	collectionsKeyset = keyset{
+		cols:     collectionCols,
+		from:     "collections",
+		where:    "visibility = 'public'",
+		sort:     "created",
+		sortType: "timestamp",
+		id:       "id",
+		idType:   "uuid",
+	}
+	// collections created by the key given as $1. non-public collections are
+	// only included when $2 is true
+	creatorCollectionsKeyset = keyset{
+		cols:     collectionCols,
+		from:     "collections",
+		where:    "creator = $1 AND (visibility = 'public' OR $2)",
+		sort:     "created",
+		sortType: "timestamp",
+		id:       "id",
+		idType:   "uuid",
+	}
+	// items of the collection given as $1 in collection order
+	collectionItemsKeyset = keyset{
+		cols:     "ci.collection_id, u.id, u.hash, u.url, u.title, ci.index, ci.description",
+		from:     "collection_items AS ci JOIN urls AS u ON u.id = ci.url_id",
+		where:    "ci.collection_id = $1",
+		sort:     "ci.index",
+		sortType: "integer",
+		id:       "ci.url_id",
+		idType:   "text",
+		asc:      true,
+	}
+	// the latest metadata for each subject written by the key given as $1
+	keyMetadataKeyset = keyset{
+		cols: metadataCols,
+		from: `(SELECT DISTINCT ON (subject) ` + metadataCols + `
+  FROM metadata
+  WHERE key_id = $1 AND deleted = false
+  ORDER BY subject, time_stamp DESC) AS latest`,
+		sort:     "subject",
+		sortType: "text",
+		id:       "hash",
+		idType:   "text",
+		asc:      true,
+	}
+	// versions of the collection given as $1. versions created in the same
+	// second are ordered by when they were recorded
+	collectionVersionsKeyset = keyset{
+		cols: `hash, collection_id, prev, created, key_id, restored_from, creator, title, description, url,
+  json_array_length(coalesce(items, '[]')), seq`,
+		from:     "collection_versions",
+		where:    "collection_id = $1",
+		sort:     "created",
+		sortType: "timestamp",
+		id:       "seq",
+		idType:   "integer",
+	}
+	// audit log entries, optionally only those for the subject given as $1
+	auditLogKeyset = keyset{
+		cols:     "id, created, key_id, action, subject_type, subject_id, prev, next",
+		from:     "audit_log",
+		where:    "$1 = '' OR subject_id = $1",
+		sort:     "created",
+		sortType: "timestamp",
+		id:       "id",
+		idType:   "uuid",
+	}
+	// alerts that are dismissed or not as $1, optionally only those for the
+	// source given as $2
+	alertsKeyset = keyset{
+		cols:     alertCols,
+		from:     "alerts",
+		where:    "dismissed = $1 AND ($2 = '' OR source_id::text = $2)",
+		sort:     "created",
+		sortType: "timestamp",
+		id:       "id",
+		idType:   "uuid",
+	}
+	// uncrawlables, optionally only those for the subprimer given as $1 & the
+	// agency id or name given as $2
+	uncrawlablesKeyset = keyset{
+		cols: `id, url, created, updated, creator_key_id,
+  name, email, event_name, agency_name,
+  agency_id, subagency_id, org_id, suborg_id, subprimer_id,
+  ftp, database, interactive, many_files,
+  comments`,
+		from:     "uncrawlables",
+		where:    "deleted = false AND ($1 = '' OR subprimer_id = $1) AND ($2 = '' OR agency_id = $2 OR agency_name ilike $2)",
+		sort:     "created",
+		sortType: "timestamp",
+		id:       "url",
+		idType:   "text",
+	}
+	// custom crawls, optionally only those covering the url given as $1
+	customCrawlsKeyset = keyset{
+		cols: `id, created, updated,
+  jwt, morphRunId, dateCompleted, githubRepo, originalUrl,
+  sqliteChecksum`,
+		from:     "custom_crawls",
+		where:    "$1 = '' OR originalUrl = $1",
+		sort:     "created",
+		sortType: "timestamp",
+		id:       "id",
+		idType:   "uuid",
+	}
+	// data repos that haven't been deleted, optionally only those whose title
+	// or description contains $1. % & _ in $1 must be escaped
+	dataReposKeyset = keyset{
+		cols:     "id, created, updated, title, description, url",
+		from:     "data_repos",
+		where:    `deleted = false AND ($1 = '' OR title ilike '%' || $1 || '%' ESCAPE '\' OR description ilike '%' || $1 || '%' ESCAPE '\')`,
+		sort:     "created",
+		sortType: "timestamp",
+		id:       "id",
+		idType:   "uuid",
+	}
+	// archive requests, optionally only those by the user given as $1 & for
+	// the url given as $2
+	archiveRequestsKeyset = keyset{
+		cols:     "id, created, url, user_id, origin",
+		from:     "archive_requests",
+		where:    "($1 = '' OR user_id = $1) AND ($2 = '' OR url = $2)",
+		sort:     "created",
+		sortType: "timestamp",
+		id:       "id",
+		idType:   "integer",
+	}
+	// collections the key given as $1 collaborates on
+	sharedCollectionsKeyset = keyset{
+		cols: `collections.id, collections.created, collections.updated, collections.creator,
+  collections.title, collections.description, collections.url`,
+		from:     "collections JOIN collection_collaborators ON collection_collaborators.collection_id = collections.id",
+		where:    "collection_collaborators.key_id = $1",
+		sort:     "collections.created",
+		sortType: "timestamp",
+		id:       "collections.id",
+		idType:   "uuid",
+	}
+)
+
+// ListPrimersPage reads a page of primers, optionally only those without
+// a parent
+func ListPrimersPage(db sqlQueryable, baseOnly bool, p *PageParams) ([]*core.Primer, *Page, error) {
+	k := primersKeyset
+	if baseOnly {
+		k = basePrimersKeyset
+	}
+	results, page, err := readKeysetPage(db, k, p, func(rows *sql.Rows) (interface{}, Cursor, error) {
+		pr := &core.Primer{}
+		err := pr.UnmarshalSQL(rows)
+		return pr, Cursor{Sort: cursorTime(pr.Created), Id: pr.Id}, err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	primers := make([]*core.Primer, len(results))
+	for i, r := range results {
+		primers[i] = r.(*core.Primer)
+	}
+	return primers, page, nil
+}
+
+// ListSourcesPage reads a page of sources
+func ListSourcesPage(db sqlQueryable, p *PageParams) ([]*core.Source, *Page, error) {
+	results, page, err := readKeysetPage(db, sourcesKeyset, p, func(rows *sql.Rows) (interface{}, Cursor, error) {
+		s := &core.Source{}
+		err := s.UnmarshalSQL(rows)
+		return s, Cursor{Sort: cursorTime(s.Created), Id: s.Id}, err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sources := make([]*core.Source, len(results))
+	for i, r := range results {
+		sources[i] = r.(*core.Source)
+	}
+	return sources, page, nil
+}
+
+// ListContentUrlsPage reads a page of urls that resolve to content
+func ListContentUrlsPage(db sqlQueryable, p *PageParams) ([]*core.Url, *Page, error) {
+	return readUrlsPage(db, contentUrlsKeyset, p, func(u *core.Url) Cursor {
+		return Cursor{Sort: cursorTime(u.Created), Id: u.Url}
+	})
+}
+
+// ListSourceContentPage reads a page of a source's content urls, those with
+// metadata if described is true & those without otherwise
+func ListSourceContentPage(db sqlQueryable, s *core.Source, described bool, p *PageParams) ([]*core.Url, *Page, error) {
+	k := sourceUndescribedKeyset
+	if described {
+		k = sourceDescribedKeyset
+	}
+	return readUrlsPage(db, k, p, func(u *core.Url) Cursor {
+		return Cursor{Sort: cursorTime(u.Created), Id: u.Url}
+	}, "%"+s.Url+"%")
+}
+
+// ListInboundLinksPage reads a page of links to a url
+func ListInboundLinksPage(db sqlQueryable, dst *core.Url, p *PageParams) ([]*core.Link, *Page, error) {
+	urls, page, err := readUrlsPage(db, inboundLinksKeyset, p, urlCursor, dst.Url)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	links := make([]*core.Link, len(urls))
+	for i, src := range urls {
+		links[i] = &core.Link{Src: src, Dst: dst}
+	}
+	return links, page, nil
+}
+
+// ListOutboundLinksPage reads a page of links from a url
+func ListOutboundLinksPage(db sqlQueryable, src *core.Url, p *PageParams) ([]*core.Link, *Page, error) {
+	urls, page, err := readUrlsPage(db, outboundLinksKeyset, p, urlCursor, src.Url)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	links := make([]*core.Link, len(urls))
+	for i, dst := range urls {
+		links[i] = &core.Link{Src: src, Dst: dst}
+	}
+	return links, page, nil
+}
+
+// urlCursor positions url lists sorted by url
+func urlCursor(u *core.Url) Cursor {
+	return Cursor{Sort: u.Url, Id: u.Url}
+}
+
+func readUrlsPage(db sqlQueryable, k keyset, p *PageParams, key func(u *core.Url) Cursor, args ...interface{}) ([]*core.Url, *Page, error) {
+	results, page, err := readKeysetPage(db, k, p, func(rows *sql.Rows) (interface{}, Cursor, error) {
+		u := &core.Url{}
+		err := u.UnmarshalSQL(rows)
+		return u, key(u), err
+	}, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	urls := make([]*core.Url, len(results))
+	for i, r := range results {
+		urls[i] = r.(*core.Url)
+	}
+	return urls, page, nil
+}
+
+// ListCollectionsPage reads a page of collections
+func ListCollectionsPage(db sqlQueryable, p *PageParams) ([]*core.Collection, *Page, error) {
+	results, page, err := readKeysetPage(db, collectionsKeyset, p, func(rows *sql.Rows) (interface{}, Cursor, error) {
+		c := &core.Collection{}
+		err := c.UnmarshalSQL(rows)
+		return c, Cursor{Sort: cursorTime(c.Created), Id: c.Id}, err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	collections := make([]*core.Collection, len(results))
+	for i, r := range results {
+		collections[i] = r.(*core.Collection)
+	}
+	return collections, page, nil
+}
+
+// ListKeyMetadataPage reads a page of the latest metadata for each subject
+// a key has described
+func ListKeyMetadataPage(db sqlQueryable, keyId string, p *PageParams) ([]*core.Metadata, *Page, error) {
+	results, page, err := readKeysetPage(db, keyMetadataKeyset, p, func(rows *sql.Rows) (interface{}, Cursor, error) {
+		m := &core.Metadata{}
+		err := m.UnmarshalSQL(rows)
+		return m, Cursor{Sort: m.Subject, Id: m.Hash}, err
+	}, keyId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	metadata := make([]*core.Metadata, len(results))
+	for i, r := range results {
+		metadata[i] = r.(*core.Metadata)
+	}
+	return metadata, page, nil
+}
+
+// ListCreatorCollectionsPage reads a page of the collections created by
+// creator, newest first. unlisted & private collections are only included
+// if includeHidden is true
+func ListCreatorCollectionsPage(db sqlQueryable, creator string, includeHidden bool, p *PageParams) ([]*core.Collection, *Page, error) {
+	results, page, err := readKeysetPage(db, creatorCollectionsKeyset, p, func(rows *sql.Rows) (interface{}, Cursor, error) {
+		c := &core.Collection{}
+		err := c.UnmarshalSQL(rows)
+		return c, Cursor{Sort: cursorTime(c.Created), Id: c.Id}, err
+	}, creator, includeHidden)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	collections := make([]*core.Collection, len(results))
+	for i, r := range results {
+		collections[i] = r.(*core.Collection)
+	}
+	return collections, page, nil
+}
+
+// ListCollectionItemsPage reads a page of a collection's items in
+// collection order
+func ListCollectionItemsPage(db sqlQueryable, collectionId string, p *PageParams) ([]*core.CollectionItem, *Page, error) {
+	results, page, err := readKeysetPage(db, collectionItemsKeyset, p, func(rows *sql.Rows) (interface{}, Cursor, error) {
+		ci := &core.CollectionItem{}
+		err := ci.UnmarshalSQL(rows)
+		return ci, Cursor{Sort: strconv.Itoa(ci.Index), Id: ci.Url.Id}, err
+	}, collectionId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	items := make([]*core.CollectionItem, len(results))
+	for i, r := range results {
+		items[i] = r.(*core.CollectionItem)
+	}
+	return items, page, nil
+}
+
+// ListUncrawlablesPage reads a page of uncrawlables, filtering by subprimer
+// id & agency id or name if either is non-empty
+func ListUncrawlablesPage(db sqlQueryable, subprimerId, agency string, p *PageParams) ([]*core.Uncrawlable, *Page, error) {
+	results, page, err := readKeysetPage(db, uncrawlablesKeyset, p, func(rows *sql.Rows) (interface{}, Cursor, error) {
+		u := &core.Uncrawlable{}
+		err := u.UnmarshalSQL(rows)
+		return u, Cursor{Sort: cursorTime(u.Created), Id: u.Url}, err
+	}, subprimerId, agency)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	uncrawlables := make([]*core.Uncrawlable, len(results))
+	for i, r := range results {
+		uncrawlables[i] = r.(*core.Uncrawlable)
+	}
+	return uncrawlables, page, nil
+}
+
+// ListCustomCrawlsPage reads a page of custom crawls, only those covering
+// url if it's non-empty
+func ListCustomCrawlsPage(db sqlQueryable, url string, p *PageParams) ([]*core.CustomCrawl, *Page, error) {
+	results, page, err := readKeysetPage(db, customCrawlsKeyset, p, func(rows *sql.Rows) (interface{}, Cursor, error) {
+		c := &core.CustomCrawl{}
+		err := c.UnmarshalSQL(rows)
+		return c, Cursor{Sort: cursorTime(c.Created), Id: c.Id}, err
+	}, url)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	crawls := make([]*core.CustomCrawl, len(results))
+	for i, r := range results {
+		crawls[i] = r.(*core.CustomCrawl)
+	}
+	return crawls, page, nil
+}
+
+// ListDataReposPage reads a page of data repos that haven't been deleted,
+// matching search against title & description if it's non-empty. search is
+// matched literally
+func ListDataReposPage(db sqlQueryable, search string, p *PageParams) ([]*core.DataRepo, *Page, error) {
+	results, page, err := readKeysetPage(db, dataReposKeyset, p, func(rows *sql.Rows) (interface{}, Cursor, error) {
+		d := &core.DataRepo{}
+		err := d.UnmarshalSQL(rows)
+		return d, Cursor{Sort: cursorTime(d.Created), Id: d.Id}, err
+	}, escapeLike(search))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	repos := make([]*core.DataRepo, len(results))
+	for i, r := range results {
+		repos[i] = r.(*core.DataRepo)
+	}
+	return repos, page, nil
+}
+
+// ListArchiveRequestsPage reads a page of archive requests, filtering by
+// userId and url if either is non-empty
+func ListArchiveRequestsPage(db sqlQueryable, userId, url string, p *PageParams) ([]*ArchiveRequest, *Page, error) {
+	results, page, err := readKeysetPage(db, archiveRequestsKeyset, p, func(rows *sql.Rows) (interface{}, Cursor, error) {
+		r := &ArchiveRequest{}
+		err := r.UnmarshalSQL(rows)
+		return r, Cursor{Sort: cursorTime(r.Created), Id: strconv.Itoa(r.Id)}, err
+	}, userId, url)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reqs := make([]*ArchiveRequest, len(results))
+	for i, r := range results {
+		reqs[i] = r.(*ArchiveRequest)
+	}
+	return reqs, page, nil
+}
+
+// ListSharedCollectionsPage reads a page of the collections shared with
+// keyId, newest first
+func ListSharedCollectionsPage(db sqlQueryable, keyId string, p *PageParams) ([]*core.Collection, *Page, error) {
+	results, page, err := readKeysetPage(db, sharedCollectionsKeyset, p, func(rows *sql.Rows) (interface{}, Cursor, error) {
+		c := &core.Collection{}
+		err := c.UnmarshalSQL(rows)
+		return c, Cursor{Sort: cursorTime(c.Created), Id: c.Id}, err
+	}, keyId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	collections := make([]*core.Collection, len(results))
+	for i, r := range results {
+		collections[i] = r.(*core.Collection)
+	}
+	return collections, page, nil
+}
@@ -48,7 +48,8 @@ func setupTestDatabase() func() {
 		"snapshots",
 		"collections",
 		"archive_requests",
-		"uncrawlables"); err != nil {
+		"uncrawlables",
+		"data_repos"); err != nil {
 		panic(err.Error())
 	}
 
@@ -70,10 +71,21 @@ func initializeAppSchema(db *sql.DB) (func(), error) {
 		"create-urls",
 		"create-links",
 		"create-metadata",
+		"create-metadata_signatures",
 		"create-snapshots",
 		"create-collections",
+		"create-collection_versions",
+		"create-collection_collaborators",
+		"create-audit_log",
+		"create-alerts",
+		"create-supress_alerts",
 		"create-archive_requests",
 		"create-uncrawlables",
+		"create-custom_crawls",
+		"create-data_repos",
+		"create-collection_items",
+		"create-indexes",
+		"create-search",
 	} {
 		if _, err := schema.Exec(db, cmd); err != nil {
 			fmt.Println(cmd, "error:", err)
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/datatogether/core"
+)
+
+// WriteMetadata validates & writes the next version of metadata for a subject
+// under keyId. sig is the author's signature of the new version, if nil the
+// server signs it
+func WriteMetadata(keyId, subject string, meta map[string]interface{}, sig *MetadataSignature) (*core.Metadata, error) {
+	if sig == nil && signingKey == nil {
+		return nil, fmt.Errorf("metadata must be signed")
+	}
+	if err := ValidateSubjectMetadata(appDB, subject, keyId, meta); err != nil {
+		return nil, err
+	}
+
+	m, err := core.NextMetadata(appDB, keyId, subject)
+	if err != nil {
+		return nil, err
+	}
+	m.Meta = meta
+
+	if sig != nil {
+		if err := sig.Verify(m); err != nil {
+			return nil, err
+		}
+	} else if sig, err = SignMetadata(m, signingKey); err != nil {
+		return nil, err
+	}
+
+	// metadata is only written along with its signature
+	err = withTx(appDB, func(tx sqlQueryExecable) error {
+		if err := insertMetadata(tx, m); err != nil {
+			return err
+		}
+		sig.Hash = m.Hash
+		return sig.Insert(tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	setMetadataUrlTitle(m)
+	return m, nil
+}
+
+// insertMetadata timestamps, hashes & inserts metadata as core's
+// Metadata.Write does, using db so it can be part of a transaction. the
+// timestamp is hashed in UTC, as it's read back from the database
+func insertMetadata(db sqlExecable, m *core.Metadata) error {
+	m.Timestamp = time.Now().Round(time.Second).In(time.UTC)
+	data, err := m.HashableBytes()
+	if err != nil {
+		return err
+	}
+	if m.Hash, err = core.CalcHash(data); err != nil {
+		return err
+	}
+	meta, err := json.Marshal(m.Meta)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(qMetadataInsert, m.Hash, m.Timestamp, m.KeyId, m.Subject, m.Prev, meta)
+	return err
+}
+
+// setMetadataUrlTitle sets the title of urls for the metadata's subject to
+// its title field in the background, as core's Metadata.Write does
+func setMetadataUrlTitle(m *core.Metadata) {
+	title, ok := m.Meta["title"].(string)
+	if !ok || title == "" {
+		return
+	}
+	go func() {
+		u := &core.Url{Hash: m.Subject}
+		if err := u.Read(store); err != nil {
+			return
+		}
+		u.Title = title
+		if err := u.Save(store); err != nil {
+			log.Infof("error setting title of %s: %s", u.Url, err.Error())
+		}
+	}()
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/datatogether/core"
+)
+
+// max number of metadata entries written to a single export
+const maxMetadataExportRows = 10000
+
+// MetadataExport describes a set of metadata to export. Exactly one of KeyId,
+// SourceId or CollectionId should be set
+type MetadataExport struct {
+	KeyId        string
+	SourceId     string
+	CollectionId string
+	// MetadataFormatCSV or MetadataFormatJSONL, defaults to JSON Lines
+	Format string
+}
+
+// Filename gives a name for the exported file
+func (e *MetadataExport) Filename() string {
+	name := "metadata"
+	switch {
+	case e.KeyId != "":
+		name = fmt.Sprintf("metadata-%s", e.KeyId)
+	case e.SourceId != "":
+		name = fmt.Sprintf("source-%s-metadata", e.SourceId)
+	case e.CollectionId != "":
+		name = fmt.Sprintf("collection-%s-metadata", e.CollectionId)
+	}
+	return name + "." + e.Format
+}
+
+// query gives the query & its first argument for the metadata this export
+// covers. key exports give the key's latest metadata for each subject,
+// source & collection exports give the latest metadata from each key for
+// each subject
+func (e *MetadataExport) query() (string, interface{}, error) {
+	switch {
+	case e.KeyId != "":
+		return qKeyMetadataExport, e.KeyId, nil
+	case e.SourceId != "":
+		s := &core.Source{Id: e.SourceId}
+		if err := s.Read(store); err != nil {
+			return "", nil, err
+		}
+		return qSourceMetadataExport, escapeLike(s.Url), nil
+	case e.CollectionId != "":
+		c := &core.Collection{Id: e.CollectionId}
+		if err := c.Read(store); err != nil {
+			return "", nil, err
+		}
+		return qCollectionMetadataExport, c.Id, nil
+	}
+	return "", nil, fmt.Errorf("keyId, sourceId or collectionId is required")
+}
+
+// Query starts reading the metadata this export covers, along with the
+// metadata fields to write as columns of a csv export. callers must close rows
+func (e *MetadataExport) Query(db *sql.DB) (rows *sql.Rows, fields []string, err error) {
+	if e.Format, err = MetadataFormat(e.Format, ""); err != nil {
+		return nil, nil, err
+	}
+	q, arg, err := e.query()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if e.Format == MetadataFormatCSV {
+		if fields, err = metadataExportFields(db, q, arg); err != nil {
+			return nil, nil, err
+		}
+	}
+	rows, err = db.Query(q, arg, maxMetadataExportRows)
+	return rows, fields, err
+}
+
+// metadataExportFields lists the fields of all metadata an export query
+// reads, except reserved columns, in alphabetical order
+func metadataExportFields(db *sql.DB, q string, arg interface{}) ([]string, error) {
+	rows, err := db.Query(fmt.Sprintf(qMetadataExportFields, strings.TrimSuffix(q, ";")), arg, maxMetadataExportRows)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fields := []string{}
+	for rows.Next() {
+		var field string
+		if err := rows.Scan(&field); err != nil {
+			return nil, err
+		}
+		if !metadataReservedColumns[field] {
+			fields = append(fields, field)
+		}
+	}
+	return fields, rows.Err()
+}
+
+// Write writes the export to w, returning the number of rows written
+func (e *MetadataExport) Write(db *sql.DB, w io.Writer) (int, error) {
+	rows, fields, err := e.Query(db)
+	if err != nil {
+		return 0, err
+	}
+	return e.WriteRows(w, rows, fields)
+}
+
+// WriteRows streams metadata rows from Query to w in the export's format,
+// closing rows & returning the number of rows written
+func (e *MetadataExport) WriteRows(w io.Writer, rows *sql.Rows, fields []string) (int, error) {
+	defer rows.Close()
+
+	var mw metadataWriter = newMetadataJSONLWriter(w)
+	if e.Format == MetadataFormatCSV {
+		cw, err := newMetadataCSVWriter(w, fields)
+		if err != nil {
+			return 0, err
+		}
+		mw = cw
+	}
+
+	n := 0
+	for rows.Next() {
+		m := &core.Metadata{}
+		if err := m.UnmarshalSQL(rows); err != nil {
+			return n, err
+		}
+		if err := mw.Write(m); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return n, err
+	}
+	return n, mw.Flush()
+}
+
+// metadataWriter writes metadata to a file one entry at a time
+type metadataWriter interface {
+	Write(m *core.Metadata) error
+	Flush() error
+}
+
+// metadataJSONLWriter writes metadata as one MetadataRecord per line
+type metadataJSONLWriter struct {
+	enc *json.Encoder
+}
+
+func newMetadataJSONLWriter(w io.Writer) *metadataJSONLWriter {
+	return &metadataJSONLWriter{enc: json.NewEncoder(w)}
+}
+
+func (mw *metadataJSONLWriter) Write(m *core.Metadata) error {
+	ts := m.Timestamp
+	return mw.enc.Encode(&MetadataRecord{
+		Hash:      m.Subject,
+		KeyId:     m.KeyId,
+		Timestamp: &ts,
+		Meta:      m.Meta,
+	})
+}
+
+func (mw *metadataJSONLWriter) Flush() error { return nil }
+
+// metadataCSVWriter writes metadata as CSV with hash, keyId & timestamp
+// columns followed by a column for each of a set of metadata fields.
+// non-string values are JSON encoded
+type metadataCSVWriter struct {
+	cw     *csv.Writer
+	fields []string
+}
+
+// newMetadataCSVWriter writes the header row for fields
+func newMetadataCSVWriter(w io.Writer, fields []string) (*metadataCSVWriter, error) {
+	mw := &metadataCSVWriter{cw: csv.NewWriter(w), fields: fields}
+	if err := mw.cw.Write(append([]string{"hash", "keyId", "timestamp"}, fields...)); err != nil {
+		return nil, err
+	}
+	return mw, nil
+}
+
+func (mw *metadataCSVWriter) Write(m *core.Metadata) error {
+	row := []string{m.Subject, m.KeyId, m.Timestamp.In(time.UTC).Format(time.RFC3339)}
+	for _, field := range mw.fields {
+		cell, err := csvMetadataCell(m.Meta[field])
+		if err != nil {
+			return err
+		}
+		row = append(row, cell)
+	}
+	return mw.cw.Write(row)
+}
+
+func (mw *metadataCSVWriter) Flush() error {
+	mw.cw.Flush()
+	return mw.cw.Error()
+}
+
+// WriteMetadataJSONL writes metadata as one MetadataRecord per line
+func WriteMetadataJSONL(w io.Writer, metadata []*core.Metadata) error {
+	mw := newMetadataJSONLWriter(w)
+	for _, m := range metadata {
+		if err := mw.Write(m); err != nil {
+			return err
+		}
+	}
+	return mw.Flush()
+}
+
+// WriteMetadataCSV writes metadata as CSV with hash, keyId & timestamp
+// columns followed by a column for every field in metadata, in alphabetical
+// order. non-string values are JSON encoded
+func WriteMetadataCSV(w io.Writer, metadata []*core.Metadata) error {
+	fieldSet := map[string]bool{}
+	for _, m := range metadata {
+		for field := range m.Meta {
+			if !metadataReservedColumns[field] {
+				fieldSet[field] = true
+			}
+		}
+	}
+	fields := make([]string, 0, len(fieldSet))
+	for field := range fieldSet {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	mw, err := newMetadataCSVWriter(w, fields)
+	if err != nil {
+		return err
+	}
+	for _, m := range metadata {
+		if err := mw.Write(m); err != nil {
+			return err
+		}
+	}
+	return mw.Flush()
+}
+
+func csvMetadataCell(v interface{}) (string, error) {
+	switch val := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return val, nil
+	}
+	data, err := json.Marshal(v)
+	return string(data), err
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSourceMetadataExportQuery(t *testing.T) {
+	// source urls are stored without a scheme, as the census source is
+	rows, err := appDB.Query(qSourceMetadataExport, escapeLike("www.census.gov"), maxMetadataExportRows)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if n != 1 {
+		t.Errorf("expected 1 metadata entry for census content, got: %d", n)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/datatogether/core"
+)
+
+// max number of versions MetadataHistory will follow, guarding against
+// cycles in the prev chain
+const maxMetadataHistory = 1000
+
+// ReadMetadataByHash reads a single version of metadata
+func ReadMetadataByHash(db sqlQueryable, hash string) (*core.Metadata, error) {
+	m := &core.Metadata{}
+	if err := m.UnmarshalSQL(db.QueryRow(qMetadataByHash, hash)); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// MetadataHistory walks the prev chain of metadata a key has written for
+// a subject, returning all versions starting with the latest
+func MetadataHistory(db sqlQueryable, keyId, subject string) ([]*core.Metadata, error) {
+	m, err := core.LatestMetadata(db, keyId, subject)
+	if err != nil {
+		if err == core.ErrNotFound {
+			return []*core.Metadata{}, nil
+		}
+		return nil, err
+	}
+
+	history := []*core.Metadata{m}
+	for m.Prev != "" {
+		if len(history) >= maxMetadataHistory {
+			return nil, fmt.Errorf("metadata history for %s exceeds %d versions", subject, maxMetadataHistory)
+		}
+		prev := m.Prev
+		if m, err = ReadMetadataByHash(db, prev); err != nil {
+			return nil, fmt.Errorf("error reading previous version %s: %s", prev, err.Error())
+		}
+		history = append(history, m)
+	}
+
+	return history, nil
+}
+
+// MetadataChange is a difference in a single field between two versions of
+// metadata. nested fields are named with dot-separated paths
+type MetadataChange struct {
+	Field string `json:"field"`
+	// one of "added", "removed" or "changed"
+	Change string      `json:"change"`
+	From   interface{} `json:"from,omitempty"`
+	To     interface{} `json:"to,omitempty"`
+}
+
+// DiffMetadata compares the fields of two versions of metadata, returning
+// changes ordered by field name
+func DiffMetadata(from, to *core.Metadata) []*MetadataChange {
+	a, b := map[string]interface{}{}, map[string]interface{}{}
+	flattenMeta("", from.Meta, a)
+	flattenMeta("", to.Meta, b)
+
+	changes := []*MetadataChange{}
+	for field, av := range a {
+		bv, ok := b[field]
+		if !ok {
+			changes = append(changes, &MetadataChange{Field: field, Change: "removed", From: av})
+		} else if !reflect.DeepEqual(av, bv) {
+			changes = append(changes, &MetadataChange{Field: field, Change: "changed", From: av, To: bv})
+		}
+	}
+	for field, bv := range b {
+		if _, ok := a[field]; !ok {
+			changes = append(changes, &MetadataChange{Field: field, Change: "added", To: bv})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+// flattenMeta writes nested objects in meta to dest as dot-separated paths.
+// arrays are treated as single values
+func flattenMeta(prefix string, meta map[string]interface{}, dest map[string]interface{}) {
+	for key, val := range meta {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if obj, ok := val.(map[string]interface{}); ok && len(obj) > 0 {
+			flattenMeta(key, obj, dest)
+			continue
+		}
+		dest[key] = val
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// MetadataHistoryAction fetches all versions of the metadata a key has
+// written for a subject, latest first
+type MetadataHistoryAction struct {
+	ReqAction
+	KeyId   string `json:"keyId"`
+	Subject string `json:"subject"`
+}
+
+func (MetadataHistoryAction) Type() string        { return "METADATA_HISTORY_REQUEST" }
+func (MetadataHistoryAction) SuccessType() string { return "METADATA_HISTORY_SUCCESS" }
+func (MetadataHistoryAction) FailureType() string { return "METADATA_HISTORY_FAILURE" }
+
+func (MetadataHistoryAction) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &MetadataHistoryAction{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *MetadataHistoryAction) Exec() (res *ClientResponse) {
+	history, err := MetadataHistory(appDB, a.KeyId, a.Subject)
+	if err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "METADATA_ARRAY",
+		Id:        a.Subject,
+		Data:      history,
+	}
+}
+
+// MetadataDiffAction compares two versions of metadata for the same subject
+// by hash
+type MetadataDiffAction struct {
+	ReqAction
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+func (MetadataDiffAction) Type() string        { return "METADATA_DIFF_REQUEST" }
+func (MetadataDiffAction) SuccessType() string { return "METADATA_DIFF_SUCCESS" }
+func (MetadataDiffAction) FailureType() string { return "METADATA_DIFF_FAILURE" }
+
+func (MetadataDiffAction) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &MetadataDiffAction{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *MetadataDiffAction) Exec() (res *ClientResponse) {
+	diff, err := a.diff()
+	if err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "METADATA_DIFF",
+		Data:      diff,
+	}
+}
+
+func (a *MetadataDiffAction) diff() (map[string]interface{}, error) {
+	from, err := ReadMetadataByHash(appDB, a.From)
+	if err != nil {
+		return nil, fmt.Errorf("error reading version %s: %s", a.From, err.Error())
+	}
+	to, err := ReadMetadataByHash(appDB, a.To)
+	if err != nil {
+		return nil, fmt.Errorf("error reading version %s: %s", a.To, err.Error())
+	}
+	if from.Subject != to.Subject {
+		return nil, fmt.Errorf("can only compare metadata for the same subject")
+	}
+
+	return map[string]interface{}{
+		"subject": from.Subject,
+		"from":    from,
+		"to":      to,
+		"changes": DiffMetadata(from, to),
+	}, nil
+}
+
+// VerifyMetadataAction checks the hashes, prev links & signatures of every
+// version of the metadata a key has written for a subject
+type VerifyMetadataAction struct {
+	ReqAction
+	KeyId   string `json:"keyId"`
+	Subject string `json:"subject"`
+}
+
+func (VerifyMetadataAction) Type() string        { return "METADATA_VERIFY_REQUEST" }
+func (VerifyMetadataAction) SuccessType() string { return "METADATA_VERIFY_SUCCESS" }
+func (VerifyMetadataAction) FailureType() string { return "METADATA_VERIFY_FAILURE" }
+
+func (VerifyMetadataAction) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &VerifyMetadataAction{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *VerifyMetadataAction) Exec() (res *ClientResponse) {
+	history, err := MetadataHistory(appDB, a.KeyId, a.Subject)
+	if err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	valid, versions := VerifyMetadataChain(appDB, history)
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "METADATA_VERIFICATION",
+		Id:        a.Subject,
+		Data: map[string]interface{}{
+			"keyId":    a.KeyId,
+			"subject":  a.Subject,
+			"valid":    valid && len(versions) > 0,
+			"versions": versions,
+		},
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/datatogether/core"
+)
+
+func TestDiffMetadata(t *testing.T) {
+	from := &core.Metadata{Meta: map[string]interface{}{
+		"title":       "EPA",
+		"description": "air quality",
+		"keywords":    []interface{}{"air"},
+		"contact":     map[string]interface{}{"name": "a", "email": "a@epa.gov"},
+	}}
+	to := &core.Metadata{Meta: map[string]interface{}{
+		"title":       "EPA",
+		"description": "air & water quality",
+		"keywords":    []interface{}{"air", "water"},
+		"contact":     map[string]interface{}{"name": "a"},
+		"license":     "public domain",
+	}}
+
+	expect := []MetadataChange{
+		{Field: "contact.email", Change: "removed", From: "a@epa.gov"},
+		{Field: "description", Change: "changed", From: "air quality", To: "air & water quality"},
+		{Field: "keywords", Change: "changed"},
+		{Field: "license", Change: "added", To: "public domain"},
+	}
+
+	got := DiffMetadata(from, to)
+	if len(got) != len(expect) {
+		t.Fatalf("expected %d changes, got %d", len(expect), len(got))
+	}
+	for i, c := range expect {
+		if got[i].Field != c.Field || got[i].Change != c.Change {
+			t.Errorf("change %d mismatch. expected: %s %s, got: %s %s", i, c.Change, c.Field, got[i].Change, got[i].Field)
+		}
+		if c.Field == "keywords" {
+			continue
+		}
+		if got[i].From != c.From || got[i].To != c.To {
+			t.Errorf("change %d value mismatch. expected: %v -> %v, got: %v -> %v", i, c.From, c.To, got[i].From, got[i].To)
+		}
+	}
+
+	if changes := DiffMetadata(from, from); len(changes) != 0 {
+		t.Errorf("expected no changes comparing metadata to itself, got %d", len(changes))
+	}
+}
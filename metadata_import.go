@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/datatogether/core"
+	"github.com/pborman/uuid"
+)
+
+// metadata file formats
+const (
+	MetadataFormatCSV   = "csv"
+	MetadataFormatJSONL = "jsonl"
+)
+
+// max length of a single line in a JSON Lines metadata file
+const maxMetadataLineSize = 1024 * 1024
+
+// max size of an uploaded metadata file
+const maxMetadataImportSize = 32 * 1024 * 1024
+
+// how long finished imports are kept for status requests
+const metadataImportTTL = 24 * time.Hour
+
+// metadataImports keeps track of all metadata imports this server has run, by id
+var metadataImports = struct {
+	sync.Mutex
+	imports map[string]*MetadataImport
+}{imports: map[string]*MetadataImport{}}
+
+// MetadataRecord is a single row of a metadata file. Rows are keyed by the
+// content hash they describe, or a url that resolves to that content
+type MetadataRecord struct {
+	Hash string `json:"hash"`
+	Url  string `json:"url,omitempty"`
+	// key that wrote the metadata, only set on export
+	KeyId string `json:"keyId,omitempty"`
+	// time the metadata was written, only set on export
+	Timestamp *time.Time             `json:"timestamp,omitempty"`
+	Meta      map[string]interface{} `json:"meta"`
+}
+
+// metadataReservedColumns are CSV columns that aren't metadata fields
+var metadataReservedColumns = map[string]bool{
+	"hash":      true,
+	"url":       true,
+	"keyId":     true,
+	"timestamp": true,
+}
+
+// MetadataFormat picks a file format from a format name or filename,
+// defaulting to JSON Lines
+func MetadataFormat(format, filename string) (string, error) {
+	if format == "" {
+		if strings.ToLower(filepath.Ext(filename)) == ".csv" {
+			return MetadataFormatCSV, nil
+		}
+		return MetadataFormatJSONL, nil
+	}
+	switch format {
+	case MetadataFormatCSV, MetadataFormatJSONL:
+		return format, nil
+	}
+	return "", fmt.Errorf("unsupported metadata format: '%s'", format)
+}
+
+// ReadMetadataRecords reads records from r, calling fn with the row number
+// of each. rows that can't be parsed are passed to fn with an error instead
+// of a record. the returned error is for failures that stop reading
+//
+// CSV files must have a header row with a hash or url column. every other
+// column except keyId & timestamp is a metadata field, empty cells are
+// skipped & cells holding a JSON object or array are decoded. JSON Lines
+// files hold one MetadataRecord object per line
+func ReadMetadataRecords(format string, r io.Reader, fn func(row int, rec *MetadataRecord, err error)) error {
+	switch format {
+	case MetadataFormatCSV:
+		return readMetadataCSV(r, fn)
+	case MetadataFormatJSONL:
+		return readMetadataJSONL(r, fn)
+	}
+	return fmt.Errorf("unsupported metadata format: '%s'", format)
+}
+
+func readMetadataCSV(r io.Reader, fn func(row int, rec *MetadataRecord, err error)) error {
+	rdr := csv.NewReader(r)
+	rdr.FieldsPerRecord = -1
+	header, err := rdr.Read()
+	if err == io.EOF {
+		return fmt.Errorf("csv file is empty")
+	}
+	if err != nil {
+		return err
+	}
+
+	keyed := false
+	for i, col := range header {
+		header[i] = strings.TrimSpace(col)
+		if header[i] == "hash" || header[i] == "url" {
+			keyed = true
+		}
+	}
+	if !keyed {
+		return fmt.Errorf("csv header must include a hash or url column")
+	}
+
+	for row := 1; ; row++ {
+		cells, err := rdr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			// csv parse errors are for a single row, anything else stops the import
+			if _, ok := err.(*csv.ParseError); ok {
+				fn(row, nil, err)
+				continue
+			}
+			return err
+		}
+
+		rec := &MetadataRecord{Meta: map[string]interface{}{}}
+		for i, cell := range cells {
+			if i >= len(header) {
+				break
+			}
+			switch col := header[i]; col {
+			case "hash":
+				rec.Hash = strings.TrimSpace(cell)
+			case "url":
+				rec.Url = strings.TrimSpace(cell)
+			default:
+				if cell == "" || metadataReservedColumns[col] {
+					continue
+				}
+				rec.Meta[col] = csvMetadataValue(cell)
+			}
+		}
+		fn(row, rec, nil)
+	}
+}
+
+// csvMetadataValue decodes cells holding a JSON object or array, leaving
+// everything else as a string
+func csvMetadataValue(cell string) interface{} {
+	if trimmed := strings.TrimSpace(cell); strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		var v interface{}
+		if err := json.Unmarshal([]byte(trimmed), &v); err == nil {
+			return v
+		}
+	}
+	return cell
+}
+
+func readMetadataJSONL(r io.Reader, fn func(row int, rec *MetadataRecord, err error)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxMetadataLineSize)
+	row := 0
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		row++
+		rec := &MetadataRecord{}
+		if err := json.Unmarshal([]byte(line), rec); err != nil {
+			fn(row, nil, fmt.Errorf("invalid json: %s", err.Error()))
+			continue
+		}
+		fn(row, rec, nil)
+	}
+	return scanner.Err()
+}
+
+// MetadataImportRow is the outcome of importing a single row
+type MetadataImportRow struct {
+	Row int `json:"row"`
+	// content hash the row describes
+	Subject string `json:"subject,omitempty"`
+	// hash of the metadata written for the row
+	Hash  string `json:"hash,omitempty"`
+	Error string `json:"error,omitempty"`
+	// per-field errors when the row doesn't match a schema
+	Errors ValidationError `json:"errors,omitempty"`
+}
+
+// MetadataImport tracks the progress of writing a file of metadata. The
+// outcome of each row is published to the topic given by Topic as a
+// METADATA_IMPORT_ROW action, the final state as METADATA_IMPORT_PROGRESS
+type MetadataImport struct {
+	lock     sync.Mutex
+	Id       string    `json:"id"`
+	Created  time.Time `json:"created"`
+	Filename string    `json:"filename"`
+	Format   string    `json:"format"`
+	// key metadata is written under
+	KeyId string `json:"keyId"`
+	// number of rows read
+	Rows int `json:"rows"`
+	// number of rows written as metadata
+	Written int `json:"written"`
+	// rows that failed, the import continues past these
+	Failed []*MetadataImportRow `json:"failed,omitempty"`
+	// error that stopped the import, if any
+	Error string `json:"error,omitempty"`
+	Done  bool   `json:"done"`
+	// when the import finished, used to evict old imports
+	finished time.Time
+}
+
+// NewMetadataImport creates & registers a new import that writes metadata
+// under keyId, which requires the server to be able to sign metadata
+func NewMetadataImport(filename, format, keyId string) (*MetadataImport, error) {
+	if keyId == "" {
+		return nil, fmt.Errorf("you must be logged in to import metadata")
+	}
+	if signingKey == nil {
+		return nil, fmt.Errorf("metadata import requires the server to sign metadata")
+	}
+	format, err := MetadataFormat(format, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	imp := &MetadataImport{
+		Id:       uuid.New(),
+		Created:  time.Now().Round(time.Second).In(time.UTC),
+		Filename: filename,
+		Format:   format,
+		KeyId:    keyId,
+	}
+	metadataImports.Lock()
+	evictMetadataImports(time.Now())
+	metadataImports.imports[imp.Id] = imp
+	metadataImports.Unlock()
+	return imp, nil
+}
+
+// evictMetadataImports forgets imports that finished more than
+// metadataImportTTL before now. callers must hold the metadataImports lock
+func evictMetadataImports(now time.Time) {
+	for id, imp := range metadataImports.imports {
+		imp.lock.Lock()
+		expired := imp.Done && now.Sub(imp.finished) > metadataImportTTL
+		imp.lock.Unlock()
+		if expired {
+			delete(metadataImports.imports, id)
+		}
+	}
+}
+
+// ReadMetadataImport fetches a registered import by id
+func ReadMetadataImport(id string) (*MetadataImport, error) {
+	metadataImports.Lock()
+	defer metadataImports.Unlock()
+	if imp, ok := metadataImports.imports[id]; ok {
+		return imp, nil
+	}
+	return nil, core.ErrNotFound
+}
+
+// Topic is the subscription topic progress is published to
+func (imp *MetadataImport) Topic() string {
+	return "METADATA_IMPORT:" + imp.Id
+}
+
+// Status gives a copy of the import's current state that's safe to marshal
+func (imp *MetadataImport) Status() *MetadataImport {
+	imp.lock.Lock()
+	defer imp.lock.Unlock()
+	return &MetadataImport{
+		Id:       imp.Id,
+		Created:  imp.Created,
+		Filename: imp.Filename,
+		Format:   imp.Format,
+		KeyId:    imp.KeyId,
+		Rows:     imp.Rows,
+		Written:  imp.Written,
+		Failed:   append([]*MetadataImportRow(nil), imp.Failed...),
+		Error:    imp.Error,
+		Done:     imp.Done,
+	}
+}
+
+// Run reads all rows from r, writing a new version of metadata for each
+func (imp *MetadataImport) Run(r io.Reader) error {
+	err := ReadMetadataRecords(imp.Format, r, func(row int, rec *MetadataRecord, err error) {
+		res := &MetadataImportRow{Row: row}
+		if err == nil {
+			res.Subject, err = rec.subject()
+		}
+		if err == nil {
+			var m *core.Metadata
+			if m, err = WriteMetadata(imp.KeyId, res.Subject, rec.Meta, nil); err == nil {
+				res.Hash = m.Hash
+			}
+		}
+		if err != nil {
+			res.Error = err.Error()
+			if verr, ok := err.(ValidationError); ok {
+				res.Errors = verr
+			}
+		}
+
+		imp.lock.Lock()
+		imp.Rows++
+		if res.Error != "" {
+			imp.Failed = append(imp.Failed, res)
+		} else {
+			imp.Written++
+		}
+		imp.lock.Unlock()
+
+		room.Publish(imp.Topic(), &ClientResponse{
+			Type:      "METADATA_IMPORT_ROW",
+			RequestId: "server",
+			Schema:    "METADATA_IMPORT_ROW",
+			Id:        imp.Id,
+			Data:      res,
+		})
+	})
+
+	imp.finish(err)
+	return err
+}
+
+// finish marks the import as done & sends a final progress update
+func (imp *MetadataImport) finish(err error) {
+	imp.lock.Lock()
+	imp.Done = true
+	imp.finished = time.Now()
+	if err != nil {
+		imp.Error = err.Error()
+	}
+	imp.lock.Unlock()
+
+	room.Publish(imp.Topic(), &ClientResponse{
+		Type:      "METADATA_IMPORT_PROGRESS",
+		RequestId: "server",
+		Schema:    "METADATA_IMPORT",
+		Id:        imp.Id,
+		Data:      imp.Status(),
+	})
+}
+
+// subject resolves the content hash a record describes
+func (rec *MetadataRecord) subject() (string, error) {
+	if rec.Hash != "" {
+		return rec.Hash, nil
+	}
+	if rec.Url == "" {
+		return "", fmt.Errorf("hash or url is required")
+	}
+
+	u := &core.Url{Url: rec.Url}
+	if err := u.Read(store); err != nil {
+		if err == core.ErrNotFound {
+			return "", fmt.Errorf("url not found: %s", rec.Url)
+		}
+		return "", err
+	}
+	if u.Hash == "" {
+		return "", fmt.Errorf("url has no content hash: %s", rec.Url)
+	}
+	return u.Hash, nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// MetadataImportAct starts writing a CSV or JSON Lines file of metadata under
+// the requesting user's key. The requesting client is subscribed to the
+// import's topic, which gets the outcome of each row as it's written
+type MetadataImportAct struct {
+	ReqAction
+	Filename string
+	// MetadataFormatCSV or MetadataFormatJSONL, detected from Filename if empty
+	Format string
+	// contents of the file
+	Data string
+}
+
+func (MetadataImportAct) Type() string        { return "METADATA_IMPORT_REQUEST" }
+func (MetadataImportAct) SuccessType() string { return "METADATA_IMPORT_SUCCESS" }
+func (MetadataImportAct) FailureType() string { return "METADATA_IMPORT_FAILURE" }
+
+func (MetadataImportAct) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &MetadataImportAct{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *MetadataImportAct) Exec() (res *ClientResponse) {
+	imp, err := NewMetadataImport(a.Filename, a.Format, a.client.keyId())
+	if err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	if a.client != nil {
+		a.client.hub.subscribe <- subscription{client: a.client, topic: imp.Topic()}
+	}
+	go func() {
+		if err := imp.Run(strings.NewReader(a.Data)); err != nil {
+			log.Infof("metadata import %s error: %s", imp.Id, err.Error())
+		}
+	}()
+
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "METADATA_IMPORT",
+		Id:        imp.Id,
+		Data:      imp.Status(),
+	}
+}
+
+// MetadataImportStatusAct fetches the current state of a metadata import
+type MetadataImportStatusAct struct {
+	ReqAction
+	Id string
+}
+
+func (MetadataImportStatusAct) Type() string        { return "METADATA_IMPORT_STATUS_REQUEST" }
+func (MetadataImportStatusAct) SuccessType() string { return "METADATA_IMPORT_STATUS_SUCCESS" }
+func (MetadataImportStatusAct) FailureType() string { return "METADATA_IMPORT_STATUS_FAILURE" }
+
+func (MetadataImportStatusAct) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &MetadataImportStatusAct{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *MetadataImportStatusAct) Exec() (res *ClientResponse) {
+	imp, err := ReadMetadataImport(a.Id)
+	if err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "METADATA_IMPORT",
+		Id:        a.Id,
+		Data:      imp.Status(),
+	}
+}
+
+// MetadataExportAct produces a CSV or JSON Lines file of metadata for a key,
+// source or collection
+type MetadataExportAct struct {
+	ReqAction
+	MetadataExport
+}
+
+func (MetadataExportAct) Type() string        { return "METADATA_EXPORT_REQUEST" }
+func (MetadataExportAct) SuccessType() string { return "METADATA_EXPORT_SUCCESS" }
+func (MetadataExportAct) FailureType() string { return "METADATA_EXPORT_FAILURE" }
+
+func (MetadataExportAct) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &MetadataExportAct{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *MetadataExportAct) Exec() (res *ClientResponse) {
+	buf := &bytes.Buffer{}
+	rows, err := a.write(buf)
+	if err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "METADATA_EXPORT",
+		Data: map[string]interface{}{
+			"filename": a.Filename(),
+			"format":   a.Format,
+			"rows":     rows,
+			"data":     buf.String(),
+		},
+	}
+}
+
+func (a *MetadataExportAct) write(w io.Writer) (int, error) {
+	if err := viewableCollection(a.CollectionId, a.client.keyId()); err != nil {
+		return 0, err
+	}
+	return a.MetadataExport.Write(appDB, w)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/datatogether/core"
+)
+
+func TestReadMetadataRecords(t *testing.T) {
+	cases := []struct {
+		format string
+		data   string
+		hashes []string
+		errs   int
+		err    bool
+	}{
+		{MetadataFormatCSV, "hash,title,keywords\na,EPA,\"[\"\"air\"\"]\"\nb,NOAA,\n", []string{"a", "b"}, 0, false},
+		{MetadataFormatCSV, "url,title\nhttp://epa.gov,EPA\n", []string{""}, 0, false},
+		{MetadataFormatCSV, "title\nEPA\n", nil, 0, true},
+		{MetadataFormatJSONL, "{\"hash\":\"a\",\"meta\":{\"title\":\"EPA\"}}\n\nnot json\n{\"hash\":\"b\",\"meta\":{}}\n", []string{"a", "b"}, 1, false},
+		{"xml", "", nil, 0, true},
+	}
+
+	for i, c := range cases {
+		hashes := []string{}
+		errs := 0
+		err := ReadMetadataRecords(c.format, strings.NewReader(c.data), func(row int, rec *MetadataRecord, err error) {
+			if err != nil {
+				errs++
+				return
+			}
+			hashes = append(hashes, rec.Hash)
+		})
+		if (err != nil) != c.err {
+			t.Errorf("case %d error mismatch. expected error: %t, got: %v", i, c.err, err)
+			continue
+		}
+		if len(hashes) != len(c.hashes) {
+			t.Errorf("case %d: expected %d records, got %d", i, len(c.hashes), len(hashes))
+			continue
+		}
+		for j, h := range c.hashes {
+			if hashes[j] != h {
+				t.Errorf("case %d record %d hash mismatch. expected: %s, got: %s", i, j, h, hashes[j])
+			}
+		}
+		if errs != c.errs {
+			t.Errorf("case %d: expected %d row errors, got %d", i, c.errs, errs)
+		}
+	}
+}
+
+func TestMetadataCSVRoundTrip(t *testing.T) {
+	metadata := []*core.Metadata{
+		{Subject: "a", KeyId: "key", Timestamp: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC), Meta: map[string]interface{}{
+			"title":    "EPA, air",
+			"keywords": []interface{}{"air", "water"},
+		}},
+	}
+
+	buf := &bytes.Buffer{}
+	if err := WriteMetadataCSV(buf, metadata); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	var got *MetadataRecord
+	if err := ReadMetadataRecords(MetadataFormatCSV, buf, func(row int, rec *MetadataRecord, err error) {
+		if err != nil {
+			t.Errorf("row %d error: %s", row, err.Error())
+		}
+		got = rec
+	}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if got == nil || got.Hash != "a" {
+		t.Fatalf("expected record for subject a, got: %v", got)
+	}
+	if got.Meta["title"] != "EPA, air" {
+		t.Errorf("title mismatch. expected: %s, got: %v", "EPA, air", got.Meta["title"])
+	}
+	if kw, ok := got.Meta["keywords"].([]interface{}); !ok || len(kw) != 2 {
+		t.Errorf("expected keywords to decode as a list, got: %v", got.Meta["keywords"])
+	}
+	if _, ok := got.Meta["keyId"]; ok {
+		t.Errorf("expected keyId column to be excluded from metadata")
+	}
+}
+
+func TestEvictMetadataImports(t *testing.T) {
+	now := time.Now()
+	running := &MetadataImport{Id: "running"}
+	recent := &MetadataImport{Id: "recent", Done: true, finished: now.Add(-time.Hour)}
+	old := &MetadataImport{Id: "old", Done: true, finished: now.Add(-metadataImportTTL - time.Hour)}
+
+	metadataImports.Lock()
+	defer metadataImports.Unlock()
+	prev := metadataImports.imports
+	defer func() { metadataImports.imports = prev }()
+	metadataImports.imports = map[string]*MetadataImport{"running": running, "recent": recent, "old": old}
+
+	evictMetadataImports(now)
+	if _, ok := metadataImports.imports["old"]; ok {
+		t.Errorf("expected old import to be evicted")
+	}
+	if len(metadataImports.imports) != 2 {
+		t.Errorf("expected running & recent imports to be kept, got %d imports", len(metadataImports.imports))
+	}
+}
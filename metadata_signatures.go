@@ -0,0 +1,279 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"database/sql"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	"github.com/datatogether/core"
+)
+
+var (
+	// signingKey signs metadata for logged in users that don't provide a
+	// signature. nil if no private key is configured
+	signingKey *rsa.PrivateKey
+	// signingKeyId is the key id of the server's public key
+	signingKeyId string
+)
+
+// loadSigningKeys reads the server's key pair from configuration. an unreadable
+// public key is logged & disables server signing, an invalid private key is an error
+func loadSigningKeys(cfg *config) error {
+	pub, err := ParsePublicKey(cfg.PublicKey)
+	if err != nil {
+		log.Infof("error reading PUBLIC_KEY, server will not sign metadata: %s", err.Error())
+		return nil
+	}
+	if signingKeyId, err = PublicKeyId(pub); err != nil {
+		return err
+	}
+
+	if cfg.PrivateKey == "" {
+		return nil
+	}
+	key, err := ParsePrivateKey(cfg.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("invalid PRIVATE_KEY: %s", err.Error())
+	}
+	if key.PublicKey.N.Cmp(pub.N) != 0 || key.PublicKey.E != pub.E {
+		return fmt.Errorf("PRIVATE_KEY doesn't match PUBLIC_KEY")
+	}
+	signingKey = key
+	return nil
+}
+
+// ParsePublicKey reads a PEM-encoded PKIX RSA public key
+func ParsePublicKey(data string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in public key")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	pub, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key must be an RSA key")
+	}
+	return pub, nil
+}
+
+// ParsePrivateKey reads a PEM-encoded PKCS1 RSA private key
+func ParsePrivateKey(data string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in private key")
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+// PublicKeyId gives the sha256 multihash of a public key's PKIX encoding,
+// which is used as KeyId in metadata
+func PublicKeyId(pub *rsa.PublicKey) (string, error) {
+	data, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	return core.CalcHash(data)
+}
+
+// encodePublicKey PEM-encodes a public key
+func encodePublicKey(pub *rsa.PublicKey) (string, error) {
+	data, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: data})), nil
+}
+
+// MetadataSigningBytes gives the bytes a metadata signature covers: the
+// canonical json encoding (see canonicalJSON) of an object of the keyId,
+// subject, prev & meta fields. the timestamp is set by the server on write,
+// so it isn't included
+func MetadataSigningBytes(m *core.Metadata) ([]byte, error) {
+	return canonicalJSON(&struct {
+		KeyId   string                 `json:"keyId"`
+		Subject string                 `json:"subject"`
+		Prev    string                 `json:"prev"`
+		Meta    map[string]interface{} `json:"meta"`
+	}{
+		KeyId:   m.KeyId,
+		Subject: m.Subject,
+		Prev:    m.Prev,
+		Meta:    m.Meta,
+	})
+}
+
+// MetadataSignature is an RSA PKCS1v15 SHA256 signature of a metadata entry
+type MetadataSignature struct {
+	// hash of the signed metadata
+	Hash    string    `json:"hash"`
+	Created time.Time `json:"created"`
+	// id of the key that made the signature. this is the metadata's KeyId when
+	// signed by the author, or the server's key id when signed by the server
+	KeyId string `json:"keyId"`
+	// PEM-encoded public key of the signer
+	PublicKey string `json:"publicKey"`
+	// base64-encoded signature of MetadataSigningBytes
+	Signature string `json:"signature"`
+}
+
+// SignMetadata signs metadata with key
+func SignMetadata(m *core.Metadata, key *rsa.PrivateKey) (*MetadataSignature, error) {
+	data, err := MetadataSigningBytes(m)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		return nil, err
+	}
+
+	keyId, err := PublicKeyId(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := encodePublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MetadataSignature{
+		Hash:      m.Hash,
+		KeyId:     keyId,
+		PublicKey: pub,
+		Signature: base64.StdEncoding.EncodeToString(sig),
+	}, nil
+}
+
+// Verify checks the signature is valid for m & was made by the key it claims
+func (s *MetadataSignature) Verify(m *core.Metadata) error {
+	pub, err := ParsePublicKey(s.PublicKey)
+	if err != nil {
+		return err
+	}
+	keyId, err := PublicKeyId(pub)
+	if err != nil {
+		return err
+	}
+	if keyId != s.KeyId {
+		return fmt.Errorf("signature key id doesn't match public key")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(s.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %s", err.Error())
+	}
+	data, err := MetadataSigningBytes(m)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], sig); err != nil {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
+
+// Insert records the signature
+func (s *MetadataSignature) Insert(db sqlExecable) error {
+	s.Created = time.Now().Round(time.Second).In(time.UTC)
+	_, err := db.Exec(qMetadataSignatureInsert, s.Hash, s.Created, s.KeyId, s.PublicKey, s.Signature)
+	return err
+}
+
+// ReadMetadataSignature reads the signature for a metadata hash
+func ReadMetadataSignature(db sqlQueryable, hash string) (*MetadataSignature, error) {
+	s := &MetadataSignature{}
+	err := db.QueryRow(qMetadataSignatureByHash, hash).Scan(&s.Hash, &s.Created, &s.KeyId, &s.PublicKey, &s.Signature)
+	if err == sql.ErrNoRows {
+		return nil, core.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.Created = s.Created.In(time.UTC)
+	return s, nil
+}
+
+// MetadataVerification reports the integrity & authorship of a single
+// version of metadata
+type MetadataVerification struct {
+	Hash string `json:"hash"`
+	// hash matches the metadata's contents
+	HashValid bool `json:"hashValid"`
+	// prev matches the hash of the version before it
+	ChainValid bool `json:"chainValid"`
+	// a valid signature is stored for this version
+	Signed bool `json:"signed"`
+	// who made the signature, "author" if signed by KeyId, "server" if signed
+	// by the server on the author's behalf
+	SignedBy string `json:"signedBy,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// VerifyMetadataChain checks every version in a history, ordered latest
+// first as MetadataHistory returns them
+func VerifyMetadataChain(db sqlQueryable, history []*core.Metadata) (valid bool, results []*MetadataVerification) {
+	valid = true
+	results = make([]*MetadataVerification, len(history))
+	for i, m := range history {
+		v := &MetadataVerification{Hash: m.Hash}
+		results[i] = v
+
+		v.HashValid = metadataHashValid(m)
+		if i+1 < len(history) {
+			v.ChainValid = m.Prev == history[i+1].Hash && m.KeyId == history[i+1].KeyId
+		} else {
+			v.ChainValid = m.Prev == ""
+		}
+
+		sig, err := ReadMetadataSignature(db, m.Hash)
+		if err == nil {
+			err = sig.Verify(m)
+		}
+		if err == nil {
+			switch sig.KeyId {
+			case m.KeyId:
+				v.SignedBy = "author"
+			case signingKeyId:
+				v.SignedBy = "server"
+			default:
+				err = fmt.Errorf("signed by unknown key %s", sig.KeyId)
+			}
+		}
+		if err != nil {
+			if err == core.ErrNotFound {
+				err = fmt.Errorf("no signature")
+			}
+			v.Error = err.Error()
+		}
+		v.Signed = v.SignedBy != ""
+
+		if !v.HashValid || !v.ChainValid || !v.Signed {
+			valid = false
+		}
+	}
+	return
+}
+
+// metadataHashValid recalculates a metadata hash from its contents
+func metadataHashValid(m *core.Metadata) bool {
+	check := *m
+	check.Timestamp = m.Timestamp.In(time.UTC)
+	data, err := check.HashableBytes()
+	if err != nil {
+		return false
+	}
+	hash, err := core.CalcHash(data)
+	return err == nil && hash == m.Hash
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/datatogether/core"
+)
+
+func TestSignMetadata(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	keyId, err := PublicKeyId(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	m := &core.Metadata{
+		KeyId:   keyId,
+		Subject: "1220459219b10032cc86dcdbc0f83aea15a9d3e1119e7b5170beaee233008ea2c2de",
+		Meta:    map[string]interface{}{"title": "EPA"},
+	}
+	sig, err := SignMetadata(m, key)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if sig.KeyId != keyId {
+		t.Errorf("key id mismatch. expected: %s, got: %s", keyId, sig.KeyId)
+	}
+
+	pub, err := ParsePublicKey(sig.PublicKey)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if pub.N.Cmp(key.PublicKey.N) != 0 {
+		t.Errorf("encoded public key doesn't match signing key")
+	}
+
+	if err := sig.Verify(m); err != nil {
+		t.Errorf("expected valid signature, got: %s", err.Error())
+	}
+
+	m.Meta["title"] = "EPA!"
+	if err := sig.Verify(m); err == nil {
+		t.Errorf("expected changed metadata to invalidate signature")
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// default & max number of results in a page of a list action
+const (
+	defaultPageSize = 50
+	maxPageSize     = 100
+)
+
+// cursorTimeFormat formats timestamps stored in cursors. postgres timestamps
+// are stored without a timezone in UTC with microsecond precision
+const cursorTimeFormat = "2006-01-02 15:04:05.999999"
+
+// Cursor marks a position in a list. Lists ordered by a sort column & a
+// unique id are read from the row after (or before) the cursor, which stays
+// fast deep into large tables where offsets don't. Clients get cursors as
+// opaque strings in nextCursor & prevCursor & pass them back as-is
+type Cursor struct {
+	// value of the sort column & id of the row the cursor points at
+	Sort string `json:"s,omitempty"`
+	Id   string `json:"i,omitempty"`
+	// Prev cursors read the page before the cursor row instead of after it
+	Prev bool `json:"p,omitempty"`
+	// Offset stands in for Sort & Id for lists that can only be read by offset
+	Offset int `json:"o,omitempty"`
+}
+
+// String encodes the cursor for clients
+func (c *Cursor) String() string {
+	if c == nil {
+		return ""
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ParseCursor decodes a cursor string, returning nil for an empty string
+func ParseCursor(s string) (*Cursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	c := &Cursor{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return c, nil
+}
+
+// cursorTime formats a timestamp sort value for a cursor
+func cursorTime(t time.Time) string {
+	return t.In(time.UTC).Format(cursorTimeFormat)
+}
+
+// PageParams are the pagination fields shared by list actions. Cursor takes
+// precedence, Page is kept for clients that read by page number
+type PageParams struct {
+	// nextCursor or prevCursor from a previous response
+	Cursor   string
+	Page     int
+	PageSize int
+	// WithTotal counts all results in the list for the response's total.
+	// counting reads the whole list, so clients should only ask when needed
+	WithTotal bool
+}
+
+// normalize sets default page & page size values
+func (p *PageParams) normalize() {
+	if p.Page < 1 {
+		p.Page = 1
+	}
+	if p.PageSize <= 0 {
+		p.PageSize = defaultPageSize
+	}
+	if p.PageSize > maxPageSize {
+		p.PageSize = maxPageSize
+	}
+}
+
+// offset gives the number of rows to skip when reading without a cursor
+func (p *PageParams) offset() int {
+	return (p.Page - 1) * p.PageSize
+}
+
+// Page describes where a page of results sits in a list
+type Page struct {
+	Next  *Cursor
+	Prev  *Cursor
+	Total int
+}
+
+// respond adds page details to a response
+func (pg *Page) respond(p *PageParams, res *ClientResponse) *ClientResponse {
+	res.Page = p.Page
+	res.PageSize = p.PageSize
+	if pg != nil {
+		res.NextCursor = pg.Next.String()
+		res.PrevCursor = pg.Prev.String()
+		res.Total = pg.Total
+	}
+	return res
+}
+
+// keyset describes a list that's paged by a sort column & a unique id
+type keyset struct {
+	// columns to select
+	cols string
+	// from clause, which can be a subquery
+	from string
+	// filter conditions, "" for none. bindvars start at $1
+	where string
+	// sort column & its postgres type
+	sort, sortType string
+	// unique column used to order rows with equal sort values & its postgres
+	// type. columns are compared as their own type so indexes apply
+	id, idType string
+	// lists are sorted in descending order unless asc is true
+	asc bool
+}
+
+// query builds the select statement for a page of the list at cursor c,
+// which may be nil. nargs is the number of bindvars the where clause uses.
+// cursor sort & id, limit & offset bindvars follow, in that order
+func (k keyset) query(c *Cursor, nargs int) string {
+	conds := []string{}
+	if k.where != "" {
+		conds = append(conds, "("+k.where+")")
+	}
+
+	asc := k.asc
+	if c != nil {
+		if c.Prev {
+			asc = !asc
+		}
+		op := "<"
+		if asc {
+			op = ">"
+		}
+		conds = append(conds, fmt.Sprintf("(%s, %s) %s ($%d::%s, $%d::%s)", k.sort, k.id, op, nargs+1, k.sortType, nargs+2, k.idType))
+		nargs += 2
+	}
+
+	dir := "DESC"
+	if asc {
+		dir = "ASC"
+	}
+
+	q := fmt.Sprintf("SELECT %s FROM %s", k.cols, k.from)
+	if len(conds) > 0 {
+		q += " WHERE " + strings.Join(conds, " AND ")
+	}
+	return q + fmt.Sprintf(" ORDER BY %s %s, %s %s LIMIT $%d OFFSET $%d", k.sort, dir, k.id, dir, nargs+1, nargs+2)
+}
+
+// count builds a statement counting all rows in the list
+func (k keyset) count() string {
+	q := fmt.Sprintf("SELECT count(1) FROM %s", k.from)
+	if k.where != "" {
+		q += " WHERE " + k.where
+	}
+	return q
+}
+
+// keysetScanner reads a row into a result, returning the cursor position of
+// that row
+type keysetScanner func(rows *sql.Rows) (interface{}, Cursor, error)
+
+// readKeysetPage reads a page of a keyset list, using scan to read rows.
+// args are the bindvars for the keyset's where clause. results are returned
+// in list order along with their page's position, which only includes the
+// list's total if p asks for it
+func readKeysetPage(db sqlQueryable, k keyset, p *PageParams, scan keysetScanner, args ...interface{}) ([]interface{}, *Page, error) {
+	p.normalize()
+	c, err := ParseCursor(p.Cursor)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	qargs := append([]interface{}{}, args...)
+	offset := p.offset()
+	if c != nil {
+		qargs = append(qargs, c.Sort, c.Id)
+		offset = 0
+	}
+	// read one extra row to check for more results
+	qargs = append(qargs, p.PageSize+1, offset)
+
+	rows, err := db.Query(k.query(c, len(args)), qargs...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var (
+		results = []interface{}{}
+		keys    = []Cursor{}
+	)
+	for rows.Next() {
+		r, key, err := scan(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		results = append(results, r)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	more := len(results) > p.PageSize
+	if more {
+		results, keys = results[:p.PageSize], keys[:p.PageSize]
+	}
+
+	backward := c != nil && c.Prev
+	if backward {
+		for i, j := 0, len(results)-1; i < j; i, j = i+1, j-1 {
+			results[i], results[j] = results[j], results[i]
+			keys[i], keys[j] = keys[j], keys[i]
+		}
+	}
+
+	page := &Page{}
+	if len(results) > 0 {
+		first, last := keys[0], keys[len(keys)-1]
+		if more || backward {
+			page.Next = &Cursor{Sort: last.Sort, Id: last.Id}
+		}
+		if (backward && more) || (!backward && (c != nil || offset > 0)) {
+			page.Prev = &Cursor{Sort: first.Sort, Id: first.Id, Prev: true}
+		}
+	}
+
+	if p.WithTotal {
+		if err := db.QueryRow(k.count(), args...).Scan(&page.Total); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return results, page, nil
+}
+
+// offsetCursor gives the offset to read from for lists that can't be keyset
+// paginated, using the cursor offset if a cursor is given
+func (p *PageParams) offsetCursor() (int, error) {
+	p.normalize()
+	c, err := ParseCursor(p.Cursor)
+	if err != nil {
+		return 0, err
+	}
+	if c != nil {
+		return c.Offset, nil
+	}
+	return p.offset(), nil
+}
+
+// offsetPage gives the position of a page of n results read from offset.
+// total is the size of the list, or -1 if it isn't known
+func offsetPage(p *PageParams, offset, n, total int) *Page {
+	page := &Page{}
+	if total >= 0 {
+		page.Total = total
+	}
+	if (total < 0 && n >= p.PageSize) || (total >= 0 && offset+n < total) {
+		page.Next = &Cursor{Offset: offset + p.PageSize}
+	}
+	if offset > 0 {
+		prev := offset - p.PageSize
+		if prev < 0 {
+			prev = 0
+		}
+		page.Prev = &Cursor{Offset: prev, Prev: true}
+	}
+	return page
+}
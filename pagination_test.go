@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCursorString(t *testing.T) {
+	c := &Cursor{Sort: "2017-01-01 00:00:01", Id: "a", Prev: true}
+	got, err := ParseCursor(c.String())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if *got != *c {
+		t.Errorf("cursor mismatch. expected: %v, got: %v", c, got)
+	}
+
+	if c, err := ParseCursor(""); c != nil || err != nil {
+		t.Errorf("expected empty string to give nil cursor & error, got: %v, %v", c, err)
+	}
+	if _, err := ParseCursor("not a cursor"); err == nil {
+		t.Errorf("expected invalid cursor to error")
+	}
+}
+
+func TestKeysetQuery(t *testing.T) {
+	k := keyset{
+		cols:     "id, created",
+		from:     "primers",
+		where:    "deleted = false",
+		sort:     "created",
+		sortType: "timestamp",
+		id:       "id",
+		idType:   "uuid",
+	}
+
+	cases := []struct {
+		c      *Cursor
+		nargs  int
+		expect string
+	}{
+		{nil, 0, "SELECT id, created FROM primers WHERE (deleted = false) ORDER BY created DESC, id DESC LIMIT $1 OFFSET $2"},
+		{&Cursor{}, 0, "SELECT id, created FROM primers WHERE (deleted = false) AND (created, id) < ($1::timestamp, $2::uuid) ORDER BY created DESC, id DESC LIMIT $3 OFFSET $4"},
+		{&Cursor{Prev: true}, 1, "SELECT id, created FROM primers WHERE (deleted = false) AND (created, id) > ($2::timestamp, $3::uuid) ORDER BY created ASC, id ASC LIMIT $4 OFFSET $5"},
+	}
+
+	for i, c := range cases {
+		if got := k.query(c.c, c.nargs); got != c.expect {
+			t.Errorf("case %d mismatch.\nexpected: %s\ngot:      %s", i, c.expect, got)
+		}
+	}
+}
+
+func TestOffsetPage(t *testing.T) {
+	p := &PageParams{PageSize: 10}
+	p.normalize()
+
+	cases := []struct {
+		offset, n, total int
+		next, prev       *Cursor
+	}{
+		{0, 10, -1, &Cursor{Offset: 10}, nil},
+		{0, 5, -1, nil, nil},
+		{10, 10, 20, nil, &Cursor{Offset: 0, Prev: true}},
+		{5, 10, 30, &Cursor{Offset: 15}, &Cursor{Offset: 0, Prev: true}},
+	}
+
+	for i, c := range cases {
+		page := offsetPage(p, c.offset, c.n, c.total)
+		if page.Next.String() != c.next.String() {
+			t.Errorf("case %d next mismatch. expected: %v, got: %v", i, c.next, page.Next)
+		}
+		if page.Prev.String() != c.prev.String() {
+			t.Errorf("case %d prev mismatch. expected: %v, got: %v", i, c.prev, page.Prev)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"fmt"
 	"github.com/gchaincl/dotsql"
+	"strings"
 	"time"
 
 	_ "github.com/lib/pq"
@@ -30,6 +31,30 @@ type sqlQueryExecable interface {
 	sqlExecable
 }
 
+// withTx runs fn inside a transaction, committing if fn succeeds & rolling
+// back if it returns an error
+func withTx(db *sql.DB, fn func(tx sqlQueryExecable) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		if rerr := tx.Rollback(); rerr != nil {
+			log.Infof("rollback error: %s", rerr.Error())
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// likeEscaper escapes LIKE & ILIKE pattern characters
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// escapeLike escapes s for use as a literal in a LIKE or ILIKE pattern
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
 func connectToAppDb() {
 	var err error
 	fmt.Println("connecting to db")
@@ -85,11 +110,21 @@ func initializeDatabase(db *sql.DB) error {
 		"create-urls",
 		"create-links",
 		"create-metadata",
+		"create-metadata_signatures",
 		"create-snapshots",
 		"create-collections",
+		"create-collection_versions",
+		"create-collection_collaborators",
+		"create-audit_log",
+		"create-alerts",
+		"create-supress_alerts",
 		"create-archive_requests",
 		"create-uncrawlables",
+		"create-custom_crawls",
+		"create-data_repos",
 		"create-collection_items",
+		"create-indexes",
+		"create-search",
 	} {
 		if _, err := schema.Exec(db, cmd); err != nil {
 			fmt.Println(cmd, "error:", err)
@@ -108,6 +143,7 @@ func initializeDatabase(db *sql.DB) error {
 		"collections",
 		"archive_requests",
 		"uncrawlables",
+		"data_repos",
 		"collection_items",
 	); err != nil {
 		return err
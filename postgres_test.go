@@ -0,0 +1,22 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestEscapeLike(t *testing.T) {
+	cases := []struct {
+		in, expect string
+	}{
+		{"", ""},
+		{"http://www.epa.gov", "http://www.epa.gov"},
+		{"http://epa.gov/a_b%20c", `http://epa.gov/a\_b\%20c`},
+		{`http://epa.gov/a\b`, `http://epa.gov/a\\b`},
+	}
+
+	for i, c := range cases {
+		if got := escapeLike(c.in); got != c.expect {
+			t.Errorf("case %d mismatch. expected: '%s', got: '%s'", i, c.expect, got)
+		}
+	}
+}
@@ -0,0 +1,809 @@
+package main
+
+// qSourceUrlMatch matches urls aliased u to sources aliased s the way core
+// does, by urls that contain the source url. source urls are stored without
+// a scheme, eg: "www.epa.gov", so they can't be matched as prefixes. LIKE
+// pattern characters in the source url are escaped
+const qSourceUrlMatch = `u.url ilike '%' || replace(replace(replace(s.url, '\', '\\'), '%', '\%'), '_', '\_') || '%'`
+
+// insert an archive request
+const qArchiveRequestInsert = `
+INSERT INTO archive_requests
+  (created, url, user_id, origin)
+VALUES
+  ($1, $2, $3, $4)
+RETURNING id;`
+
+// list fetched urls that fall within a source, in reverse chronological order
+// by last GET. $1 should be the source url wrapped in wildcards, eg: "%epa.gov%"
+// paginated
+const qSourceFetchedUrls = `
+SELECT
+  url, created, updated, last_head, last_get, status, content_type, content_sniff,
+  content_length, file_name, title, id, headers_took, download_took, headers, meta, hash
+FROM urls
+WHERE
+  url ilike $1 AND
+  last_get IS NOT NULL
+ORDER BY last_get DESC
+LIMIT $2 OFFSET $3;`
+
+// list the urls in a collection, in collection index order
+// paginated
+const qCollectionUrls = `
+SELECT
+  u.url, u.created, u.updated, u.last_head, u.last_get, u.status, u.content_type, u.content_sniff,
+  u.content_length, u.file_name, u.title, u.id, u.headers_took, u.download_took, u.headers, u.meta, u.hash
+FROM collection_items ci
+JOIN urls u ON u.id = ci.url_id
+WHERE ci.collection_id = $1
+ORDER BY ci.index ASC
+LIMIT $2 OFFSET $3;`
+
+// remove an uncrawlable by id
+const qUncrawlableDeleteById = `
+DELETE FROM uncrawlables
+WHERE id = $1;`
+
+// the key that created a custom crawl
+const qCustomCrawlCreator = `
+SELECT creator_key_id
+FROM custom_crawls
+WHERE id = $1;`
+
+// record the key that created a custom crawl
+const qCustomCrawlSetCreator = `
+UPDATE custom_crawls
+SET creator_key_id = $2
+WHERE id = $1;`
+
+// read a data repo that hasn't been deleted by id
+const qDataRepoActiveById = `
+SELECT
+  id, created, updated, title, description, url
+FROM data_repos
+WHERE id = $1 AND deleted = false;`
+
+// mark a data repo as deleted
+const qDataRepoSoftDelete = `
+UPDATE data_repos
+SET deleted = true, updated = $2
+WHERE id = $1 AND deleted = false;`
+
+// full text url search matches for $1 search terms, optionally narrowed to
+// $2 content type, $3 source id & $4 primer id. candidate urls are found
+// through the indexed search vectors of urls, their metadata, public
+// collections & collection items, and the sources & primers that cover them.
+// urls belong to the most specific source whose url they contain
+const qUrlSearchMatches = `
+WITH q AS (
+  SELECT plainto_tsquery('english', $1) AS query
+),
+candidates AS (
+  SELECT u.url
+  FROM urls u, q
+  WHERE u.search @@ q.query
+  UNION
+  SELECT u.url
+  FROM metadata m
+  JOIN urls u ON u.hash = m.subject, q
+  WHERE m.search @@ q.query AND m.deleted = false AND m.subject != ''
+  UNION
+  SELECT u.url
+  FROM collections col
+  JOIN collection_items ci ON ci.collection_id = col.id
+  JOIN urls u ON u.id = ci.url_id, q
+  WHERE col.search @@ q.query AND col.visibility = 'public'
+  UNION
+  SELECT u.url
+  FROM collection_items ci
+  JOIN collections col ON col.id = ci.collection_id
+  JOIN urls u ON u.id = ci.url_id, q
+  WHERE ci.search @@ q.query AND col.visibility = 'public'
+  UNION
+  SELECT u.url
+  FROM sources s
+  JOIN urls u ON ` + qSourceUrlMatch + `, q
+  WHERE s.search @@ q.query AND s.deleted = false
+  UNION
+  SELECT u.url
+  FROM primers p
+  JOIN sources s ON s.primer_id = p.id AND s.deleted = false
+  JOIN urls u ON ` + qSourceUrlMatch + `, q
+  WHERE p.search @@ q.query AND p.deleted = false
+),
+documents AS (
+  SELECT
+    u.url, u.title, u.hash, u.content_type,
+    coalesce(s.id::text, '') AS source_id, coalesce(s.title, '') AS source_title,
+    coalesce(p.id::text, '') AS primer_id, coalesce(p.title, '') AS primer_title,
+    concat_ws(' ', u.title, s.title, p.title, c.text, m.text) AS body
+  FROM candidates
+  JOIN urls u ON u.url = candidates.url
+  LEFT JOIN LATERAL (
+    SELECT s.id, s.title, s.primer_id FROM sources s
+    WHERE s.deleted = false AND ` + qSourceUrlMatch + `
+    ORDER BY length(s.url) DESC
+    LIMIT 1
+  ) s ON true
+  LEFT JOIN primers p ON p.id = s.primer_id AND p.deleted = false
+  LEFT JOIN LATERAL (
+    SELECT string_agg(concat_ws(' ', col.title, col.description, ci.description), ' ') AS text
+    FROM collection_items ci
+    JOIN collections col ON col.id = ci.collection_id
+    WHERE ci.url_id = u.id AND col.visibility = 'public'
+  ) c ON true
+  LEFT JOIN LATERAL (
+    SELECT string_agg(meta::text, ' ') AS text
+    FROM metadata
+    WHERE u.hash != '' AND subject = u.hash AND deleted = false
+  ) m ON true
+),
+matches AS (
+  SELECT
+    d.*, q.query,
+    ts_rank(
+      setweight(to_tsvector('english', d.title), 'A') ||
+      setweight(to_tsvector('english', concat_ws(' ', d.source_title, d.primer_title)), 'B') ||
+      setweight(to_tsvector('english', d.body), 'C'),
+      q.query) AS rank
+  FROM documents d, q
+  WHERE
+    ($2 = '' OR d.content_type = $2) AND
+    ($3 = '' OR d.source_id = $3) AND
+    ($4 = '' OR d.primer_id = $4)
+)`
+
+// ts_headline options for search snippets. matches are wrapped in the
+// snippetStart & snippetStop control characters, which are stripped from
+// text before highlighting, so snippets can be html escaped before marking
+const qSnippetOptions = `'StartSel=' || chr(2) || ', StopSel=' || chr(3) || ', MaxFragments=2, MaxWords=20, MinWords=5'`
+
+// ranked full text url search results with highlighted snippets
+// paginated
+const qUrlSearch = qUrlSearchMatches + `
+SELECT
+  url, title, hash, content_type,
+  source_id, source_title, primer_id, primer_title, rank,
+  ts_headline('english', translate(body, chr(2) || chr(3), ''), query, ` + qSnippetOptions + `) AS snippet
+FROM matches
+ORDER BY rank DESC, url
+LIMIT $5 OFFSET $6;`
+
+// full text url search match counts by content type, source & primer.
+// every match has one content type, so content type counts sum to the total
+const qUrlSearchFacets = qUrlSearchMatches + `
+SELECT 'content_type' AS facet, content_type AS value, content_type AS title, count(*)
+FROM matches
+GROUP BY content_type
+UNION ALL
+SELECT 'source', source_id, source_title, count(*)
+FROM matches
+WHERE source_id != ''
+GROUP BY source_id, source_title
+UNION ALL
+SELECT 'primer', primer_id, primer_title, count(*)
+FROM matches
+WHERE primer_id != ''
+GROUP BY primer_id, primer_title
+ORDER BY 1, 4 DESC;`
+
+// ranked search of primers, sources, public collections, urls, metadata
+// subjects & uncrawlables by $1 search terms, optionally limited to $2, a comma
+// separated list of schemas. each match is tagged with the schema of the
+// entity it represents & found through that entity's indexed search vector.
+// rows are either a HIT, one of the $3 limit, $4 offset page of matches with a
+// highlighted snippet, or a COUNT of all matches for a schema
+const qSearchAll = `
+WITH q AS (
+  SELECT plainto_tsquery('english', $1) AS query
+),
+matches AS (
+  SELECT 'PRIMER' AS schema, p.id::text AS id, p.title, p.description, '' AS url,
+    concat_ws(' ', p.short_title, p.title, p.description) AS body,
+    ts_rank(p.search, q.query) AS rank
+  FROM primers p, q
+  WHERE
+    ($2 = '' OR 'PRIMER' = ANY(string_to_array($2, ','))) AND
+    p.search @@ q.query AND p.deleted = false
+  UNION ALL
+  SELECT 'SOURCE', s.id::text, s.title, s.description, s.url,
+    concat_ws(' ', s.title, s.description, s.url),
+    ts_rank(s.search, q.query)
+  FROM sources s, q
+  WHERE
+    ($2 = '' OR 'SOURCE' = ANY(string_to_array($2, ','))) AND
+    s.search @@ q.query AND s.deleted = false
+  UNION ALL
+  SELECT 'COLLECTION', c.id::text, c.title, c.description, c.url,
+    concat_ws(' ', c.title, c.description),
+    ts_rank(c.search, q.query)
+  FROM collections c, q
+  WHERE
+    ($2 = '' OR 'COLLECTION' = ANY(string_to_array($2, ','))) AND
+    c.search @@ q.query AND c.visibility = 'public'
+  UNION ALL
+  SELECT 'URL', u.url, u.title, '', u.url,
+    concat_ws(' ', u.title, u.url),
+    ts_rank(u.search, q.query)
+  FROM urls u, q
+  WHERE
+    ($2 = '' OR 'URL' = ANY(string_to_array($2, ','))) AND
+    u.search @@ q.query
+  UNION ALL
+  (SELECT DISTINCT ON (m.subject) 'METADATA', m.subject,
+    coalesce(m.meta->>'title', ''), coalesce(m.meta->>'description', ''), '',
+    m.meta::text,
+    ts_rank(m.search, q.query)
+  FROM metadata m, q
+  WHERE
+    ($2 = '' OR 'METADATA' = ANY(string_to_array($2, ','))) AND
+    m.search @@ q.query AND m.deleted = false AND m.meta IS NOT NULL
+  ORDER BY m.subject, m.time_stamp DESC)
+  UNION ALL
+  SELECT 'UNCRAWLABLE', un.id, un.url, un.comments, un.url,
+    concat_ws(' ', un.url, un.agency_name, un.event_name, un.comments),
+    ts_rank(un.search, q.query)
+  FROM uncrawlables un, q
+  WHERE
+    ($2 = '' OR 'UNCRAWLABLE' = ANY(string_to_array($2, ','))) AND
+    un.search @@ q.query AND un.deleted = false
+),
+page AS (
+  SELECT * FROM matches
+  ORDER BY rank DESC, schema, id
+  LIMIT $3 OFFSET $4
+)
+SELECT
+  'HIT' AS kind, p.schema, p.id, p.title, p.description, p.url, p.rank,
+  ts_headline('english', translate(p.body, chr(2) || chr(3), ''), q.query, ` + qSnippetOptions + `),
+  0 AS count
+FROM page p, q
+UNION ALL
+SELECT 'COUNT', schema, '', '', '', '', 0, '', count(*)
+FROM matches
+GROUP BY schema
+ORDER BY 1 DESC, 7 DESC, 2, 3;`
+
+// insert a metadata entry
+const qMetadataInsert = `
+INSERT INTO metadata
+  (hash, time_stamp, key_id, subject, prev, meta, deleted)
+VALUES ($1, $2, $3, $4, $5, $6, false);`
+
+// read a single metadata entry by hash
+const qMetadataByHash = `
+SELECT
+  hash, time_stamp, key_id, subject, prev, meta
+FROM metadata
+WHERE hash = $1;`
+
+// record the signature for a metadata entry
+const qMetadataSignatureInsert = `
+INSERT INTO metadata_signatures
+  (hash, created, key_id, public_key, signature)
+VALUES ($1, $2, $3, $4, $5);`
+
+// read the signature for a metadata entry by hash
+const qMetadataSignatureByHash = `
+SELECT
+  hash, created, key_id, public_key, signature
+FROM metadata_signatures
+WHERE hash = $1;`
+
+// read the json schemas attached to a collection
+const qCollectionSchema = `
+SELECT schema, items_schema
+FROM collections
+WHERE id = $1;`
+
+// attach json schemas to a collection
+const qCollectionSchemaUpdate = `
+UPDATE collections
+SET schema = $2, items_schema = $3
+WHERE id = $1;`
+
+// read the json schema attached to a primer
+const qPrimerSchema = `
+SELECT schema
+FROM primers
+WHERE id = $1 AND deleted = false;`
+
+// attach a json schema to a primer
+const qPrimerSchemaUpdate = `
+UPDATE primers
+SET schema = $2
+WHERE id = $1 AND deleted = false;`
+
+// all schemas that apply to metadata for a content hash: those of collections
+// the content is a member of, and of primers whose sources cover the content.
+// private collections are only included if key $2 is their creator or a
+// collaborator
+const qSubjectSchemas = `
+SELECT 'COLLECTION', c.id::text, c.title, c.schema::text
+FROM collections c
+JOIN collection_items ci ON ci.collection_id = c.id
+JOIN urls u ON u.id = ci.url_id
+WHERE
+  u.hash = $1 AND
+  c.schema IS NOT NULL AND c.schema::text != 'null' AND
+  (c.visibility != 'private' OR ($2 != '' AND (
+    c.creator = $2 OR
+    EXISTS (SELECT 1 FROM collection_collaborators cc WHERE cc.collection_id = c.id AND cc.key_id = $2))))
+UNION
+SELECT 'PRIMER', p.id::text, p.title, p.schema::text
+FROM urls u
+JOIN sources s ON s.deleted = false AND ` + qSourceUrlMatch + `
+JOIN primers p ON p.id = s.primer_id
+WHERE
+  u.hash = $1 AND
+  p.deleted = false AND
+  p.schema IS NOT NULL AND p.schema::text != 'null';`
+
+// the latest metadata each key has written for a subject
+const qSubjectLatestMetadata = `
+SELECT DISTINCT ON (key_id)
+  hash, time_stamp, key_id, subject, prev, meta
+FROM metadata
+WHERE
+  subject = $1 AND
+  deleted = false AND
+  meta IS NOT NULL
+ORDER BY key_id, time_stamp DESC;`
+
+// number of distinct subjects each key that has described a subject has
+// written metadata for
+const qSubjectKeyReputation = `
+SELECT key_id, count(DISTINCT subject)
+FROM metadata
+WHERE
+  deleted = false AND
+  key_id IN (SELECT key_id FROM metadata WHERE subject = $1 AND deleted = false)
+GROUP BY key_id;`
+
+// consensus settings of the primer whose source most specifically covers
+// the content with hash $1
+const qSubjectPrimerConsensus = `
+SELECT p.meta -> 'consensus'
+FROM urls u
+JOIN sources s ON s.deleted = false AND ` + qSourceUrlMatch + `
+JOIN primers p ON p.id = s.primer_id
+WHERE
+  u.hash = $1 AND
+  p.deleted = false AND
+  p.meta -> 'consensus' IS NOT NULL
+ORDER BY length(s.url) DESC
+LIMIT 1;`
+
+// the latest metadata for each subject a key has described, for export
+const qKeyMetadataExport = `
+SELECT DISTINCT ON (subject)
+  hash, time_stamp, key_id, subject, prev, meta
+FROM metadata
+WHERE
+  key_id = $1 AND
+  deleted = false AND
+  meta IS NOT NULL
+ORDER BY subject, time_stamp DESC
+LIMIT $2;`
+
+// the latest metadata from each key for content fetched from urls
+// that contain a source url, for export. source urls have no scheme, so
+// they're matched anywhere in the url as core does. % & _ in the source
+// url must be escaped
+const qSourceMetadataExport = `
+SELECT DISTINCT ON (m.subject, m.key_id)
+  m.hash, m.time_stamp, m.key_id, m.subject, m.prev, m.meta
+FROM metadata m
+JOIN urls u ON u.hash = m.subject
+WHERE
+  u.url ilike '%' || $1 || '%' AND
+  m.deleted = false AND
+  m.meta IS NOT NULL
+ORDER BY m.subject, m.key_id, m.time_stamp DESC
+LIMIT $2;`
+
+// the latest metadata from each key for content in a collection, for export
+const qCollectionMetadataExport = `
+SELECT DISTINCT ON (m.subject, m.key_id)
+  m.hash, m.time_stamp, m.key_id, m.subject, m.prev, m.meta
+FROM metadata m
+JOIN urls u ON u.hash = m.subject
+JOIN collection_items ci ON ci.url_id = u.id
+WHERE
+  ci.collection_id = $1 AND
+  m.deleted = false AND
+  m.meta IS NOT NULL
+ORDER BY m.subject, m.key_id, m.time_stamp DESC
+LIMIT $2;`
+
+// metadata fields of an export query, formatted in with %s. bindvars are the
+// export query's
+const qMetadataExportFields = `
+SELECT DISTINCT field
+FROM (%s) AS e, json_object_keys(CASE WHEN json_typeof(e.meta) = 'object' THEN e.meta ELSE '{}' END) AS field
+ORDER BY field;`
+
+// items in a collection with their url details & the latest metadata
+// written for their content, in collection index order
+const qCollectionExportItems = `
+SELECT
+  ci.index, ci.description, u.url, u.hash, u.title, u.content_type, u.content_length, u.file_name,
+  coalesce(m.hash, ''), coalesce(m.key_id, ''), m.time_stamp, m.meta
+FROM collection_items ci
+JOIN urls u ON u.id = ci.url_id
+LEFT JOIN LATERAL (
+  SELECT hash, key_id, time_stamp, meta
+  FROM metadata
+  WHERE
+    subject = u.hash AND
+    u.hash != '' AND
+    deleted = false AND
+    meta IS NOT NULL
+  ORDER BY time_stamp DESC
+  LIMIT 1
+) m ON true
+WHERE ci.collection_id = $1
+ORDER BY ci.index ASC
+LIMIT $2;`
+
+// highest item index in a collection, -1 if the collection is empty
+const qCollectionMaxIndex = `
+SELECT coalesce(max(index), -1)
+FROM collection_items
+WHERE collection_id = $1;`
+
+// lock a collection for the rest of a transaction
+const qCollectionLock = `
+SELECT id
+FROM collections
+WHERE id = $1
+FOR UPDATE;`
+
+// url ids of a collection's items in collection order
+const qCollectionItemOrder = `
+SELECT url_id
+FROM collection_items
+WHERE collection_id = $1
+ORDER BY index ASC, url_id ASC;`
+
+// set the position of an item in a collection
+const qCollectionItemSetIndex = `
+UPDATE collection_items
+SET index = $3
+WHERE collection_id = $1 AND url_id = $2;`
+
+// move an item to another collection at a given position
+const qCollectionItemMove = `
+UPDATE collection_items
+SET collection_id = $3, index = $4
+WHERE collection_id = $1 AND url_id = $2;`
+
+// remove a single item from a collection
+const qCollectionItemDelete = `
+DELETE FROM collection_items
+WHERE collection_id = $1 AND url_id = $2;`
+
+// copy a collection to a new id, creator & title
+const qCollectionDuplicate = `
+INSERT INTO collections
+  (id, created, updated, creator, title, description, url, schema, items_schema, visibility)
+SELECT $2, $3, $3, $4, $5, description, url, schema, items_schema, visibility
+FROM collections
+WHERE id = $1;`
+
+// copy all items of a collection to another collection
+const qCollectionItemsDuplicate = `
+INSERT INTO collection_items
+  (collection_id, url_id, index, description)
+SELECT $2, url_id, index, description
+FROM collection_items
+WHERE collection_id = $1;`
+
+// a collection's current fields, for versioning
+const qCollectionVersionState = `
+SELECT creator, title, description, url
+FROM collections
+WHERE id = $1;`
+
+// a collection's current items, for versioning
+const qCollectionVersionItems = `
+SELECT ci.url_id, coalesce(u.url, ''), coalesce(u.hash, ''), ci.index, ci.description
+FROM collection_items ci
+LEFT JOIN urls u ON u.id = ci.url_id
+WHERE ci.collection_id = $1
+ORDER BY ci.index ASC, ci.url_id ASC;`
+
+// insert a collection version
+const qCollectionVersionInsert = `
+INSERT INTO collection_versions
+  (hash, collection_id, prev, created, key_id, restored_from, creator, title, description, url, items)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11);`
+
+// a single collection version by hash
+const qCollectionVersionByHash = `
+SELECT hash, collection_id, prev, created, key_id, restored_from, creator, title, description, url, items
+FROM collection_versions
+WHERE hash = $1;`
+
+// the latest version of a collection created at or before a time. versions
+// created in the same second are ordered by when they were recorded
+const qCollectionVersionAt = `
+SELECT hash, collection_id, prev, created, key_id, restored_from, creator, title, description, url, items
+FROM collection_versions
+WHERE collection_id = $1 AND created <= $2
+ORDER BY created DESC, seq DESC
+LIMIT 1;`
+
+// the last version recorded for a collection
+const qCollectionVersionHead = `
+SELECT hash, collection_id, prev, created, key_id, restored_from, creator, title, description, url, items
+FROM collection_versions
+WHERE collection_id = $1
+ORDER BY seq DESC
+LIMIT 1;`
+
+// create a collection
+const qCollectionInsert = `
+INSERT INTO collections
+  (id, created, updated, creator, title, description, url)
+VALUES ($1, $2, $3, $4, $5, $6, $7);`
+
+// update a collection's fields, keeping its created time
+const qCollectionUpdateFields = `
+UPDATE collections
+SET updated = $2, creator = $3, title = $4, description = $5, url = $6
+WHERE id = $1
+RETURNING created;`
+
+// restore a collection's fields from a version
+const qCollectionRestore = `
+UPDATE collections
+SET updated = $2, title = $3, description = $4, url = $5
+WHERE id = $1;`
+
+// remove all items from a collection
+const qCollectionItemsClear = `
+DELETE FROM collection_items
+WHERE collection_id = $1;`
+
+// insert a collection item
+const qCollectionItemInsert = `
+INSERT INTO collection_items
+  (collection_id, url_id, index, description)
+VALUES ($1, $2, $3, $4);`
+
+// update the position & description of a collection item
+const qCollectionItemUpdate = `
+UPDATE collection_items
+SET index = $3, description = $4
+WHERE collection_id = $1 AND url_id = $2;`
+
+// check a url id exists
+const qUrlIdExists = `
+SELECT exists(SELECT 1 FROM urls WHERE id = $1);`
+
+// a collection's creator & visibility, and the role of key $2 on it
+const qCollectionAccess = `
+SELECT collections.creator, collections.visibility, coalesce(collection_collaborators.role, '')
+FROM collections
+LEFT JOIN collection_collaborators
+  ON collection_collaborators.collection_id = collections.id AND collection_collaborators.key_id = $2
+WHERE collections.id = $1;`
+
+// set the visibility of a collection
+const qCollectionVisibilityUpdate = `
+UPDATE collections
+SET visibility = $2, updated = $3
+WHERE id = $1;`
+
+// collaborators on a collection, oldest first
+const qCollectionCollaborators = `
+SELECT collection_id, key_id, role, created, updated
+FROM collection_collaborators
+WHERE collection_id = $1
+ORDER BY created, key_id;`
+
+// change the role of an existing collaborator
+const qCollectionCollaboratorUpdate = `
+UPDATE collection_collaborators
+SET role = $3, updated = $4
+WHERE collection_id = $1 AND key_id = $2;`
+
+// when a collaborator was added to a collection
+const qCollectionCollaboratorCreated = `
+SELECT created
+FROM collection_collaborators
+WHERE collection_id = $1 AND key_id = $2;`
+
+// add a collaborator to a collection
+const qCollectionCollaboratorInsert = `
+INSERT INTO collection_collaborators
+  (collection_id, key_id, role, created, updated)
+VALUES ($1, $2, $3, $4, $4);`
+
+// remove a collaborator from a collection
+const qCollectionCollaboratorDelete = `
+DELETE FROM collection_collaborators
+WHERE collection_id = $1 AND key_id = $2;`
+
+// remove all collaborators from a collection
+const qCollectionCollaboratorsClear = `
+DELETE FROM collection_collaborators
+WHERE collection_id = $1;`
+
+// record an audit log entry
+const qAuditLogInsert = `
+INSERT INTO audit_log
+  (id, created, key_id, action, subject_type, subject_id, prev, next)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8);`
+
+// parent of a primer, for checking re-parenting doesn't make a cycle
+const qPrimerParentId = `
+SELECT parent_id
+FROM primers
+WHERE id = $1 AND deleted = false;`
+
+// lock primer parents for the rest of a transaction
+const qPrimerParentsLock = `
+SELECT pg_advisory_xact_lock(hashtext('primer_parents'));`
+
+// set the parent of a primer
+const qPrimerSetParent = `
+UPDATE primers
+SET parent_id = $2, updated = $3
+WHERE id = $1 AND deleted = false;`
+
+// soft-delete a primer
+const qPrimerSoftDelete = `
+UPDATE primers
+SET deleted = true, updated = $2
+WHERE id = $1 AND deleted = false;`
+
+// count the sub-primers & sources still attached to a primer
+const qPrimerDependents = `
+SELECT
+  (SELECT count(1) FROM primers WHERE parent_id = $1 AND deleted = false),
+  (SELECT count(1) FROM sources WHERE primer_id = $1 AND deleted = false);`
+
+// set the primer of a source
+const qSourceSetPrimer = `
+UPDATE sources
+SET primer_id = $2, updated = $3
+WHERE id = $1 AND deleted = false;`
+
+// the source with a url, including deleted sources
+const qSourceByUrlAll = `
+SELECT id, deleted
+FROM sources
+WHERE url = $1;`
+
+// soft-delete a source by id
+const qSourceSoftDelete = `
+UPDATE sources
+SET deleted = true, updated = $2
+WHERE id = $1 AND deleted = false;`
+
+// record when a source's stats were last calculated
+const qSourceStatsCalculated = `
+UPDATE sources
+SET stats_calculated = $2
+WHERE id = $1;`
+
+// record when a primer's stats were last calculated
+const qPrimerStatsCalculated = `
+UPDATE primers
+SET stats_calculated = $2
+WHERE id = $1;`
+
+// sources & primers whose stats haven't been calculated since $1, never
+// calculated first
+const qStaleStats = `
+SELECT 'SOURCE', id::text, stats_calculated
+FROM sources
+WHERE deleted = false AND (stats_calculated IS NULL OR stats_calculated < $1)
+UNION ALL
+SELECT 'PRIMER', id::text, stats_calculated
+FROM primers
+WHERE deleted = false AND (stats_calculated IS NULL OR stats_calculated < $1)
+ORDER BY 3 NULLS FIRST
+LIMIT $2;`
+
+// crawled sources none of whose urls have been fetched within the source's
+// stale duration as of $1, that don't have an open alert, haven't been
+// alerted on within their stale duration & aren't suppressed. stale
+// durations are stored in milliseconds. never fetched sources come first.
+// source urls have no scheme, so a source's urls are those containing its url
+const qStaleSources = `
+SELECT s.id, coalesce(s.primer_id::text, ''), s.title, s.url, s.stale_duration, f.last_get
+FROM sources s
+LEFT JOIN LATERAL (
+  SELECT max(u.last_get) AS last_get
+  FROM urls u
+  WHERE ` + qSourceUrlMatch + `
+) f ON true
+WHERE
+  s.deleted = false AND s.crawl = true AND s.stale_duration > 0 AND
+  (f.last_get IS NULL OR f.last_get < $1 - s.stale_duration * interval '1 millisecond') AND
+  (s.last_alert_sent IS NULL OR s.last_alert_sent < $1 - s.stale_duration * interval '1 millisecond') AND
+  NOT EXISTS (SELECT 1 FROM alerts a WHERE a.source_id = s.id AND a.dismissed = false) AND
+  NOT EXISTS (SELECT 1 FROM supress_alerts sa WHERE sa.source_id = s.id AND (sa.until IS NULL OR sa.until > $1))
+ORDER BY f.last_get NULLS FIRST
+LIMIT $2;`
+
+// record an alert
+const qAlertInsert = `
+INSERT INTO alerts
+  (id, created, updated, source_id, primer_id, message, last_fetched, dismissed, dismissed_by)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9);`
+
+// record when an alert was last sent for a source
+const qSourceAlertSent = `
+UPDATE sources
+SET last_alert_sent = $2
+WHERE id = $1;`
+
+// read an alert by id
+const qAlertById = `
+SELECT ` + alertCols + `
+FROM alerts
+WHERE id = $1;`
+
+// dismiss an open alert
+const qAlertDismiss = `
+UPDATE alerts
+SET dismissed = true, dismissed_by = $2, updated = $3
+WHERE id = $1 AND dismissed = false;`
+
+// dismiss all open alerts for a source
+const qSourceAlertsDismiss = `
+UPDATE alerts
+SET dismissed = true, dismissed_by = $2, updated = $3
+WHERE source_id = $1 AND dismissed = false;`
+
+// suppress alerts for a source until a time, null for indefinitely
+const qAlertSuppressUpdate = `
+UPDATE supress_alerts
+SET created = $2, key_id = $3, until = $4
+WHERE source_id = $1;`
+
+const qAlertSuppressInsert = `
+INSERT INTO supress_alerts
+  (source_id, created, key_id, until)
+VALUES ($1, $2, $3, $4);`
+
+// stop suppressing alerts for a source
+const qAlertSuppressDelete = `
+DELETE FROM supress_alerts
+WHERE source_id = $1;`
+
+// coverage of the urls matching the pattern $1, bucketed by truncating times
+// to the precision $2. each row gives the number of urls that became known,
+// fetched, content & described within a bucket. urls are known when created,
+// fetched & content when last fetched, & described when their earliest
+// metadata that hasn't been deleted was written. content urls match core's described & undescribed content:
+// fetched, non-empty & not html
+const qSourceCoverageBuckets = `
+WITH u AS (
+  SELECT
+    created, last_get,
+    (last_get IS NOT NULL AND
+     hash != '' AND
+     hash != '1220e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855' AND
+     content_sniff != 'text/html; charset=utf-8') AS content,
+    (SELECT min(time_stamp) FROM metadata WHERE metadata.subject = urls.hash AND deleted = false) AS described
+  FROM urls
+  WHERE url ilike $1
+)
+SELECT bucket, sum(known), sum(fetched), sum(content), sum(described)
+FROM (
+  SELECT date_trunc($2::text, created) AS bucket, 1 AS known, 0 AS fetched, 0 AS content, 0 AS described FROM u
+  UNION ALL
+  SELECT date_trunc($2::text, last_get), 0, 1, 0, 0 FROM u WHERE last_get IS NOT NULL
+  UNION ALL
+  SELECT date_trunc($2::text, last_get), 0, 0, 1, 0 FROM u WHERE content
+  UNION ALL
+  SELECT date_trunc($2::text, described), 0, 0, 0, 1 FROM u WHERE content AND described IS NOT NULL
+) b
+GROUP BY bucket
+ORDER BY bucket;`
@@ -4,6 +4,10 @@
 
 package main
 
+import (
+	"encoding/json"
+)
+
 // room maintains the set of active clients and broadcasts messages to the
 // clients.
 type Room struct {
@@ -15,17 +19,55 @@ type Room struct {
 	register chan *Client
 	// Unregister requests from clients.
 	unregister chan *Client
+	// clients subscribed to each topic
+	topics map[string]map[*Client]bool
+	// Subscribe requests from clients
+	subscribe chan subscription
+	// Unsubscribe requests from clients
+	unsubscribe chan subscription
+	// messages for clients subscribed to a topic
+	publish chan publication
+}
+
+// subscription pairs a client with a topic it's interested in
+type subscription struct {
+	client *Client
+	topic  string
+}
+
+// publication is a message for all clients subscribed to a topic
+type publication struct {
+	topic string
+	data  []byte
 }
 
 func newRoom() *Room {
 	return &Room{
-		broadcast:  make(chan []byte),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
-		clients:    make(map[*Client]bool),
+		broadcast:   make(chan []byte),
+		register:    make(chan *Client),
+		unregister:  make(chan *Client),
+		clients:     make(map[*Client]bool),
+		topics:      make(map[string]map[*Client]bool),
+		subscribe:   make(chan subscription),
+		unsubscribe: make(chan subscription),
+		publish:     make(chan publication),
 	}
 }
 
+// Publish sends a response to all clients subscribed to topic. it's safe to
+// call on a nil room, which is a no-op
+func (h *Room) Publish(topic string, res *ClientResponse) {
+	if h == nil {
+		return
+	}
+	data, err := json.Marshal(res)
+	if err != nil {
+		log.Info(err.Error())
+		return
+	}
+	h.publish <- publication{topic: topic, data: data}
+}
+
 func (h *Room) run() {
 	for {
 		select {
@@ -33,18 +75,53 @@ func (h *Room) run() {
 			h.clients[client] = true
 		case client := <-h.unregister:
 			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
+				h.remove(client)
+			}
+		case s := <-h.subscribe:
+			if _, ok := h.clients[s.client]; !ok {
+				continue
+			}
+			if h.topics[s.topic] == nil {
+				h.topics[s.topic] = make(map[*Client]bool)
 			}
+			h.topics[s.topic][s.client] = true
+		case s := <-h.unsubscribe:
+			h.leave(s.topic, s.client)
 		case message := <-h.broadcast:
 			for client := range h.clients {
 				select {
 				case client.send <- message:
 				default:
-					close(client.send)
-					delete(h.clients, client)
+					h.remove(client)
 				}
 			}
+		case p := <-h.publish:
+			for client := range h.topics[p.topic] {
+				select {
+				case client.send <- p.data:
+				default:
+					h.remove(client)
+				}
+			}
+		}
+	}
+}
+
+// remove drops a client from the room & all topics, closing its done channel
+func (h *Room) remove(client *Client) {
+	for topic := range h.topics {
+		h.leave(topic, client)
+	}
+	delete(h.clients, client)
+	close(client.done)
+}
+
+// leave removes a client from a topic, dropping the topic if it's now empty
+func (h *Room) leave(topic string, client *Client) {
+	if subs, ok := h.topics[topic]; ok {
+		delete(subs, client)
+		if len(subs) == 0 {
+			delete(h.topics, topic)
 		}
 	}
 }
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/datatogether/core"
+)
+
+// FetchSchemaAction grabs the schema attached to a collection or primer, or
+// all schemas that apply to metadata for a subject
+type FetchSchemaAction struct {
+	ReqAction
+	CollectionId string
+	PrimerId     string
+	Subject      string
+}
+
+func (FetchSchemaAction) Type() string        { return "SCHEMA_FETCH_REQUEST" }
+func (FetchSchemaAction) SuccessType() string { return "SCHEMA_FETCH_SUCCESS" }
+func (FetchSchemaAction) FailureType() string { return "SCHEMA_FETCH_FAILURE" }
+
+func (FetchSchemaAction) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &FetchSchemaAction{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *FetchSchemaAction) Exec() (res *ClientResponse) {
+	if a.Subject != "" {
+		schemas, err := SubjectSchemas(appDB, a.Subject, a.client.keyId())
+		if err != nil {
+			log.Info(err.Error())
+			return &ClientResponse{
+				Type:      a.FailureType(),
+				RequestId: a.RequestId,
+				Error:     err.Error(),
+			}
+		}
+
+		return &ClientResponse{
+			Type:      a.SuccessType(),
+			RequestId: a.RequestId,
+			Schema:    "SCHEMA_ARRAY",
+			Id:        a.Subject,
+			Data:      schemas,
+		}
+	}
+
+	s, err := a.read()
+	if err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "SCHEMA",
+		Id:        s.Id,
+		Data:      s,
+	}
+}
+
+func (a *FetchSchemaAction) read() (s *AttachedSchema, err error) {
+	switch {
+	case a.CollectionId != "":
+		s = &AttachedSchema{Type: "COLLECTION", Id: a.CollectionId}
+		s.Schema, s.ItemsSchema, err = ReadCollectionSchemas(appDB, a.CollectionId)
+	case a.PrimerId != "":
+		s = &AttachedSchema{Type: "PRIMER", Id: a.PrimerId}
+		s.Schema, err = ReadPrimerSchema(appDB, a.PrimerId)
+	default:
+		err = fmt.Errorf("collectionId, primerId or subject is required")
+	}
+	return
+}
+
+// SaveSchemaAction attaches schemas to a collection or primer. A nil schema
+// removes an attached schema. collection schemas can be saved by the
+// collection's owner, primer schemas only by admins
+type SaveSchemaAction struct {
+	ReqAction
+	CollectionId string
+	PrimerId     string
+	Schema       map[string]interface{}
+	// schema for collection items, ignored for primers
+	ItemsSchema map[string]interface{}
+}
+
+func (SaveSchemaAction) Type() string        { return "SCHEMA_SAVE_REQUEST" }
+func (SaveSchemaAction) SuccessType() string { return "SCHEMA_SAVE_SUCCESS" }
+func (SaveSchemaAction) FailureType() string { return "SCHEMA_SAVE_FAILURE" }
+
+func (SaveSchemaAction) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &SaveSchemaAction{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *SaveSchemaAction) Exec() (res *ClientResponse) {
+	s, err := a.save()
+	if err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "SCHEMA",
+		Id:        s.Id,
+		Data:      s,
+	}
+}
+
+func (a *SaveSchemaAction) save() (*AttachedSchema, error) {
+	keyId := a.client.keyId()
+	if keyId == "" {
+		return nil, fmt.Errorf("you must be logged in to save a schema")
+	}
+
+	switch {
+	case a.CollectionId != "":
+		if err := requireCollectionRole(appDB, a.CollectionId, keyId, CollectionRoleOwner); err != nil {
+			return nil, err
+		}
+		c := &core.Collection{Id: a.CollectionId}
+		if err := c.Read(store); err != nil {
+			return nil, err
+		}
+		if err := SaveCollectionSchemas(appDB, c.Id, a.Schema, a.ItemsSchema); err != nil {
+			return nil, err
+		}
+		return &AttachedSchema{Type: "COLLECTION", Id: c.Id, Title: c.Title, Schema: a.Schema, ItemsSchema: a.ItemsSchema}, nil
+	case a.PrimerId != "":
+		if err := requireAdmin(keyId); err != nil {
+			return nil, err
+		}
+		if err := SavePrimerSchema(appDB, a.PrimerId, a.Schema); err != nil {
+			return nil, err
+		}
+		return &AttachedSchema{Type: "PRIMER", Id: a.PrimerId, Schema: a.Schema}, nil
+	}
+	return nil, fmt.Errorf("collectionId or primerId is required")
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/datatogether/core"
+)
+
+// AttachedSchema is a JSON Schema document attached to a collection or primer
+type AttachedSchema struct {
+	// type of entity the schema is attached to, "COLLECTION" or "PRIMER"
+	Type   string                 `json:"type"`
+	Id     string                 `json:"id"`
+	Title  string                 `json:"title,omitempty"`
+	Schema map[string]interface{} `json:"schema"`
+	// schema for items in a collection, only set for collections
+	ItemsSchema map[string]interface{} `json:"itemsSchema,omitempty"`
+}
+
+// ReadCollectionSchemas reads the schemas attached to a collection: schema
+// describes metadata for the collection's contents, itemsSchema describes
+// the items themselves. either is nil if not attached
+func ReadCollectionSchemas(db sqlQueryable, id string) (schema, itemsSchema map[string]interface{}, err error) {
+	var data, itemsData []byte
+	if err = db.QueryRow(qCollectionSchema, id).Scan(&data, &itemsData); err != nil {
+		if err == sql.ErrNoRows {
+			err = core.ErrNotFound
+		}
+		return
+	}
+	if schema, err = unmarshalSchema(data); err != nil {
+		return
+	}
+	itemsSchema, err = unmarshalSchema(itemsData)
+	return
+}
+
+// ReadPrimerSchema reads the schema attached to a primer, returning a nil
+// schema if none is attached
+func ReadPrimerSchema(db sqlQueryable, id string) (map[string]interface{}, error) {
+	var data []byte
+	if err := db.QueryRow(qPrimerSchema, id).Scan(&data); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, core.ErrNotFound
+		}
+		return nil, err
+	}
+	return unmarshalSchema(data)
+}
+
+func unmarshalSchema(data []byte) (map[string]interface{}, error) {
+	if data == nil {
+		return nil, nil
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// marshalSchema checks & encodes a schema for storage, nil schemas are
+// stored as null
+func marshalSchema(schema map[string]interface{}) ([]byte, error) {
+	if schema == nil {
+		return nil, nil
+	}
+	if err := CheckSchema(schema); err != nil {
+		return nil, err
+	}
+	return json.Marshal(schema)
+}
+
+// SaveCollectionSchemas attaches schemas to a collection, nil schemas
+// are removed
+func SaveCollectionSchemas(db sqlExecable, id string, schema, itemsSchema map[string]interface{}) error {
+	data, err := marshalSchema(schema)
+	if err != nil {
+		return err
+	}
+	itemsData, err := marshalSchema(itemsSchema)
+	if err != nil {
+		return fmt.Errorf("itemsSchema: %s", err.Error())
+	}
+	return execSchemaUpdate(db, qCollectionSchemaUpdate, id, data, itemsData)
+}
+
+// SavePrimerSchema attaches a schema to a primer, a nil schema removes it
+func SavePrimerSchema(db sqlExecable, id string, schema map[string]interface{}) error {
+	data, err := marshalSchema(schema)
+	if err != nil {
+		return err
+	}
+	return execSchemaUpdate(db, qPrimerSchemaUpdate, id, data)
+}
+
+func execSchemaUpdate(db sqlExecable, query string, args ...interface{}) error {
+	res, err := db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return core.ErrNotFound
+	}
+	return nil
+}
+
+// ValidateCollectionItems checks items against a collection's items schema.
+// error fields are prefixed with the item's position in items
+func ValidateCollectionItems(db sqlQueryable, collectionId string, items []*core.CollectionItem) error {
+	_, schema, err := ReadCollectionSchemas(db, collectionId)
+	if err != nil || schema == nil {
+		return err
+	}
+
+	errs := ValidationError{}
+	for i, item := range items {
+		itemErrs, err := validateCollectionItem(schema, item)
+		if err != nil {
+			return err
+		}
+		for _, se := range itemErrs {
+			se.Field = joinSchemaPath(fmt.Sprintf("items[%d]", i), se.Field)
+			errs = append(errs, se)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// validateCollectionItem checks a single item against an items schema
+func validateCollectionItem(schema map[string]interface{}, item *core.CollectionItem) (ValidationError, error) {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return ValidateSchema(schema, doc), nil
+}
+
+// SubjectSchemas lists all schemas that apply to metadata for a subject,
+// leaving out those of private collections keyId can't view
+func SubjectSchemas(db sqlQueryable, subject, keyId string) ([]*AttachedSchema, error) {
+	rows, err := db.Query(qSubjectSchemas, subject, keyId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schemas := make([]*AttachedSchema, 0)
+	for rows.Next() {
+		s := &AttachedSchema{}
+		var data []byte
+		if err := rows.Scan(&s.Type, &s.Id, &s.Title, &data); err != nil {
+			return nil, err
+		}
+		if s.Schema, err = unmarshalSchema(data); err != nil {
+			return nil, fmt.Errorf("invalid schema for %s %s: %s", s.Type, s.Id, err.Error())
+		}
+		schemas = append(schemas, s)
+	}
+
+	return schemas, rows.Err()
+}
+
+// ValidateSubjectMetadata checks metadata written by keyId against every
+// schema that applies to its subject & keyId can view. errors from each
+// schema are prefixed with the entity they're attached to when more than one
+// schema applies
+func ValidateSubjectMetadata(db sqlQueryable, subject, keyId string, meta map[string]interface{}) error {
+	schemas, err := SubjectSchemas(db, subject, keyId)
+	if err != nil {
+		return err
+	}
+
+	errs := ValidationError{}
+	for _, s := range schemas {
+		for _, se := range ValidateSchema(s.Schema, meta) {
+			if len(schemas) > 1 {
+				se.Message = fmt.Sprintf("%s (%s %s)", se.Message, s.Type, s.Title)
+			}
+			errs = append(errs, se)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
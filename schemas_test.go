@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSubjectSchemasPrimer(t *testing.T) {
+	// census primer, whose www.census.gov source has no scheme
+	primerId := "d9deff9d-15e8-43f1-9d00-51160c0bffbe"
+	if _, err := appDB.Exec("UPDATE primers SET schema = $2 WHERE id = $1", primerId, `{"type":"object"}`); err != nil {
+		t.Fatal(err.Error())
+	}
+	defer appDB.Exec("UPDATE primers SET schema = null WHERE id = $1", primerId)
+
+	// content hash of https://www.census.gov/nometa.pdf
+	schemas, err := SubjectSchemas(appDB, "1220af06510193276b5fd9ad2fc55dcc004ada557d9259ca3505478bfef0b12ed988", "")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(schemas) != 1 {
+		t.Fatalf("expected 1 schema, got: %d", len(schemas))
+	}
+	if schemas[0].Type != "PRIMER" || schemas[0].Id != primerId {
+		t.Errorf("expected census primer schema, got: %s %s", schemas[0].Type, schemas[0].Id)
+	}
+}
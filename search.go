@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+// max number of results a single search will return
+const maxSearchPageSize = 50
+
+// characters qSnippetOptions wraps search terms in
+const (
+	snippetStart = "\x02"
+	snippetStop  = "\x03"
+)
+
+// snippetMarker replaces snippet delimiters with mark tags
+var snippetMarker = strings.NewReplacer(snippetStart, "<mark>", snippetStop, "</mark>")
+
+// markSnippet html escapes a snippet from the database & wraps its search
+// terms in <mark> tags, so snippets are safe to render as html
+func markSnippet(snippet string) string {
+	return snippetMarker.Replace(html.EscapeString(snippet))
+}
+
+// UrlSearch is a full text search of urls, optionally narrowed to a content
+// type, source or primer
+type UrlSearch struct {
+	Query       string
+	ContentType string
+	SourceId    string
+	PrimerId    string
+}
+
+// UrlSearchResult is a single ranked url match
+type UrlSearchResult struct {
+	Url         string  `json:"url"`
+	Title       string  `json:"title"`
+	Hash        string  `json:"hash"`
+	ContentType string  `json:"contentType"`
+	SourceId    string  `json:"sourceId,omitempty"`
+	SourceTitle string  `json:"sourceTitle,omitempty"`
+	PrimerId    string  `json:"primerId,omitempty"`
+	PrimerTitle string  `json:"primerTitle,omitempty"`
+	Rank        float64 `json:"rank"`
+	// html escaped matching text with search terms wrapped in <mark> tags
+	Snippet string `json:"snippet"`
+}
+
+// SearchFacet is the number of matches that share a value
+type SearchFacet struct {
+	Value string `json:"value"`
+	Title string `json:"title"`
+	Count int    `json:"count"`
+}
+
+// SearchFacets breaks down all matches of a search
+type SearchFacets struct {
+	ContentTypes []*SearchFacet `json:"contentTypes"`
+	Sources      []*SearchFacet `json:"sources"`
+	Primers      []*SearchFacet `json:"primers"`
+}
+
+// UrlSearchResults is a page of search results, along with the total number
+// of matches & facet counts across all matches
+type UrlSearchResults struct {
+	Total   int                `json:"total"`
+	Facets  *SearchFacets      `json:"facets"`
+	Results []*UrlSearchResult `json:"results"`
+}
+
+func (s *UrlSearch) params() []interface{} {
+	return []interface{}{s.Query, s.ContentType, s.SourceId, s.PrimerId}
+}
+
+// Run performs the search, returning a page of results with total & facets
+func (s *UrlSearch) Run(db sqlQueryable, limit, offset int) (*UrlSearchResults, error) {
+	if s.Query == "" {
+		return nil, fmt.Errorf("search query is required")
+	}
+	if limit <= 0 || limit > maxSearchPageSize {
+		limit = maxSearchPageSize
+	}
+
+	results, err := s.Results(db, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	facets, err := s.Facets(db)
+	if err != nil {
+		return nil, err
+	}
+
+	total := 0
+	for _, f := range facets.ContentTypes {
+		total += f.Count
+	}
+
+	return &UrlSearchResults{
+		Total:   total,
+		Facets:  facets,
+		Results: results,
+	}, nil
+}
+
+// Results reads a page of matches, ordered by rank
+func (s *UrlSearch) Results(db sqlQueryable, limit, offset int) ([]*UrlSearchResult, error) {
+	rows, err := db.Query(qUrlSearch, append(s.params(), limit, offset)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make([]*UrlSearchResult, 0)
+	for rows.Next() {
+		r := &UrlSearchResult{}
+		if err := rows.Scan(
+			&r.Url, &r.Title, &r.Hash, &r.ContentType,
+			&r.SourceId, &r.SourceTitle, &r.PrimerId, &r.PrimerTitle,
+			&r.Rank, &r.Snippet); err != nil {
+			return nil, err
+		}
+		r.Snippet = markSnippet(r.Snippet)
+		results = append(results, r)
+	}
+
+	return results, rows.Err()
+}
+
+// Facets counts matches by content type, source & primer
+func (s *UrlSearch) Facets(db sqlQueryable) (*SearchFacets, error) {
+	rows, err := db.Query(qUrlSearchFacets, s.params()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	facets := &SearchFacets{
+		ContentTypes: []*SearchFacet{},
+		Sources:      []*SearchFacet{},
+		Primers:      []*SearchFacet{},
+	}
+	for rows.Next() {
+		var facet string
+		f := &SearchFacet{}
+		if err := rows.Scan(&facet, &f.Value, &f.Title, &f.Count); err != nil {
+			return nil, err
+		}
+		switch facet {
+		case "content_type":
+			facets.ContentTypes = append(facets.ContentTypes, f)
+		case "source":
+			facets.Sources = append(facets.Sources, f)
+		case "primer":
+			facets.Primers = append(facets.Primers, f)
+		}
+	}
+
+	return facets, rows.Err()
+}
+
+// searchSchemas are the types of entities SearchAll can return
+var searchSchemas = []string{"PRIMER", "SOURCE", "COLLECTION", "URL", "METADATA", "UNCRAWLABLE"}
+
+// SearchAll is a full text search across all searchable entities,
+// optionally limited to a set of schemas
+type SearchAll struct {
+	Query string
+	// schemas to include, empty includes all schemas
+	Types []string
+}
+
+// SearchHit is a single match of any schema. Id is the entity's id, which is
+// the url for URL hits & the subject hash for METADATA hits
+type SearchHit struct {
+	Schema      string  `json:"schema"`
+	Id          string  `json:"id"`
+	Title       string  `json:"title"`
+	Description string  `json:"description,omitempty"`
+	Url         string  `json:"url,omitempty"`
+	Rank        float64 `json:"rank"`
+	// html escaped matching text with search terms wrapped in <mark> tags
+	Snippet string `json:"snippet"`
+}
+
+// SearchAllResults is a page of hits, along with the total number of matches
+// & match counts for each schema
+type SearchAllResults struct {
+	Total  int            `json:"total"`
+	Counts map[string]int `json:"counts"`
+	Hits   []*SearchHit   `json:"hits"`
+}
+
+// types validates & joins requested types into the comma separated form
+// qSearchAll expects
+func (s *SearchAll) types() (string, error) {
+	types := make([]string, len(s.Types))
+	for i, t := range s.Types {
+		t = strings.ToUpper(t)
+		if !validSearchSchema(t) {
+			return "", fmt.Errorf("invalid search type: '%s'", s.Types[i])
+		}
+		types[i] = t
+	}
+	return strings.Join(types, ","), nil
+}
+
+func validSearchSchema(schema string) bool {
+	for _, s := range searchSchemas {
+		if s == schema {
+			return true
+		}
+	}
+	return false
+}
+
+// Run performs the search, returning a page of hits with total & counts
+func (s *SearchAll) Run(db sqlQueryable, limit, offset int) (*SearchAllResults, error) {
+	if s.Query == "" {
+		return nil, fmt.Errorf("search query is required")
+	}
+	types, err := s.types()
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > maxSearchPageSize {
+		limit = maxSearchPageSize
+	}
+
+	rows, err := db.Query(qSearchAll, s.Query, types, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := &SearchAllResults{Counts: map[string]int{}, Hits: []*SearchHit{}}
+	for rows.Next() {
+		var (
+			kind  string
+			count int
+		)
+		h := &SearchHit{}
+		if err := rows.Scan(&kind, &h.Schema, &h.Id, &h.Title, &h.Description, &h.Url, &h.Rank, &h.Snippet, &count); err != nil {
+			return nil, err
+		}
+		switch kind {
+		case "HIT":
+			h.Snippet = markSnippet(h.Snippet)
+			res.Hits = append(res.Hits, h)
+		case "COUNT":
+			res.Counts[h.Schema] = count
+			res.Total += count
+		}
+	}
+
+	return res, rows.Err()
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSearchAllTypes(t *testing.T) {
+	cases := []struct {
+		types  []string
+		expect string
+		err    bool
+	}{
+		{nil, "", false},
+		{[]string{"PRIMER"}, "PRIMER", false},
+		{[]string{"primer", "Source", "URL"}, "PRIMER,SOURCE,URL", false},
+		{[]string{"PRIMER", "NOPE"}, "", true},
+	}
+
+	for i, c := range cases {
+		s := &SearchAll{Query: "epa", Types: c.types}
+		got, err := s.types()
+		if c.err != (err != nil) {
+			t.Errorf("case %d error mismatch. expected error: %t, got: %v", i, c.err, err)
+			continue
+		}
+		if got != c.expect {
+			t.Errorf("case %d mismatch. expected: '%s', got: '%s'", i, c.expect, got)
+		}
+	}
+}
+
+func TestMarkSnippet(t *testing.T) {
+	cases := []struct {
+		snippet, expect string
+	}{
+		{"", ""},
+		{"epa \x02climate\x03 data", "epa <mark>climate</mark> data"},
+		{"<script>\x02alert\x03(1)</script>", "&lt;script&gt;<mark>alert</mark>(1)&lt;/script&gt;"},
+		{"\x02a&b\x03 \"q\"", "<mark>a&amp;b</mark> &#34;q&#34;"},
+	}
+
+	for i, c := range cases {
+		if got := markSnippet(c.snippet); got != c.expect {
+			t.Errorf("case %d mismatch. expected: '%s', got: '%s'", i, c.expect, got)
+		}
+	}
+}
@@ -44,6 +44,10 @@ func main() {
 		// panic if the server is missing a vital configuration detail
 		panic(fmt.Errorf("server configuration error: %s", err.Error()))
 	}
+	setCoreAwsConfig(cfg)
+	if err := loadSigningKeys(cfg); err != nil {
+		panic(fmt.Errorf("server configuration error: %s", err.Error()))
+	}
 
 	connectToAppDb()
 	sql_datastore.SetDB(appDB)
@@ -54,6 +58,9 @@ func main() {
 		&core.Source{},
 		&core.Collection{},
 		&core.CollectionItem{},
+		&core.Uncrawlable{},
+		&core.CustomCrawl{},
+		&core.DataRepo{},
 	)
 
 	go func() {
@@ -65,6 +72,12 @@ func main() {
 	room = newRoom()
 	go room.run()
 
+	statsScheduler = NewStatsScheduler(appDB)
+	statsScheduler.Start()
+
+	alertMonitor = NewAlertMonitor(appDB)
+	alertMonitor.Start()
+
 	s := &http.Server{}
 	// connect mux to server
 	s.Handler = NewServerRoutes()
@@ -105,6 +118,13 @@ func NewServerRoutes() *http.ServeMux {
 	m.Handle("/tasks", middleware(WebappHandler))
 	m.Handle("/tasks/", middleware(WebappHandler))
 
+	m.Handle("/archive", middleware(ArchiveUrlHandler))
+	m.Handle("/warc", middleware(WarcExportHandler))
+	m.Handle("/warc/import", middleware(WarcImportHandler))
+	m.Handle("/metadata/export", middleware(MetadataExportHandler))
+	m.Handle("/metadata/import", middleware(MetadataImportHandler))
+	m.Handle("/collection/export", middleware(CollectionExportHandler))
+
 	m.Handle("/ws", middleware(HandleWebsocketUpgrade))
 
 	return m
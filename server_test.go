@@ -20,6 +20,7 @@ func TestServerRoutes(t *testing.T) {
 		resStatus        int
 	}{
 		{"GET", "/", false, nil, 200},
+		{"GET", "/archive", false, nil, 405},
 		// {"GET", "/healthcheck", false, nil, 200},
 	}
 
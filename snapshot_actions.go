@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+)
+
+// UrlSnapshotsAct fetches the capture history of a url, oldest first
+type UrlSnapshotsAct struct {
+	ReqAction
+	Url string
+}
+
+func (UrlSnapshotsAct) Type() string        { return "URL_SNAPSHOTS_REQUEST" }
+func (UrlSnapshotsAct) SuccessType() string { return "URL_SNAPSHOTS_SUCCESS" }
+func (UrlSnapshotsAct) FailureType() string { return "URL_SNAPSHOTS_FAILURE" }
+
+func (UrlSnapshotsAct) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &UrlSnapshotsAct{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *UrlSnapshotsAct) Exec() (res *ClientResponse) {
+	snapshots, err := UrlSnapshots(appDB, a.Url)
+	if err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "SNAPSHOT_ARRAY",
+		Id:        a.Url,
+		Data:      snapshots,
+	}
+}
+
+// UrlSnapshotChangesAct lists the captures of a url that changed
+// content hash from the capture before
+type UrlSnapshotChangesAct struct {
+	ReqAction
+	Url string
+}
+
+func (UrlSnapshotChangesAct) Type() string        { return "URL_SNAPSHOT_CHANGES_REQUEST" }
+func (UrlSnapshotChangesAct) SuccessType() string { return "URL_SNAPSHOT_CHANGES_SUCCESS" }
+func (UrlSnapshotChangesAct) FailureType() string { return "URL_SNAPSHOT_CHANGES_FAILURE" }
+
+func (UrlSnapshotChangesAct) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &UrlSnapshotChangesAct{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *UrlSnapshotChangesAct) Exec() (res *ClientResponse) {
+	snapshots, err := UrlSnapshots(appDB, a.Url)
+	if err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "SNAPSHOT_CHANGE_ARRAY",
+		Id:        a.Url,
+		Data:      SnapshotChanges(snapshots),
+	}
+}
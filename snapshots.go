@@ -0,0 +1,58 @@
+package main
+
+import (
+	"sort"
+	"time"
+
+	"github.com/datatogether/core"
+)
+
+// SnapshotChange reports a capture of a url whose content hash differs
+// from the capture before it
+type SnapshotChange struct {
+	*core.Snapshot
+	// hash of the previous capture, "" for the first capture
+	PrevHash string `json:"prevHash"`
+	// date of the previous capture, nil for the first capture
+	PrevDate *time.Time `json:"prevDate,omitempty"`
+}
+
+// UrlSnapshots returns all snapshots of a url in chronological order
+func UrlSnapshots(db sqlQueryable, url string) ([]*core.Snapshot, error) {
+	snapshots, err := core.SnapshotsForUrl(db, url)
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(snapshotsByDate(snapshots))
+	return snapshots, nil
+}
+
+// SnapshotChanges filters a chronological list of snapshots to those
+// whose hash differs from the snapshot before. captures with no hash (failed
+// requests, or captures made before hashing) are skipped
+func SnapshotChanges(snapshots []*core.Snapshot) []*SnapshotChange {
+	changes := make([]*SnapshotChange, 0)
+	var prev *core.Snapshot
+	for _, s := range snapshots {
+		if s.Hash == "" {
+			continue
+		}
+		if prev == nil || prev.Hash != s.Hash {
+			c := &SnapshotChange{Snapshot: s}
+			if prev != nil {
+				c.PrevHash = prev.Hash
+				c.PrevDate = &prev.Created
+			}
+			changes = append(changes, c)
+		}
+		prev = s
+	}
+	return changes
+}
+
+// snapshotsByDate sorts snapshots chronologically
+type snapshotsByDate []*core.Snapshot
+
+func (s snapshotsByDate) Len() int           { return len(s) }
+func (s snapshotsByDate) Less(i, j int) bool { return s[i].Created.Before(s[j].Created) }
+func (s snapshotsByDate) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
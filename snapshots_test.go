@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/datatogether/core"
+)
+
+func TestSnapshotChanges(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2017, 1, d, 0, 0, 0, 0, time.UTC) }
+	snapshots := []*core.Snapshot{
+		{Created: day(1), Hash: "a"},
+		{Created: day(2), Hash: "a"},
+		{Created: day(3), Hash: ""},
+		{Created: day(4), Hash: "b"},
+		{Created: day(5), Hash: "b"},
+		{Created: day(6), Hash: "a"},
+	}
+
+	changes := SnapshotChanges(snapshots)
+	expect := []struct {
+		date           time.Time
+		hash, prevHash string
+	}{
+		{day(1), "a", ""},
+		{day(4), "b", "a"},
+		{day(6), "a", "b"},
+	}
+
+	if len(changes) != len(expect) {
+		t.Fatalf("expected %d changes, got %d", len(expect), len(changes))
+	}
+	for i, c := range expect {
+		got := changes[i]
+		if !got.Created.Equal(c.date) || got.Hash != c.hash || got.PrevHash != c.prevHash {
+			t.Errorf("case %d mismatch. expected: %s %s %s, got: %s %s %s", i, c.date, c.hash, c.prevHash, got.Created, got.Hash, got.PrevHash)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/datatogether/core"
+)
+
+// coverage series intervals
+const (
+	CoverageHour  = "hour"
+	CoverageDay   = "day"
+	CoverageWeek  = "week"
+	CoverageMonth = "month"
+)
+
+// max number of points in a coverage series, older points are dropped
+const coverageMaxPoints = 500
+
+func validCoverageInterval(interval string) bool {
+	switch interval {
+	case CoverageHour, CoverageDay, CoverageWeek, CoverageMonth:
+		return true
+	}
+	return false
+}
+
+// CoveragePoint counts a source's urls as of a time
+type CoveragePoint struct {
+	Time time.Time `json:"time"`
+	// urls matching the source
+	Known int `json:"known"`
+	// known urls that have been fetched
+	Fetched int `json:"fetched"`
+	// fetched urls with non-html content
+	Content int `json:"content"`
+	// content urls with metadata
+	Described int `json:"described"`
+}
+
+// SourceCoverage reports how much of a source is archived, with a series of
+// counts over time for charting archiving progress.
+//
+// urls only record when they were last fetched, so the series counts each
+// fetched url in the interval of its latest fetch. re-fetching a url moves it
+// to a later point, so earlier points can undercount what was fetched by then
+type SourceCoverage struct {
+	SourceId string `json:"sourceId"`
+	Url      string `json:"url"`
+	// current counts. Time is when coverage was read
+	CoveragePoint
+	// content urls without metadata
+	Undescribed int `json:"undescribed"`
+	// one of hour, day, week or month
+	Interval string `json:"interval"`
+	// counts as of the end of each interval that saw a change, oldest first.
+	// each point's Time is the start of its interval
+	Series []*CoveragePoint `json:"series"`
+}
+
+// coverageSeries turns per-bucket counts into running totals, giving the
+// totals & the points from since on, limited to the latest max
+func coverageSeries(buckets []*CoveragePoint, since *time.Time, max int) (CoveragePoint, []*CoveragePoint) {
+	var total CoveragePoint
+	series := []*CoveragePoint{}
+	for _, b := range buckets {
+		total.Known += b.Known
+		total.Fetched += b.Fetched
+		total.Content += b.Content
+		total.Described += b.Described
+		if since != nil && b.Time.Before(*since) {
+			continue
+		}
+		p := total
+		p.Time = b.Time
+		series = append(series, &p)
+	}
+	if max > 0 && len(series) > max {
+		series = series[len(series)-max:]
+	}
+	return total, series
+}
+
+// ReadSourceCoverage counts a source's known, fetched, content & described
+// urls, with a series of those counts at each interval from since, or the
+// source's first url if since is nil
+func ReadSourceCoverage(db sqlQueryable, id, interval string, since *time.Time) (*SourceCoverage, error) {
+	if interval == "" {
+		interval = CoverageDay
+	}
+	if !validCoverageInterval(interval) {
+		return nil, fmt.Errorf("invalid interval: '%s'. must be one of hour, day, week or month", interval)
+	}
+
+	s := &core.Source{Id: id}
+	if err := s.Read(store); err != nil {
+		return nil, err
+	}
+
+	// match urls the same way core's source stats do
+	rows, err := db.Query(qSourceCoverageBuckets, "%"+s.Url+"%", interval)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	buckets := []*CoveragePoint{}
+	for rows.Next() {
+		b := &CoveragePoint{}
+		if err := rows.Scan(&b.Time, &b.Known, &b.Fetched, &b.Content, &b.Described); err != nil {
+			return nil, err
+		}
+		b.Time = b.Time.In(time.UTC)
+		buckets = append(buckets, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	total, series := coverageSeries(buckets, since, coverageMaxPoints)
+	total.Time = time.Now().Round(time.Second).In(time.UTC)
+	return &SourceCoverage{
+		SourceId:      s.Id,
+		Url:           s.Url,
+		CoveragePoint: total,
+		Undescribed:   total.Content - total.Described,
+		Interval:      interval,
+		Series:        series,
+	}, nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// SourceCoverageAct reads how much of a source is archived, with a series of
+// counts over time. Interval defaults to day, Since to the source's first url
+type SourceCoverageAct struct {
+	ReqAction
+	Id       string     `json:"id"`
+	Interval string     `json:"interval"`
+	Since    *time.Time `json:"since"`
+}
+
+func (SourceCoverageAct) Type() string        { return "SOURCE_COVERAGE_REQUEST" }
+func (SourceCoverageAct) SuccessType() string { return "SOURCE_COVERAGE_SUCCESS" }
+func (SourceCoverageAct) FailureType() string { return "SOURCE_COVERAGE_FAILURE" }
+
+func (SourceCoverageAct) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &SourceCoverageAct{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *SourceCoverageAct) Exec() (res *ClientResponse) {
+	c, err := ReadSourceCoverage(appDB, a.Id, a.Interval, a.Since)
+	if err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "SOURCE_COVERAGE",
+		Id:        a.Id,
+		Data:      c,
+	}
+}
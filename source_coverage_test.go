@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCoverageSeries(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2017, 6, d, 0, 0, 0, 0, time.UTC) }
+	buckets := []*CoveragePoint{
+		{Time: day(1), Known: 10},
+		{Time: day(2), Known: 5, Fetched: 8, Content: 3},
+		{Time: day(3), Fetched: 4, Content: 2, Described: 1},
+	}
+
+	total, series := coverageSeries(buckets, nil, 0)
+	expect := CoveragePoint{Known: 15, Fetched: 12, Content: 5, Described: 1}
+	if total != expect {
+		t.Errorf("total mismatch. expected: %v, got: %v", expect, total)
+	}
+	if len(series) != 3 {
+		t.Fatalf("expected 3 points, got %d", len(series))
+	}
+	if p := series[1]; p.Time != day(2) || p.Known != 15 || p.Fetched != 8 || p.Content != 3 || p.Described != 0 {
+		t.Errorf("expected running totals, got: %v", p)
+	}
+
+	since := day(2)
+	total, series = coverageSeries(buckets, &since, 0)
+	if total != expect {
+		t.Errorf("since shouldn't change totals. expected: %v, got: %v", expect, total)
+	}
+	if len(series) != 2 || series[0].Known != 15 {
+		t.Errorf("expected points from since to include earlier counts, got: %v", series)
+	}
+
+	_, series = coverageSeries(buckets, nil, 1)
+	if len(series) != 1 || series[0].Time != day(3) {
+		t.Errorf("expected max to keep the latest point, got: %v", series)
+	}
+}
+
+func TestValidCoverageInterval(t *testing.T) {
+	for _, i := range []string{CoverageHour, CoverageDay, CoverageWeek, CoverageMonth} {
+		if !validCoverageInterval(i) {
+			t.Errorf("expected '%s' to be valid", i)
+		}
+	}
+	// intervals are passed to date_trunc, so anything else must be rejected
+	for _, i := range []string{"", "minute", "day; DROP TABLE urls"} {
+		if validCoverageInterval(i) {
+			t.Errorf("expected '%s' to be invalid", i)
+		}
+	}
+}
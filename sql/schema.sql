@@ -1,5 +1,5 @@
 -- name: drop-all
-DROP TABLE IF EXISTS urls, links, primers, sources, subprimers, alerts, context, metadata, supress_alerts, snapshots, collections, collection_items, archive_requests, uncrawlables, data_repos;
+DROP TABLE IF EXISTS urls, links, primers, sources, subprimers, alerts, context, metadata, supress_alerts, snapshots, collections, collection_items, archive_requests, uncrawlables, custom_crawls, data_repos, metadata_signatures, collection_versions, collection_collaborators, audit_log;
 
 -- name: create-primers
 CREATE TABLE IF NOT EXISTS primers (
@@ -12,8 +12,14 @@ CREATE TABLE IF NOT EXISTS primers (
   parent_id        text NOT NULL default '', -- this should be "UUID references primers(id)", but then we'd need to accept null values, no bueno
   stats            json,
   meta             json,
+  schema           json,
+  stats_calculated timestamp,
+  search           tsvector,
   deleted          boolean default false
 );
+-- columns added after the table was first created, for existing databases
+ALTER TABLE primers ADD COLUMN IF NOT EXISTS schema json;
+ALTER TABLE primers ADD COLUMN IF NOT EXISTS stats_calculated timestamp;
 
 -- name: create-sources
 CREATE TABLE IF NOT EXISTS sources (
@@ -29,8 +35,12 @@ CREATE TABLE IF NOT EXISTS sources (
   last_alert_sent  timestamp,
   stats            json,
   meta             json,
+  stats_calculated timestamp,
+  search           tsvector,
   deleted          boolean default false
 );
+-- columns added after the table was first created, for existing databases
+ALTER TABLE sources ADD COLUMN IF NOT EXISTS stats_calculated timestamp;
 
 -- name: create-urls
 CREATE TABLE IF NOT EXISTS urls (
@@ -50,6 +60,7 @@ CREATE TABLE IF NOT EXISTS urls (
   download_took    integer NOT NULL default 0,
   headers          json,
   meta             json,
+  search           tsvector,
   hash             text NOT NULL default ''
 );
 
@@ -70,9 +81,19 @@ CREATE TABLE IF NOT EXISTS metadata (
   subject          text NOT NULL,
   prev             text NOT NULL default '',
   meta             json,
+  search           tsvector,
   deleted          boolean default false
 );
 
+-- name: create-metadata_signatures
+CREATE TABLE IF NOT EXISTS metadata_signatures (
+  hash             text PRIMARY KEY NOT NULL,
+  created          timestamp NOT NULL default (now() at time zone 'utc'),
+  key_id           text NOT NULL default '',
+  public_key       text NOT NULL default '',
+  signature        text NOT NULL default ''
+);
+
 -- name: create-snapshots
 CREATE TABLE IF NOT EXISTS snapshots (
   url              text NOT NULL references urls(url) ON DELETE CASCADE,
@@ -83,6 +104,18 @@ CREATE TABLE IF NOT EXISTS snapshots (
   hash             text NOT NULL DEFAULT ''
 );
 
+-- name: create-audit_log
+CREATE TABLE IF NOT EXISTS audit_log (
+  id               UUID PRIMARY KEY,
+  created          timestamp NOT NULL,
+  key_id           text NOT NULL default '',
+  action           text NOT NULL,
+  subject_type     text NOT NULL,
+  subject_id       text NOT NULL,
+  prev             json,
+  next             json
+);
+
 -- name: create-collections
 CREATE TABLE IF NOT EXISTS collections (
   id               UUID PRIMARY KEY,
@@ -93,8 +126,42 @@ CREATE TABLE IF NOT EXISTS collections (
   title            text NOT NULL DEFAULT '',
   url              text NOT NULL DEFAULT '',
   schema           json,
-  contents         json
+  items_schema     json,
+  contents         json,
+  search           tsvector,
+  visibility       text NOT NULL DEFAULT 'public'
 );
+-- columns added after the table was first created, for existing databases
+ALTER TABLE collections ADD COLUMN IF NOT EXISTS items_schema json;
+ALTER TABLE collections ADD COLUMN IF NOT EXISTS visibility text NOT NULL DEFAULT 'public';
+
+-- name: create-collection_collaborators
+CREATE TABLE IF NOT EXISTS collection_collaborators (
+  collection_id    UUID NOT NULL,
+  key_id           text NOT NULL,
+  role             text NOT NULL,
+  created          timestamp NOT NULL,
+  updated          timestamp NOT NULL,
+  PRIMARY KEY      (collection_id, key_id)
+);
+
+-- name: create-collection_versions
+CREATE TABLE IF NOT EXISTS collection_versions (
+  hash             text PRIMARY KEY NOT NULL,
+  collection_id    UUID NOT NULL,
+  prev             text NOT NULL default '',
+  created          timestamp NOT NULL,
+  seq              serial, -- insertion order, which orders versions created in the same second
+  key_id           text NOT NULL default '',
+  restored_from    text NOT NULL default '',
+  creator          text NOT NULL default '',
+  title            text NOT NULL default '',
+  description      text NOT NULL default '',
+  url              text NOT NULL default '',
+  items            json
+);
+-- columns added after the table was first created, for existing databases
+ALTER TABLE collection_versions ADD COLUMN IF NOT EXISTS seq serial;
 
 -- name: create-collection_items
 CREATE TABLE IF NOT EXISTS collection_items (
@@ -102,6 +169,7 @@ CREATE TABLE IF NOT EXISTS collection_items (
   url_id           text NOT NULL default '',
   index            integer NOT NULL default -1,
   description      text NOT NULL default '',
+  search           tsvector,
   PRIMARY KEY      (collection_id, url_id)
 );
 
@@ -126,16 +194,36 @@ CREATE TABLE IF NOT EXISTS uncrawlables (
   interactive      boolean default false,
   many_files       boolean default false,
   comments         text NOT NULL default '',
+  search           tsvector,
   deleted          boolean NOT NULL default false
 );
 
+-- name: create-custom_crawls
+CREATE TABLE IF NOT EXISTS custom_crawls (
+  id               UUID PRIMARY KEY NOT NULL,
+  created          timestamp NOT NULL default (now() at time zone 'utc'),
+  updated          timestamp NOT NULL default (now() at time zone 'utc'),
+  jwt              text NOT NULL default '',
+  morphRunId       text NOT NULL default '',
+  dateCompleted    timestamp NOT NULL default (now() at time zone 'utc'),
+  githubRepo       text NOT NULL default '',
+  originalUrl      text NOT NULL default '',
+  sqliteChecksum   text NOT NULL default '',
+  creator_key_id   text NOT NULL default ''
+);
+-- columns added after the table was first created, for existing databases
+ALTER TABLE custom_crawls ADD COLUMN IF NOT EXISTS creator_key_id text NOT NULL default '';
+
 -- name: create-archive_requests
 CREATE TABLE IF NOT EXISTS archive_requests (
   id               serial primary key,
   created          timestamp NOT NULL default (now() at time zone 'utc'),
   url              text NOT NULL,
-  user_id          text NOT NULL default ''
+  user_id          text NOT NULL default '',
+  origin           text NOT NULL default ''
 );
+-- columns added after the table was first created, for existing databases
+ALTER TABLE archive_requests ADD COLUMN IF NOT EXISTS origin text NOT NULL default '';
 
 -- name: create-data_repos
 CREATE TABLE IF NOT EXISTS data_repos (
@@ -148,11 +236,138 @@ CREATE TABLE IF NOT EXISTS data_repos (
   deleted          boolean default false
 );
 
--- CREATE TABLE IF NOT EXISTS alerts (
---   id   UUID UNIQUE NOT NULL,
---   created   integer NOT NULL,
---   updated   integer NOT NULL,
---   dismissed   boolean default false,
---   domain   UUID references primers(id),
---   message   text
--- );
\ No newline at end of file
+-- name: create-alerts
+CREATE TABLE IF NOT EXISTS alerts (
+  id               UUID PRIMARY KEY NOT NULL,
+  created          timestamp NOT NULL,
+  updated          timestamp NOT NULL,
+  source_id        UUID NOT NULL,
+  primer_id        text NOT NULL default '',
+  message          text NOT NULL default '',
+  last_fetched     timestamp,
+  dismissed        boolean NOT NULL default false,
+  dismissed_by     text NOT NULL default ''
+);
+
+-- name: create-supress_alerts
+CREATE TABLE IF NOT EXISTS supress_alerts (
+  source_id        UUID PRIMARY KEY NOT NULL,
+  created          timestamp NOT NULL,
+  key_id           text NOT NULL default '',
+  until            timestamp
+);
+
+-- name: create-indexes
+CREATE INDEX IF NOT EXISTS urls_url_pattern_idx ON urls (url text_pattern_ops);
+CREATE INDEX IF NOT EXISTS urls_hash_idx ON urls (hash);
+CREATE INDEX IF NOT EXISTS urls_id_idx ON urls (id);
+CREATE INDEX IF NOT EXISTS metadata_subject_idx ON metadata (subject);
+CREATE INDEX IF NOT EXISTS collection_versions_collection_created_idx ON collection_versions (collection_id, created);
+
+-- name: create-search
+-- full text search vectors are kept up to date by triggers, so rows written
+-- through core are indexed too. titles are weighted above other text.
+-- columns are added & existing rows indexed (the update fires the trigger)
+-- for databases created before search columns existed
+ALTER TABLE primers ADD COLUMN IF NOT EXISTS search tsvector;
+CREATE OR REPLACE FUNCTION primers_search() RETURNS trigger AS $$
+BEGIN
+  NEW.search :=
+    setweight(to_tsvector('english', coalesce(NEW.title, '')), 'A') ||
+    setweight(to_tsvector('english', concat_ws(' ', NEW.short_title, NEW.description)), 'B');
+  RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS primers_search ON primers;
+CREATE TRIGGER primers_search BEFORE INSERT OR UPDATE ON primers
+  FOR EACH ROW EXECUTE PROCEDURE primers_search();
+UPDATE primers SET search = NULL WHERE search IS NULL;
+CREATE INDEX IF NOT EXISTS primers_search_idx ON primers USING gin (search);
+
+ALTER TABLE sources ADD COLUMN IF NOT EXISTS search tsvector;
+CREATE OR REPLACE FUNCTION sources_search() RETURNS trigger AS $$
+BEGIN
+  NEW.search :=
+    setweight(to_tsvector('english', coalesce(NEW.title, '')), 'A') ||
+    setweight(to_tsvector('english', concat_ws(' ', NEW.description, NEW.url)), 'B');
+  RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS sources_search ON sources;
+CREATE TRIGGER sources_search BEFORE INSERT OR UPDATE ON sources
+  FOR EACH ROW EXECUTE PROCEDURE sources_search();
+UPDATE sources SET search = NULL WHERE search IS NULL;
+CREATE INDEX IF NOT EXISTS sources_search_idx ON sources USING gin (search);
+
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS search tsvector;
+CREATE OR REPLACE FUNCTION urls_search() RETURNS trigger AS $$
+BEGIN
+  NEW.search :=
+    setweight(to_tsvector('english', coalesce(NEW.title, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(NEW.url, '')), 'B');
+  RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS urls_search ON urls;
+CREATE TRIGGER urls_search BEFORE INSERT OR UPDATE ON urls
+  FOR EACH ROW EXECUTE PROCEDURE urls_search();
+UPDATE urls SET search = NULL WHERE search IS NULL;
+CREATE INDEX IF NOT EXISTS urls_search_idx ON urls USING gin (search);
+
+ALTER TABLE metadata ADD COLUMN IF NOT EXISTS search tsvector;
+CREATE OR REPLACE FUNCTION metadata_search() RETURNS trigger AS $$
+BEGIN
+  NEW.search :=
+    setweight(to_tsvector('english', coalesce(NEW.meta->>'title', '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(NEW.meta::text, '')), 'B');
+  RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS metadata_search ON metadata;
+CREATE TRIGGER metadata_search BEFORE INSERT OR UPDATE ON metadata
+  FOR EACH ROW EXECUTE PROCEDURE metadata_search();
+UPDATE metadata SET search = NULL WHERE search IS NULL;
+CREATE INDEX IF NOT EXISTS metadata_search_idx ON metadata USING gin (search);
+
+ALTER TABLE collections ADD COLUMN IF NOT EXISTS search tsvector;
+CREATE OR REPLACE FUNCTION collections_search() RETURNS trigger AS $$
+BEGIN
+  NEW.search :=
+    setweight(to_tsvector('english', coalesce(NEW.title, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(NEW.description, '')), 'B');
+  RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS collections_search ON collections;
+CREATE TRIGGER collections_search BEFORE INSERT OR UPDATE ON collections
+  FOR EACH ROW EXECUTE PROCEDURE collections_search();
+UPDATE collections SET search = NULL WHERE search IS NULL;
+CREATE INDEX IF NOT EXISTS collections_search_idx ON collections USING gin (search);
+
+ALTER TABLE collection_items ADD COLUMN IF NOT EXISTS search tsvector;
+CREATE OR REPLACE FUNCTION collection_items_search() RETURNS trigger AS $$
+BEGIN
+  NEW.search := to_tsvector('english', coalesce(NEW.description, ''));
+  RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS collection_items_search ON collection_items;
+CREATE TRIGGER collection_items_search BEFORE INSERT OR UPDATE ON collection_items
+  FOR EACH ROW EXECUTE PROCEDURE collection_items_search();
+UPDATE collection_items SET search = NULL WHERE search IS NULL;
+CREATE INDEX IF NOT EXISTS collection_items_search_idx ON collection_items USING gin (search);
+
+ALTER TABLE uncrawlables ADD COLUMN IF NOT EXISTS search tsvector;
+CREATE OR REPLACE FUNCTION uncrawlables_search() RETURNS trigger AS $$
+BEGIN
+  NEW.search :=
+    setweight(to_tsvector('english', coalesce(NEW.url, '')), 'A') ||
+    setweight(to_tsvector('english', concat_ws(' ', NEW.agency_name, NEW.event_name, NEW.comments)), 'B');
+  RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS uncrawlables_search ON uncrawlables;
+CREATE TRIGGER uncrawlables_search BEFORE INSERT OR UPDATE ON uncrawlables
+  FOR EACH ROW EXECUTE PROCEDURE uncrawlables_search();
+UPDATE uncrawlables SET search = NULL WHERE search IS NULL;
+CREATE INDEX IF NOT EXISTS uncrawlables_search_idx ON uncrawlables USING gin (search);
@@ -108,7 +108,7 @@ delete from uncrawlables;
 
 -- name: insert-archive_requests
 -- insert into archive_requests values
---  ('8b14f3d6-882f-4dd5-92f8-abaac220864f','2017-01-01 00:00:01','http://www.apple.com','');
+--  ('8b14f3d6-882f-4dd5-92f8-abaac220864f','2017-01-01 00:00:01','http://www.apple.com','','');
 -- name: delete-archive_requests
 delete from archive_requests;
 
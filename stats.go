@@ -0,0 +1,257 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/datatogether/core"
+)
+
+// types of stats jobs
+const (
+	StatsSource = "SOURCE"
+	StatsPrimer = "PRIMER"
+)
+
+// stats scheduler defaults
+const (
+	// minimum time between recalculating the stats of the same source or primer
+	statsMinInterval = 10 * time.Minute
+	// stats older than this are refreshed by the periodic sweep
+	statsStaleAfter = 24 * time.Hour
+	// how often to sweep for stale stats
+	statsSweepInterval = time.Hour
+	// number of stats calculated at once
+	statsWorkers = 2
+	// max number of jobs waiting to be calculated, & read per sweep
+	statsQueueSize = 100
+)
+
+// statsScheduler is the server's stats scheduler, nil until the server starts
+var statsScheduler *StatsScheduler
+
+// StatsJob identifies a source or primer whose stats need calculating
+type StatsJob struct {
+	Type string
+	Id   string
+}
+
+// StatsScheduler recalculates source & primer stats in the background.
+// Requests for the same job are deduplicated while it's queued or running,
+// & ignored if it was calculated within MinInterval. A fixed number of
+// workers limits how many stats queries run at once. Updated stats are
+// published to the job's topic
+type StatsScheduler struct {
+	MinInterval   time.Duration
+	StaleAfter    time.Duration
+	SweepInterval time.Duration
+	Workers       int
+
+	// calc recalculates & saves a job's stats, returning the new stats
+	calc func(job StatsJob) (interface{}, error)
+	// stale lists up to limit jobs whose stats were calculated before a time
+	stale func(before time.Time, limit int) ([]StatsJob, error)
+
+	queue chan StatsJob
+	done  chan struct{}
+
+	lock sync.Mutex
+	// jobs that are queued or running
+	pending map[StatsJob]bool
+	// when each job last finished calculating
+	last map[StatsJob]time.Time
+}
+
+// NewStatsScheduler creates a scheduler that calculates stats in db
+func NewStatsScheduler(db *sql.DB) *StatsScheduler {
+	return newStatsScheduler(
+		func(job StatsJob) (interface{}, error) {
+			return CalcStats(db, job)
+		},
+		func(before time.Time, limit int) ([]StatsJob, error) {
+			return ReadStaleStats(db, before, limit)
+		},
+	)
+}
+
+func newStatsScheduler(calc func(job StatsJob) (interface{}, error), stale func(before time.Time, limit int) ([]StatsJob, error)) *StatsScheduler {
+	return &StatsScheduler{
+		MinInterval:   statsMinInterval,
+		StaleAfter:    statsStaleAfter,
+		SweepInterval: statsSweepInterval,
+		Workers:       statsWorkers,
+		calc:          calc,
+		stale:         stale,
+		queue:         make(chan StatsJob, statsQueueSize),
+		done:          make(chan struct{}),
+		pending:       map[StatsJob]bool{},
+		last:          map[StatsJob]time.Time{},
+	}
+}
+
+// Start runs the workers & periodic sweep in the background
+func (s *StatsScheduler) Start() {
+	for i := 0; i < s.Workers; i++ {
+		go s.work()
+	}
+	go func() {
+		// sweep once at startup so stats missed while the server was down
+		// are refreshed
+		s.sweep()
+		ticker := time.NewTicker(s.SweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.sweep()
+			case <-s.done:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the workers & sweep. jobs still queued are dropped
+func (s *StatsScheduler) Stop() {
+	close(s.done)
+}
+
+// Request asks for a job's stats to be recalculated, reporting whether the
+// job was queued. it's safe to call on a nil scheduler, which is a no-op
+func (s *StatsScheduler) Request(typ, id string) bool {
+	if s == nil || id == "" {
+		return false
+	}
+	job := StatsJob{Type: typ, Id: id}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.pending[job] {
+		return false
+	}
+	if t, ok := s.last[job]; ok && time.Since(t) < s.MinInterval {
+		return false
+	}
+
+	select {
+	case s.queue <- job:
+		s.pending[job] = true
+		return true
+	default:
+		log.Infof("stats queue full, dropping %s %s", job.Type, job.Id)
+		return false
+	}
+}
+
+func (s *StatsScheduler) work() {
+	for {
+		select {
+		case job := <-s.queue:
+			s.run(job)
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// run calculates a job & publishes the result
+func (s *StatsScheduler) run(job StatsJob) {
+	result, err := s.calc(job)
+
+	s.lock.Lock()
+	delete(s.pending, job)
+	if err == nil {
+		s.last[job] = time.Now()
+	}
+	s.lock.Unlock()
+
+	if err != nil {
+		log.Infof("error calculating stats for %s %s: %s", job.Type, job.Id, err.Error())
+		return
+	}
+
+	// stats go to the same topic as admin changes to the source or primer
+	room.Publish(AuditTopic(job.Type, job.Id), &ClientResponse{
+		Type:      job.Type + "_STATS",
+		RequestId: "server",
+		Schema:    job.Type + "_STATS",
+		Id:        job.Id,
+		Data:      result,
+	})
+}
+
+// sweep requests stale stats & forgets calculation times old enough that
+// they no longer limit requests
+func (s *StatsScheduler) sweep() {
+	s.lock.Lock()
+	for job, t := range s.last {
+		if time.Since(t) >= s.MinInterval {
+			delete(s.last, job)
+		}
+	}
+	s.lock.Unlock()
+
+	jobs, err := s.stale(time.Now().Add(-s.StaleAfter), statsQueueSize)
+	if err != nil {
+		log.Infof("error reading stale stats: %s", err.Error())
+		return
+	}
+	for _, job := range jobs {
+		s.Request(job.Type, job.Id)
+	}
+}
+
+// CalcStats recalculates & saves the stats of a source or primer, recording
+// when they were calculated. primer stats include all of its sources &
+// sub-primers, which are recalculated along the way
+func CalcStats(db *sql.DB, job StatsJob) (interface{}, error) {
+	now := time.Now().Round(time.Second).In(time.UTC)
+	switch job.Type {
+	case StatsSource:
+		src := &core.Source{Id: job.Id}
+		if err := src.Read(store); err != nil {
+			return nil, err
+		}
+		if err := src.CalcStats(db); err != nil {
+			return nil, err
+		}
+		_, err := db.Exec(qSourceStatsCalculated, src.Id, now)
+		return src.Stats, err
+	case StatsPrimer:
+		p := &core.Primer{Id: job.Id}
+		if err := p.Read(store); err != nil {
+			return nil, err
+		}
+		if err := p.CalcStats(db); err != nil {
+			return nil, err
+		}
+		_, err := db.Exec(qPrimerStatsCalculated, p.Id, now)
+		return p.Stats, err
+	}
+	return nil, fmt.Errorf("unknown stats type: '%s'", job.Type)
+}
+
+// ReadStaleStats lists up to limit sources & primers whose stats haven't
+// been calculated since before
+func ReadStaleStats(db sqlQueryable, before time.Time, limit int) ([]StatsJob, error) {
+	rows, err := db.Query(qStaleStats, before.In(time.UTC), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []StatsJob{}
+	for rows.Next() {
+		var (
+			job        StatsJob
+			calculated *time.Time
+		)
+		if err := rows.Scan(&job.Type, &job.Id, &calculated); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
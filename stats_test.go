@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestStatsSchedulerRequest(t *testing.T) {
+	calcs := 0
+	s := newStatsScheduler(func(job StatsJob) (interface{}, error) {
+		calcs++
+		if job.Id == "bad" {
+			return nil, fmt.Errorf("calculation failed")
+		}
+		return job.Id, nil
+	}, nil)
+
+	if !s.Request(StatsSource, "a") {
+		t.Errorf("expected first request to be queued")
+	}
+	if s.Request(StatsSource, "a") {
+		t.Errorf("expected duplicate request to be ignored while queued")
+	}
+	if !s.Request(StatsPrimer, "a") {
+		t.Errorf("expected a primer with the same id to be queued separately")
+	}
+	if s.Request(StatsSource, "") {
+		t.Errorf("expected empty id to be ignored")
+	}
+
+	s.run(<-s.queue)
+	s.run(<-s.queue)
+	if calcs != 2 {
+		t.Errorf("expected 2 calculations, got: %d", calcs)
+	}
+	if s.Request(StatsSource, "a") {
+		t.Errorf("expected request within MinInterval to be ignored")
+	}
+
+	s.MinInterval = 0
+	if !s.Request(StatsSource, "a") {
+		t.Errorf("expected request after MinInterval to be queued")
+	}
+
+	// failed calculations can be retried immediately
+	s.MinInterval = time.Hour
+	s.Request(StatsSource, "bad")
+	<-s.queue
+	s.run(StatsJob{Type: StatsSource, Id: "bad"})
+	if !s.Request(StatsSource, "bad") {
+		t.Errorf("expected failed job to be requestable again")
+	}
+}
+
+func TestStatsSchedulerQueueFull(t *testing.T) {
+	s := newStatsScheduler(nil, nil)
+	for i := 0; i < statsQueueSize; i++ {
+		if !s.Request(StatsSource, fmt.Sprintf("%d", i)) {
+			t.Fatalf("expected request %d to be queued", i)
+		}
+	}
+	if s.Request(StatsSource, "overflow") {
+		t.Errorf("expected request to a full queue to be dropped")
+	}
+	if s.pending[StatsJob{Type: StatsSource, Id: "overflow"}] {
+		t.Errorf("expected dropped job not to be pending")
+	}
+}
+
+func TestStatsSchedulerSweep(t *testing.T) {
+	s := newStatsScheduler(nil, func(before time.Time, limit int) ([]StatsJob, error) {
+		return []StatsJob{{Type: StatsSource, Id: "a"}, {Type: StatsPrimer, Id: "b"}}, nil
+	})
+	s.last[StatsJob{Type: StatsSource, Id: "old"}] = time.Now().Add(-2 * s.MinInterval)
+	s.last[StatsJob{Type: StatsSource, Id: "a"}] = time.Now()
+
+	s.sweep()
+	if len(s.queue) != 1 {
+		t.Errorf("expected 1 job to be queued, got: %d", len(s.queue))
+	}
+	if _, ok := s.last[StatsJob{Type: StatsSource, Id: "old"}]; ok {
+		t.Errorf("expected old calculation time to be forgotten")
+	}
+}
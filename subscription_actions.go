@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// SubscribeAct subscribes the requesting client to server-pushed events
+// for a topic, eg: "URL:http://www.epa.gov" or "WARC_IMPORT:[id]". collection
+// topics require a role that can view the collection
+type SubscribeAct struct {
+	ReqAction
+	Topic string
+}
+
+func (SubscribeAct) Type() string        { return "SUBSCRIBE_REQUEST" }
+func (SubscribeAct) SuccessType() string { return "SUBSCRIBE_SUCCESS" }
+func (SubscribeAct) FailureType() string { return "SUBSCRIBE_FAILURE" }
+
+func (SubscribeAct) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &SubscribeAct{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *SubscribeAct) Exec() (res *ClientResponse) {
+	if err := a.validate(); err != nil {
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	a.client.hub.subscribe <- subscription{client: a.client, topic: a.Topic}
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Id:        a.Topic,
+	}
+}
+
+func (a *SubscribeAct) validate() error {
+	if a.client == nil {
+		return fmt.Errorf("subscriptions require a connection")
+	}
+	if a.Topic == "" {
+		return fmt.Errorf("topic is required")
+	}
+	if strings.HasPrefix(a.Topic, CollectionTopic("")) {
+		id := strings.TrimPrefix(a.Topic, CollectionTopic(""))
+		return requireCollectionRole(appDB, id, a.client.keyId(), CollectionRoleViewer)
+	}
+	return nil
+}
+
+// UnsubscribeAct removes the requesting client from a topic
+type UnsubscribeAct struct {
+	ReqAction
+	Topic string
+}
+
+func (UnsubscribeAct) Type() string        { return "UNSUBSCRIBE_REQUEST" }
+func (UnsubscribeAct) SuccessType() string { return "UNSUBSCRIBE_SUCCESS" }
+func (UnsubscribeAct) FailureType() string { return "UNSUBSCRIBE_FAILURE" }
+
+func (UnsubscribeAct) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &UnsubscribeAct{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *UnsubscribeAct) Exec() (res *ClientResponse) {
+	if a.client == nil {
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     "subscriptions require a connection",
+		}
+	}
+
+	a.client.hub.unsubscribe <- subscription{client: a.client, topic: a.Topic}
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Id:        a.Topic,
+	}
+}
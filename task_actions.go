@@ -9,8 +9,7 @@ import (
 
 type TasksRequestAct struct {
 	ReqAction
-	Page     int `json:"page"`
-	PageSize int `json:"pageSize"`
+	PageParams
 }
 
 func (TasksRequestAct) Type() string        { return "TASKS_FETCH_REQUEST" }
@@ -25,6 +24,17 @@ func (TasksRequestAct) Parse(reqId string, data json.RawMessage) ClientRequestAc
 }
 
 func (a *TasksRequestAct) Exec() (res *ClientResponse) {
+	// the tasks service only lists by offset
+	offset, err := a.offsetCursor()
+	if err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
 	conn, err := net.Dial("tcp", cfg.TasksServiceUrl)
 	if err != nil {
 		log.Info(err.Error())
@@ -38,7 +48,7 @@ func (a *TasksRequestAct) Exec() (res *ClientResponse) {
 	cli := rpc.NewClient(conn)
 	p := &tasks.TasksListParams{
 		Limit:  a.PageSize,
-		Offset: (a.Page - 1) * a.PageSize,
+		Offset: offset,
 	}
 	reply := []*tasks.Task{}
 	if err := cli.Call("TaskRequests.List", p, &reply); err != nil {
@@ -51,12 +61,12 @@ func (a *TasksRequestAct) Exec() (res *ClientResponse) {
 		return
 	}
 
-	return &ClientResponse{
+	return offsetPage(&a.PageParams, offset, len(reply), -1).respond(&a.PageParams, &ClientResponse{
 		Type:      a.SuccessType(),
 		RequestId: a.RequestId,
 		Schema:    "TASK_ARRAY",
 		Data:      reply,
-	}
+	})
 }
 
 type TaskEnqueueAct struct {
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/datatogether/core"
+)
+
+// FetchUncrawlablesAction grabs a page of uncrawlables, optionally filtered
+// by subprimer and agency
+type FetchUncrawlablesAction struct {
+	ReqAction
+	SubprimerId string
+	// agency id or name
+	Agency string
+	PageParams
+}
+
+func (FetchUncrawlablesAction) Type() string        { return "UNCRAWLABLES_FETCH_REQUEST" }
+func (FetchUncrawlablesAction) SuccessType() string { return "UNCRAWLABLES_FETCH_SUCCESS" }
+func (FetchUncrawlablesAction) FailureType() string { return "UNCRAWLABLES_FETCH_FAILURE" }
+
+func (FetchUncrawlablesAction) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &FetchUncrawlablesAction{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *FetchUncrawlablesAction) Exec() (res *ClientResponse) {
+	u, page, err := ListUncrawlablesPage(appDB, a.SubprimerId, a.Agency, &a.PageParams)
+	if err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return page.respond(&a.PageParams, &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "UNCRAWLABLE_ARRAY",
+		Data:      u,
+	})
+}
+
+// FetchUncrawlableAction grabs a single uncrawlable by id or url
+type FetchUncrawlableAction struct {
+	ReqAction
+	Id  string
+	Url string
+}
+
+func (FetchUncrawlableAction) Type() string        { return "UNCRAWLABLE_FETCH_REQUEST" }
+func (FetchUncrawlableAction) SuccessType() string { return "UNCRAWLABLE_FETCH_SUCCESS" }
+func (FetchUncrawlableAction) FailureType() string { return "UNCRAWLABLE_FETCH_FAILURE" }
+
+func (FetchUncrawlableAction) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &FetchUncrawlableAction{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *FetchUncrawlableAction) Exec() (res *ClientResponse) {
+	u := &core.Uncrawlable{Id: a.Id, Url: a.Url}
+	if err := u.Read(store); err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "UNCRAWLABLE",
+		Data:      u,
+	}
+}
+
+// SaveUncrawlableAction creates or updates an uncrawlable. New uncrawlables
+// are attributed to the key of the requesting user, only that key may update
+// them
+type SaveUncrawlableAction struct {
+	ReqAction
+	Uncrawlable *core.Uncrawlable `json:"uncrawlable"`
+}
+
+func (SaveUncrawlableAction) Type() string        { return "UNCRAWLABLE_SAVE_REQUEST" }
+func (SaveUncrawlableAction) SuccessType() string { return "UNCRAWLABLE_SAVE_SUCCESS" }
+func (SaveUncrawlableAction) FailureType() string { return "UNCRAWLABLE_SAVE_FAILURE" }
+
+func (SaveUncrawlableAction) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &SaveUncrawlableAction{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *SaveUncrawlableAction) Exec() (res *ClientResponse) {
+	if err := a.save(); err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "UNCRAWLABLE",
+		Data:      a.Uncrawlable,
+	}
+}
+
+func (a *SaveUncrawlableAction) save() error {
+	keyId := a.client.keyId()
+	if keyId == "" {
+		return fmt.Errorf("you must be logged in to save uncrawlables")
+	}
+	u := a.Uncrawlable
+	if u == nil || u.Url == "" {
+		return fmt.Errorf("uncrawlable url is required")
+	}
+
+	// uncrawlables are unique by url, find any existing entry so
+	// saving updates instead of conflicting
+	prev := &core.Uncrawlable{Id: u.Id, Url: u.Url}
+	if err := prev.Read(store); err == nil {
+		if prev.Creator != keyId {
+			return fmt.Errorf("only the creator of an uncrawlable can change it")
+		}
+		u.Id = prev.Id
+		u.Created = prev.Created
+		u.Creator = prev.Creator
+	} else if err == core.ErrNotFound {
+		u.Creator = keyId
+	} else {
+		return err
+	}
+
+	return u.Save(store)
+}
+
+// DeleteUncrawlableAction removes an uncrawlable. Only the key that created
+// an uncrawlable may delete it
+type DeleteUncrawlableAction struct {
+	ReqAction
+	Id string `json:"id"`
+}
+
+func (DeleteUncrawlableAction) Type() string        { return "UNCRAWLABLE_DELETE_REQUEST" }
+func (DeleteUncrawlableAction) SuccessType() string { return "UNCRAWLABLE_DELETE_SUCCESS" }
+func (DeleteUncrawlableAction) FailureType() string { return "UNCRAWLABLE_DELETE_FAILURE" }
+
+func (DeleteUncrawlableAction) Parse(reqId string, data json.RawMessage) ClientRequestAction {
+	a := &DeleteUncrawlableAction{}
+	a.RequestId = reqId
+	a.err = json.Unmarshal(data, a)
+	return a
+}
+
+func (a *DeleteUncrawlableAction) Exec() (res *ClientResponse) {
+	u := &core.Uncrawlable{Id: a.Id}
+	if err := a.delete(u); err != nil {
+		log.Info(err.Error())
+		return &ClientResponse{
+			Type:      a.FailureType(),
+			RequestId: a.RequestId,
+			Error:     err.Error(),
+		}
+	}
+
+	return &ClientResponse{
+		Type:      a.SuccessType(),
+		RequestId: a.RequestId,
+		Schema:    "UNCRAWLABLE",
+		Data:      u,
+	}
+}
+
+func (a *DeleteUncrawlableAction) delete(u *core.Uncrawlable) error {
+	if err := u.Read(store); err != nil {
+		return err
+	}
+	if keyId := a.client.keyId(); keyId == "" || keyId != u.Creator {
+		return fmt.Errorf("only the creator of an uncrawlable can delete it")
+	}
+	return DeleteUncrawlable(appDB, u)
+}
@@ -0,0 +1,12 @@
+package main
+
+import (
+	"github.com/datatogether/core"
+)
+
+// DeleteUncrawlable removes an uncrawlable. core's Uncrawlable.Delete matches
+// on url using the id param, so this deletes by id directly
+func DeleteUncrawlable(db sqlExecable, u *core.Uncrawlable) error {
+	_, err := db.Exec(qUncrawlableDeleteById, u.Id)
+	return err
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/datatogether/core"
+	"github.com/datatogether/warc"
+	"github.com/pborman/uuid"
+)
+
+// default & max number of urls written to a single WARC export
+const (
+	defaultWarcExportLimit = 500
+	maxWarcExportLimit     = 5000
+)
+
+// WarcExport describes a set of urls to export as a WARC file. Exactly one of
+// Url, SourceId or CollectionId should be set
+type WarcExport struct {
+	Url          string
+	SourceId     string
+	CollectionId string
+	// max number of urls to include
+	Limit int
+}
+
+// Filename gives a name for the exported WARC file
+func (e *WarcExport) Filename() string {
+	switch {
+	case e.SourceId != "":
+		return fmt.Sprintf("source-%s.warc", e.SourceId)
+	case e.CollectionId != "":
+		return fmt.Sprintf("collection-%s.warc", e.CollectionId)
+	}
+	return "url.warc"
+}
+
+// Urls reads the urls this export covers
+func (e *WarcExport) Urls(db *sql.DB) ([]*core.Url, error) {
+	if e.Limit <= 0 {
+		e.Limit = defaultWarcExportLimit
+	}
+	if e.Limit > maxWarcExportLimit {
+		e.Limit = maxWarcExportLimit
+	}
+
+	switch {
+	case e.Url != "":
+		u := &core.Url{Url: e.Url}
+		if err := u.Read(store); err != nil {
+			return nil, err
+		}
+		return []*core.Url{u}, nil
+	case e.SourceId != "":
+		s := &core.Source{Id: e.SourceId}
+		if err := s.Read(store); err != nil {
+			return nil, err
+		}
+		rows, err := db.Query(qSourceFetchedUrls, "%"+s.Url+"%", e.Limit, 0)
+		if err != nil {
+			return nil, err
+		}
+		return core.UnmarshalUrls(rows)
+	case e.CollectionId != "":
+		c := &core.Collection{Id: e.CollectionId}
+		if err := c.Read(store); err != nil {
+			return nil, err
+		}
+		rows, err := db.Query(qCollectionUrls, c.Id, e.Limit, 0)
+		if err != nil {
+			return nil, err
+		}
+		return core.UnmarshalUrls(rows)
+	}
+
+	return nil, fmt.Errorf("url, sourceId or collectionId is required")
+}
+
+// Path gives the url path that downloads the export as a WARC file
+func (e *WarcExport) Path() string {
+	q := url.Values{}
+	switch {
+	case e.SourceId != "":
+		q.Set("source", e.SourceId)
+	case e.CollectionId != "":
+		q.Set("collection", e.CollectionId)
+	default:
+		q.Set("url", e.Url)
+	}
+	if e.Limit > 0 {
+		q.Set("limit", strconv.Itoa(e.Limit))
+	}
+	return "/warc?" + q.Encode()
+}
+
+// Write writes a WARC file of the export to w, returning the number of
+// records written
+func (e *WarcExport) Write(db *sql.DB, w io.Writer) (int, error) {
+	urls, err := e.Urls(db)
+	if err != nil {
+		return 0, err
+	}
+	return e.WriteUrls(w, urls)
+}
+
+// WriteUrls writes a WARC file of urls to w a url at a time, so only one
+// url's content is held in memory at once. it returns the number of records
+// written
+func (e *WarcExport) WriteUrls(w io.Writer, urls []*core.Url) (int, error) {
+	info := warcInfoRecord(e.Filename())
+	if err := info.Write(w); err != nil {
+		return 0, err
+	}
+	written := 1
+	for _, u := range urls {
+		records := warcRecordsForUrl(u, info.WARCRecordId)
+		if err := warc.WriteRecords(w, records); err != nil {
+			return written, err
+		}
+		written += len(records)
+	}
+	return written, nil
+}
+
+// warcRecordCount gives the number of records in a WARC file of n urls:
+// a warcinfo record, plus request, response & metadata records for each url
+func warcRecordCount(n int) int {
+	return 1 + 3*n
+}
+
+// WarcRecords builds a warcinfo record followed by request, response & metadata
+// records for each url. Response content is read from S3 when a url has a content hash
+func WarcRecords(filename string, urls []*core.Url) []warc.Record {
+	info := warcInfoRecord(filename)
+	records := []warc.Record{info}
+	for _, u := range urls {
+		records = append(records, warcRecordsForUrl(u, info.WARCRecordId)...)
+	}
+	return records
+}
+
+func warcInfoRecord(filename string) *warc.WARCInfo {
+	content := warcFields(
+		"software", "patchbay",
+		"format", "WARC File Format 1.0",
+		"description", "datatogether archive export",
+	)
+	return &warc.WARCInfo{
+		WARCRecordId:  warcRecordId(),
+		WARCDate:      time.Now().In(time.UTC),
+		WARCFilename:  filename,
+		ContentType:   "application/warc-fields",
+		ContentLength: int64(len(content)),
+		Content:       content,
+	}
+}
+
+// warcRecordsForUrl creates request, response & metadata records for a url
+func warcRecordsForUrl(u *core.Url, warcinfoId string) []warc.Record {
+	date := u.Updated
+	if u.LastGet != nil {
+		date = *u.LastGet
+	}
+	date = date.In(time.UTC)
+
+	reqId, resId := warcRecordId(), warcRecordId()
+
+	req := u.WarcRequest()
+	req.WARCRecordId = reqId
+	req.WARCDate = date
+	req.WARCConcurrentTo = resId
+	req.WARCWarcinfoID = warcinfoId
+	req.ContentType = "application/http; msgtype=request"
+	req.Content = warcHttpRequest(u)
+	req.ContentLength = int64(len(req.Content))
+
+	res := &warc.Response{
+		WARCRecordId:   resId,
+		WARCDate:       date,
+		WARCTargetURI:  u.Url,
+		WARCWarcinfoID: warcinfoId,
+		ContentType:    "application/http; msgtype=response",
+	}
+	body, err := urlContent(u)
+	if err != nil {
+		log.Infof("error reading content for %s: %s", u.Url, err.Error())
+		res.WARCTruncated = "unspecified"
+	}
+	if len(u.Hash) > 4 {
+		res.WARCPayloadDigest = "sha256:" + u.Hash[4:]
+	}
+	res.Content = warcHttpResponse(u, body)
+	res.ContentLength = int64(len(res.Content))
+
+	meta := &warc.Metadata{
+		WARCRecordId:   warcRecordId(),
+		WARCDate:       date,
+		WARCTargetURI:  u.Url,
+		WARCRefersTo:   resId,
+		WARCWarcinfoID: warcinfoId,
+		ContentType:    "application/warc-fields",
+		Content: warcFields(
+			"title", u.Title,
+			"content-type", u.ContentType,
+			"content-sniff", u.ContentSniff,
+			"file-name", u.FileName,
+			"hash", u.Hash,
+			"headers-took", fmt.Sprintf("%d", u.HeadersTook),
+			"download-took", fmt.Sprintf("%d", u.DownloadTook),
+		),
+	}
+	meta.ContentLength = int64(len(meta.Content))
+
+	return []warc.Record{req, res, meta}
+}
+
+// urlContent reads the stored content for a url. urls without a content hash
+// (or with the hash of empty content) have no stored content
+func urlContent(u *core.Url) ([]byte, error) {
+	if u.Hash == "" || u.Hash == emptyContentHash {
+		return nil, nil
+	}
+	f, err := u.File()
+	if err != nil {
+		return nil, err
+	}
+	if err := f.GetS3(); err != nil {
+		return nil, err
+	}
+	return f.Data, nil
+}
+
+// emptyContentHash is the sha2-256 multihash of an empty byte slice
+const emptyContentHash = "1220e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// warcHttpRequest reconstructs the GET request used to fetch a url
+func warcHttpRequest(u *core.Url) []byte {
+	buf := &bytes.Buffer{}
+	path, host := "/", ""
+	if pu, err := u.ParsedUrl(); err == nil {
+		path, host = pu.RequestURI(), pu.Host
+	}
+	fmt.Fprintf(buf, "GET %s HTTP/1.1\r\n", path)
+	fmt.Fprintf(buf, "Host: %s\r\n\r\n", host)
+	return buf.Bytes()
+}
+
+// warcHttpResponse reconstructs an http response from a url's stored status
+// and headers, followed by body
+func warcHttpResponse(u *core.Url, body []byte) []byte {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "HTTP/1.1 %d %s\r\n", u.Status, http.StatusText(u.Status))
+	for i := 0; i+1 < len(u.Headers); i += 2 {
+		fmt.Fprintf(buf, "%s: %s\r\n", u.Headers[i], u.Headers[i+1])
+	}
+	buf.WriteString("\r\n")
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+// warcFields formats key, value pairs as application/warc-fields content,
+// skipping empty values
+func warcFields(keyvals ...string) []byte {
+	buf := &bytes.Buffer{}
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		if keyvals[i+1] == "" {
+			continue
+		}
+		fmt.Fprintf(buf, "%s: %s\r\n", keyvals[i], keyvals[i+1])
+	}
+	return buf.Bytes()
+}
+
+func warcRecordId() string {
+	return fmt.Sprintf("<urn:uuid:%s>", uuid.New())
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/datatogether/core"
+	"github.com/datatogether/warc"
+)
+
+func TestWarcRecords(t *testing.T) {
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	urls := []*core.Url{
+		{
+			Id:          "cee7bbd4-2bf9-4b83-b2c8-be6aeb70e771",
+			Url:         "http://www.epa.gov/foo?bar=baz",
+			LastGet:     &now,
+			Status:      200,
+			ContentType: "text/html",
+			Title:       "EPA",
+			Headers:     []string{"Content-Type", "text/html"},
+		},
+	}
+
+	records := WarcRecords("test.warc", urls)
+	if len(records) != 4 {
+		t.Fatalf("expected 4 records, got %d", len(records))
+	}
+
+	buf := &bytes.Buffer{}
+	if err := warc.WriteRecords(buf, records); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	read := []*warcRecord{}
+	rdr := newWarcReader(buf)
+	for {
+		rec, err := rdr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		read = append(read, rec)
+	}
+	if len(read) != len(records) {
+		t.Fatalf("record count mismatch. expected: %d, got: %d", len(records), len(read))
+	}
+
+	expect := []warc.RecordType{warc.RecordTypeWarcInfo, warc.RecordTypeRequest, warc.RecordTypeResponse, warc.RecordTypeMetadata}
+	for i, rec := range read {
+		if rec.Type() != expect[i].String() {
+			t.Errorf("record %d type mismatch. expected: %s, got: %s", i, expect[i], rec.Type())
+		}
+		if int64(len(rec.Content)) != records[i].GetContentLength() {
+			t.Errorf("record %d content length mismatch. expected: %d, got: %d", i, records[i].GetContentLength(), len(rec.Content))
+		}
+	}
+
+	response, err := read[2].Response()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if response.WARCTargetURI != urls[0].Url {
+		t.Errorf("response target mismatch. expected: %s, got: %s", urls[0].Url, response.WARCTargetURI)
+	}
+
+	req := string(warcHttpRequest(urls[0]))
+	if req != "GET /foo?bar=baz HTTP/1.1\r\nHost: www.epa.gov\r\n\r\n" {
+		t.Errorf("request mismatch: %q", req)
+	}
+
+	res := string(warcHttpResponse(urls[0], []byte("<html></html>")))
+	if res != "HTTP/1.1 200 OK\r\nContent-Type: text/html\r\n\r\n<html></html>" {
+		t.Errorf("response mismatch: %q", res)
+	}
+}
+
+func TestWarcExportPath(t *testing.T) {
+	cases := []struct {
+		e      WarcExport
+		expect string
+	}{
+		{WarcExport{Url: "http://www.epa.gov/foo?bar=baz"}, "/warc?url=http%3A%2F%2Fwww.epa.gov%2Ffoo%3Fbar%3Dbaz"},
+		{WarcExport{SourceId: "abc", Limit: 10}, "/warc?limit=10&source=abc"},
+		{WarcExport{CollectionId: "def"}, "/warc?collection=def"},
+	}
+
+	for i, c := range cases {
+		if got := c.e.Path(); got != c.expect {
+			t.Errorf("case %d mismatch. expected: '%s', got: '%s'", i, c.expect, got)
+		}
+	}
+
+	if warcRecordCount(1) != 4 {
+		t.Errorf("expected 4 records for one url, got %d", warcRecordCount(1))
+	}
+}
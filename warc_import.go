@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/datatogether/core"
+	"github.com/datatogether/warc"
+	"github.com/pborman/uuid"
+)
+
+// number of records to read between progress updates
+const warcImportProgressInterval = 25
+
+// how long finished imports are kept for status requests
+const warcImportTTL = 24 * time.Hour
+
+// warcImports keeps track of all imports this server has run, by id
+var warcImports = struct {
+	sync.Mutex
+	imports map[string]*WarcImport
+}{imports: map[string]*WarcImport{}}
+
+// WarcImport tracks the progress of reading a WARC file into the
+// urls, snapshots & links tables. Progress is published to the topic
+// given by Topic as WARC_IMPORT_PROGRESS actions
+type WarcImport struct {
+	lock     sync.Mutex
+	Id       string    `json:"id"`
+	Created  time.Time `json:"created"`
+	Filename string    `json:"filename"`
+	// id of the admin that uploaded the file
+	UserId string `json:"userId"`
+	// number of WARC records read
+	Records int `json:"records"`
+	// number of response records written as urls
+	Urls int `json:"urls"`
+	// number of links recorded from html responses
+	Links int `json:"links"`
+	// number of response bodies stored
+	Stored int `json:"stored"`
+	// errors for individual records, the import continues past these
+	RecordErrors []string `json:"recordErrors,omitempty"`
+	// error that stopped the import, if any
+	Error string `json:"error,omitempty"`
+	Done  bool   `json:"done"`
+	// when the import finished, used to evict old imports
+	finished time.Time
+}
+
+// NewWarcImport creates & registers a new import
+func NewWarcImport(filename, userId string) *WarcImport {
+	imp := &WarcImport{
+		Id:       uuid.New(),
+		Created:  time.Now().Round(time.Second).In(time.UTC),
+		Filename: filename,
+		UserId:   userId,
+	}
+	warcImports.Lock()
+	evictWarcImports(time.Now())
+	warcImports.imports[imp.Id] = imp
+	warcImports.Unlock()
+	return imp
+}
+
+// evictWarcImports forgets imports that finished more than warcImportTTL
+// before now. callers must hold the warcImports lock
+func evictWarcImports(now time.Time) {
+	for id, imp := range warcImports.imports {
+		imp.lock.Lock()
+		expired := imp.Done && now.Sub(imp.finished) > warcImportTTL
+		imp.lock.Unlock()
+		if expired {
+			delete(warcImports.imports, id)
+		}
+	}
+}
+
+// ReadWarcImport fetches a registered import by id
+func ReadWarcImport(id string) (*WarcImport, error) {
+	warcImports.Lock()
+	defer warcImports.Unlock()
+	if imp, ok := warcImports.imports[id]; ok {
+		return imp, nil
+	}
+	return nil, core.ErrNotFound
+}
+
+// Topic is the subscription topic progress is published to
+func (imp *WarcImport) Topic() string {
+	return "WARC_IMPORT:" + imp.Id
+}
+
+// Status gives a copy of the import's current state that's safe to marshal
+func (imp *WarcImport) Status() *WarcImport {
+	imp.lock.Lock()
+	defer imp.lock.Unlock()
+	return &WarcImport{
+		Id:           imp.Id,
+		Created:      imp.Created,
+		Filename:     imp.Filename,
+		UserId:       imp.UserId,
+		Records:      imp.Records,
+		Urls:         imp.Urls,
+		Links:        imp.Links,
+		Stored:       imp.Stored,
+		RecordErrors: append([]string(nil), imp.RecordErrors...),
+		Error:        imp.Error,
+		Done:         imp.Done,
+	}
+}
+
+// Run reads all records from r, importing any responses
+func (imp *WarcImport) Run(r io.Reader) error {
+	rdr := newWarcReader(r)
+	for {
+		rec, err := rdr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			imp.finish(err)
+			return err
+		}
+
+		var (
+			links    int
+			stored   bool
+			response = rec.Type() == warc.RecordTypeResponse.String()
+		)
+		if response {
+			var res *warc.Response
+			if res, err = rec.Response(); err == nil {
+				links, stored, err = importWarcResponse(res)
+			}
+		}
+
+		imp.lock.Lock()
+		imp.Records++
+		if err != nil {
+			imp.RecordErrors = append(imp.RecordErrors, fmt.Sprintf("record %s: %s", rec.Id(), err.Error()))
+		} else if response {
+			imp.Urls++
+			imp.Links += links
+			if stored {
+				imp.Stored++
+			}
+		}
+		records := imp.Records
+		imp.lock.Unlock()
+
+		if records%warcImportProgressInterval == 0 {
+			imp.publish()
+		}
+	}
+
+	imp.finish(nil)
+	return nil
+}
+
+// finish marks the import as done & sends a final progress update
+func (imp *WarcImport) finish(err error) {
+	imp.lock.Lock()
+	imp.Done = true
+	imp.finished = time.Now()
+	if err != nil {
+		imp.Error = err.Error()
+	}
+	imp.lock.Unlock()
+	imp.publish()
+}
+
+func (imp *WarcImport) publish() {
+	room.Publish(imp.Topic(), &ClientResponse{
+		Type:      "WARC_IMPORT_PROGRESS",
+		RequestId: "server",
+		Schema:    "WARC_IMPORT",
+		Id:        imp.Id,
+		Data:      imp.Status(),
+	})
+}
+
+// importWarcResponse creates or updates the url a response record targets,
+// writing a snapshot, storing the response body & recording links from html
+// documents. It returns the number of links recorded and whether the body
+// was stored
+func importWarcResponse(rec *warc.Response) (links int, stored bool, err error) {
+	if rec.WARCTargetURI == "" {
+		return 0, false, fmt.Errorf("response record has no target uri")
+	}
+
+	res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(rec.Content)), nil)
+	if err != nil {
+		return 0, false, fmt.Errorf("error reading http response: %s", err.Error())
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return 0, false, fmt.Errorf("error reading response body: %s", err.Error())
+	}
+
+	u := &core.Url{Url: rec.WARCTargetURI}
+	if err := u.Read(store); err != nil && err != core.ErrNotFound {
+		return 0, false, err
+	}
+
+	date := rec.WARCDate.In(time.UTC)
+	u.LastGet = &date
+	u.Status = res.StatusCode
+	u.ContentLength = int64(len(body))
+	u.ContentType = res.Header.Get("Content-Type")
+	u.ContentSniff = http.DetectContentType(body)
+	u.Headers = headersSlice(res.Header)
+
+	f := &core.File{Url: u.Url, Data: body}
+	if _, err := f.Filename(); err != nil {
+		return 0, false, err
+	}
+	u.Hash = f.Hash
+
+	var doc *goquery.Document
+	if u.ContentSniff == "text/html; charset=utf-8" || u.ContentSniff == "text/plain; charset=utf-8" {
+		if doc, err = goquery.NewDocumentFromReader(bytes.NewReader(body)); err == nil {
+			u.Title = doc.Find("title").Text()
+		}
+	}
+
+	if err := u.Save(store); err != nil {
+		return 0, false, err
+	}
+	if err := core.WriteSnapshot(store, u); err != nil {
+		return 0, false, err
+	}
+
+	if len(body) > 0 && core.AwsS3BucketName != "" && u.ShouldPutS3() {
+		if err := f.PutS3(); err != nil {
+			return 0, false, fmt.Errorf("error storing content: %s", err.Error())
+		}
+		stored = true
+	}
+
+	if doc != nil {
+		ls, err := u.ExtractDocLinks(store, doc)
+		if err != nil {
+			return 0, stored, err
+		}
+		links = len(ls)
+	}
+
+	return links, stored, nil
+}
+
+// headersSlice flattens http headers into the [key,value,key,value...]
+// form core.Url stores
+func headersSlice(h http.Header) (headers []string) {
+	for key, vals := range h {
+		for _, val := range vals {
+			headers = append(headers, key, val)
+		}
+	}
+	return
+}
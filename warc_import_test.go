@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEvictWarcImports(t *testing.T) {
+	now := time.Now()
+	running := &WarcImport{Id: "running"}
+	recent := &WarcImport{Id: "recent", Done: true, finished: now.Add(-time.Hour)}
+	old := &WarcImport{Id: "old", Done: true, finished: now.Add(-warcImportTTL - time.Hour)}
+
+	warcImports.Lock()
+	defer warcImports.Unlock()
+	prev := warcImports.imports
+	defer func() { warcImports.imports = prev }()
+	warcImports.imports = map[string]*WarcImport{"running": running, "recent": recent, "old": old}
+
+	evictWarcImports(now)
+	if _, ok := warcImports.imports["old"]; ok {
+		t.Errorf("expected old import to be evicted")
+	}
+	if len(warcImports.imports) != 2 {
+		t.Errorf("expected running & recent imports to be kept, got %d imports", len(warcImports.imports))
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/datatogether/warc"
+)
+
+// maxWarcRecordSize is the largest record block an import will read
+const maxWarcRecordSize = 256 * 1024 * 1024
+
+// warcRecord is a WARC record as read from a file, header names are lowercase
+type warcRecord struct {
+	Headers map[string]string
+	Content []byte
+}
+
+// Type gives the record's WARC-Type
+func (r *warcRecord) Type() string {
+	return r.Headers["warc-type"]
+}
+
+// Id gives the record's WARC-Record-ID
+func (r *warcRecord) Id() string {
+	return r.Headers["warc-record-id"]
+}
+
+// Response converts a response record to the warc package's representation
+func (r *warcRecord) Response() (*warc.Response, error) {
+	date, err := time.Parse(time.RFC3339, r.Headers["warc-date"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid WARC-Date: %s", err.Error())
+	}
+	return &warc.Response{
+		WARCRecordId:      r.Id(),
+		WARCDate:          date,
+		ContentLength:     int64(len(r.Content)),
+		ContentType:       r.Headers["content-type"],
+		WARCPayloadDigest: r.Headers["warc-payload-digest"],
+		WARCTargetURI:     r.Headers["warc-target-uri"],
+		WARCWarcinfoID:    r.Headers["warc-warcinfo-id"],
+		Content:           r.Content,
+	}, nil
+}
+
+// warcReader reads records from a WARC file one at a time. the warc package's
+// reader splits blocks on the first blank line, which cuts records with http
+// headers short, so record blocks are read by Content-Length here instead
+type warcReader struct {
+	r *bufio.Reader
+}
+
+func newWarcReader(r io.Reader) *warcReader {
+	return &warcReader{r: bufio.NewReader(r)}
+}
+
+// Read reads the next record, returning io.EOF once no records remain
+func (wr *warcReader) Read() (*warcRecord, error) {
+	// skip blank lines between records
+	var line string
+	for {
+		l, err := wr.line()
+		if l != "" {
+			line = l
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !strings.HasPrefix(line, "WARC/") {
+		return nil, fmt.Errorf("expected WARC version line, got: %q", line)
+	}
+
+	rec := &warcRecord{Headers: map[string]string{}}
+	var last string
+	for {
+		l, err := wr.line()
+		if err != nil {
+			return nil, fmt.Errorf("error reading record headers: %s", err.Error())
+		}
+		if l == "" {
+			break
+		}
+		// lines starting with whitespace continue the previous header
+		if (l[0] == ' ' || l[0] == '\t') && last != "" {
+			rec.Headers[last] += " " + strings.TrimSpace(l)
+			continue
+		}
+		i := strings.Index(l, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid record header: %q", l)
+		}
+		last = strings.ToLower(strings.TrimSpace(l[:i]))
+		rec.Headers[last] = strings.TrimSpace(l[i+1:])
+	}
+
+	length, err := strconv.ParseInt(rec.Headers["content-length"], 10, 64)
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("record %s has an invalid Content-Length", rec.Id())
+	}
+	if length > maxWarcRecordSize {
+		return nil, fmt.Errorf("record %s is larger than the max record size of %d bytes", rec.Id(), maxWarcRecordSize)
+	}
+	rec.Content = make([]byte, length)
+	if _, err := io.ReadFull(wr.r, rec.Content); err != nil {
+		return nil, fmt.Errorf("error reading record %s content: %s", rec.Id(), err.Error())
+	}
+	return rec, nil
+}
+
+// line reads a line without its line ending
+func (wr *warcReader) line() (string, error) {
+	l, err := wr.r.ReadString('\n')
+	return strings.TrimRight(l, "\r\n"), err
+}